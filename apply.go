@@ -1,9 +1,20 @@
 package golembic
 
+import (
+	"github.com/blend/go-sdk/ex"
+)
+
 // ApplyConfig provides configurable fields for "up" commands that will apply
 // migrations.
 type ApplyConfig struct {
 	VerifyHistory bool
+	// TargetRevision is the last revision to be applied; if empty, all
+	// migrations (through the end of the sequence) will be applied.
+	TargetRevision string
+	// StopAtMilestone indicates that, rather than failing when a milestone
+	// is not the last pending migration, the plan should stop at the first
+	// pending milestone; the remaining migrations are left for a later run.
+	StopAtMilestone bool
 }
 
 // NewApplyConfig creates a new `ApplyConfig` and applies options.
@@ -26,3 +37,23 @@ func OptApplyVerifyHistory(verify bool) ApplyOption {
 		return nil
 	}
 }
+
+// OptApplyTarget sets `TargetRevision` on an `ApplyConfig`.
+func OptApplyTarget(revision string) ApplyOption {
+	return func(ac *ApplyConfig) error {
+		if revision == "" {
+			return ex.New(ErrMissingRevision)
+		}
+
+		ac.TargetRevision = revision
+		return nil
+	}
+}
+
+// OptApplyStopAtMilestone sets `StopAtMilestone` on an `ApplyConfig`.
+func OptApplyStopAtMilestone(stop bool) ApplyOption {
+	return func(ac *ApplyConfig) error {
+		ac.StopAtMilestone = stop
+		return nil
+	}
+}
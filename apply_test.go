@@ -1,6 +1,7 @@
 package golembic_test
 
 import (
+	"fmt"
 	"testing"
 
 	"github.com/blend/go-sdk/assert"
@@ -18,6 +19,21 @@ func TestNewApplyConfig(t *testing.T) {
 	expected := &golembic.ApplyConfig{}
 	it.Equal(expected, ac)
 
+	// Target revision
+	ac, err = golembic.NewApplyConfig(golembic.OptApplyTarget("ab1208989a3f"))
+	it.Nil(err)
+	expected = &golembic.ApplyConfig{TargetRevision: "ab1208989a3f"}
+	it.Equal(expected, ac)
+	ac, err = golembic.NewApplyConfig(golembic.OptApplyTarget(""))
+	it.Nil(ac)
+	it.Equal("A migration must have a revision", fmt.Sprintf("%v", err))
+
+	// Stop at milestone
+	ac, err = golembic.NewApplyConfig(golembic.OptApplyStopAtMilestone(true))
+	it.Nil(err)
+	expected = &golembic.ApplyConfig{StopAtMilestone: true}
+	it.Equal(expected, ac)
+
 	// Sad Path
 	known := ex.New("WRENCH")
 	opt := func(_ *golembic.ApplyConfig) error {
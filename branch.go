@@ -0,0 +1,184 @@
+package golembic
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/blend/go-sdk/ex"
+)
+
+// ValidateLinear verifies that a collection of migrations (in any order)
+// does not branch, i.e. that no two migrations have the same previous
+// migration. Branches typically occur when two migrations are developed
+// concurrently and both are merged. The error will describe each of the
+// branches, from the first migration after the fork up until the head.
+func ValidateLinear(ms []Migration) error {
+	children := childrenByPrevious(ms)
+	for _, migration := range ms {
+		if migration.Previous == "" {
+			continue
+		}
+
+		siblings := children[migration.Previous]
+		if len(siblings) < 2 {
+			continue
+		}
+
+		branches := make([]string, len(siblings))
+		for i, sibling := range siblings {
+			branches[i] = fmt.Sprintf("%q", describeBranch(branchPath(children, sibling)))
+		}
+		err := ex.New(
+			ErrMultipleHeads,
+			ex.OptMessagef("Previous: %q, Branches: %s", migration.Previous, strings.Join(branches, ", ")),
+		)
+		return err
+	}
+
+	return nil
+}
+
+// Rebase linearizes a collection of migrations (in any order) that contains
+// exactly two branches by moving the branch containing `revision` so that it
+// comes after the head of the other branch. The first migration on the
+// moved branch will have its `Previous` updated, but no other migrations are
+// modified. The migrations will be returned in order.
+//
+// This is intended to be used to resolve a merge conflict **before** any of
+// the migrations on the moved branch have been applied.
+func Rebase(ms []Migration, revision string) ([]Migration, error) {
+	children := childrenByPrevious(ms)
+	roots := children[""]
+	if len(roots) != 1 {
+		err := ex.New(ErrCannotRebase, ex.OptMessagef("Expected exactly one root migration, found %d", len(roots)))
+		return nil, err
+	}
+
+	trunk := branchPath(children, roots[0])
+	fork := trunk[len(trunk)-1]
+	heads := children[fork.Revision]
+	if len(heads) != 2 {
+		err := ex.New(
+			ErrCannotRebase,
+			ex.OptMessagef("Expected exactly two branches after revision %q, found %d", fork.Revision, len(heads)),
+		)
+		return nil, err
+	}
+
+	branch1 := branchPath(children, heads[0])
+	branch2 := branchPath(children, heads[1])
+	for _, branch := range [][]Migration{branch1, branch2} {
+		last := branch[len(branch)-1]
+		if len(children[last.Revision]) > 0 {
+			err := ex.New(ErrCannotRebase, ex.OptMessagef("Branch %q is itself branched", describeBranch(branch)))
+			return nil, err
+		}
+	}
+
+	if len(trunk)+len(branch1)+len(branch2) != len(ms) {
+		err := ex.New(ErrCannotRebase, ex.OptMessage("Some migrations cannot be reached from the root migration"))
+		return nil, err
+	}
+
+	onto, moved := branch1, branch2
+	if containsRevision(branch1, revision) {
+		onto, moved = branch2, branch1
+	} else if !containsRevision(branch2, revision) {
+		err := ex.New(ErrCannotRebase, ex.OptMessagef("Revision %q is not on either branch", revision))
+		return nil, err
+	}
+
+	moved[0].Previous = onto[len(onto)-1].Revision
+	result := make([]Migration, 0, len(ms))
+	result = append(result, trunk...)
+	result = append(result, onto...)
+	result = append(result, moved...)
+	return result, nil
+}
+
+// RebaseDirectory applies `Rebase()` to the SQL migration files in `dir`,
+// rewriting the `previous` header in the file for the first migration on the
+// branch containing `revision`. The path of the rewritten file is returned.
+func RebaseDirectory(dir, revision string) (string, error) {
+	files, err := loadMigrationFiles(os.DirFS(dir), ".")
+	if err != nil {
+		return "", err
+	}
+
+	ms := make([]Migration, len(files))
+	for i, file := range files {
+		ms[i] = file.Migration
+	}
+
+	rebased, err := Rebase(ms, revision)
+	if err != nil {
+		return "", err
+	}
+
+	for _, migration := range rebased {
+		for _, file := range files {
+			if file.Migration.Revision != migration.Revision || file.Migration.Previous == migration.Previous {
+				continue
+			}
+
+			updated, ok := replaceHeader(file.Contents, headerPrevious, migration.Previous)
+			if !ok {
+				err = ex.New(ErrInvalidMigrationFile, ex.OptMessagef("File: %q, missing %q header", file.Filename, headerPrevious))
+				return "", err
+			}
+
+			filename := filepath.Join(dir, filepath.FromSlash(file.Filename))
+			info, err := os.Stat(filename)
+			if err != nil {
+				return "", err
+			}
+			return filename, os.WriteFile(filename, updated, info.Mode())
+		}
+	}
+
+	// NOTE: This should not be reachable since a successful `Rebase()` always
+	//       modifies exactly one migration.
+	return "", ex.New(ErrCannotRebase, ex.OptMessage("No migration file was modified"))
+}
+
+// childrenByPrevious groups migrations by their previous revision; the root
+// migration(s) will be keyed by the empty string.
+func childrenByPrevious(ms []Migration) map[string][]Migration {
+	children := map[string][]Migration{}
+	for _, migration := range ms {
+		children[migration.Previous] = append(children[migration.Previous], migration)
+	}
+	return children
+}
+
+// branchPath follows a linear sequence of migrations starting from `start`
+// until a head (no children) or a fork (multiple children) is reached.
+func branchPath(children map[string][]Migration, start Migration) []Migration {
+	path := []Migration{start}
+	current := start
+	// NOTE: The length check guards against cycles in invalid input.
+	for len(children[current.Revision]) == 1 && len(path) <= len(children) {
+		current = children[current.Revision][0]
+		path = append(path, current)
+	}
+	return path
+}
+
+func describeBranch(path []Migration) string {
+	revisions := make([]string, len(path))
+	for i, migration := range path {
+		revisions[i] = migration.Revision
+	}
+	return strings.Join(revisions, " -> ")
+}
+
+func containsRevision(ms []Migration, revision string) bool {
+	for _, migration := range ms {
+		if migration.Revision == revision {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package golembic_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+
+	golembic "github.com/dhermes/golembic-blend"
+)
+
+func TestValidateLinear(t *testing.T) {
+	it := assert.New(t)
+
+	ms := branchedMigrations()
+	err := golembic.ValidateLinear(ms[:3])
+	it.Nil(err)
+
+	err = golembic.ValidateLinear(ms)
+	expected := `Migration sequence has multiple heads; Previous: "c7e1a09f4b2d", Branches: "5b9d3e1c0a7f -> 8e2f6a4d1c3b", "0f3a7c9e2d5b"`
+	it.Equal(expected, fmt.Sprintf("%v", err))
+}
+
+func TestRebase(t *testing.T) {
+	it := assert.New(t)
+
+	ms := branchedMigrations()
+	rebased, err := golembic.Rebase(ms, "0f3a7c9e2d5b")
+	it.Nil(err)
+	it.Equal([]string{
+		"a1b2c3d4e5f6:NULL",
+		"c7e1a09f4b2d:a1b2c3d4e5f6",
+		"5b9d3e1c0a7f:c7e1a09f4b2d",
+		"8e2f6a4d1c3b:5b9d3e1c0a7f",
+		"0f3a7c9e2d5b:8e2f6a4d1c3b",
+	}, compactAll(rebased))
+	it.Nil(golembic.ValidateLinear(rebased))
+	// The input is not modified.
+	it.Equal("c7e1a09f4b2d", ms[4].Previous)
+
+	rebased, err = golembic.Rebase(ms, "8e2f6a4d1c3b")
+	it.Nil(err)
+	it.Equal([]string{
+		"a1b2c3d4e5f6:NULL",
+		"c7e1a09f4b2d:a1b2c3d4e5f6",
+		"0f3a7c9e2d5b:c7e1a09f4b2d",
+		"5b9d3e1c0a7f:0f3a7c9e2d5b",
+		"8e2f6a4d1c3b:5b9d3e1c0a7f",
+	}, compactAll(rebased))
+
+	// Not on either branch
+	_, err = golembic.Rebase(ms, "a1b2c3d4e5f6")
+	it.Equal(`Cannot rebase migration sequence; Revision "a1b2c3d4e5f6" is not on either branch`, fmt.Sprintf("%v", err))
+
+	// Not branched
+	_, err = golembic.Rebase(ms[:3], "5b9d3e1c0a7f")
+	it.Equal(`Cannot rebase migration sequence; Expected exactly two branches after revision "5b9d3e1c0a7f", found 0`, fmt.Sprintf("%v", err))
+
+	// No root
+	_, err = golembic.Rebase(ms[1:], "5b9d3e1c0a7f")
+	it.Equal("Cannot rebase migration sequence; Expected exactly one root migration, found 0", fmt.Sprintf("%v", err))
+}
+
+func TestRebaseDirectory(t *testing.T) {
+	it := assert.New(t)
+
+	dir := t.TempDir()
+	for i, migration := range branchedMigrations() {
+		s, err := golembic.NewScaffold(
+			nil,
+			golembic.OptScaffoldRevision(migration.Revision),
+			golembic.OptScaffoldDescription(migration.Description),
+		)
+		it.Nil(err)
+		s.Previous = migration.Previous
+		s.Index = i + 1
+		contents := append(s.Contents(), []byte("SELECT 1;\n")...)
+		err = os.WriteFile(filepath.Join(dir, s.Filename()), contents, 0644)
+		it.Nil(err)
+	}
+
+	_, err := golembic.LoadSequence(os.DirFS(dir), ".")
+	expected := `Migration sequence has multiple heads; Previous: "c7e1a09f4b2d", Branches: "5b9d3e1c0a7f -> 8e2f6a4d1c3b", "0f3a7c9e2d5b"`
+	it.Equal(expected, fmt.Sprintf("%v", err))
+
+	filename, err := golembic.RebaseDirectory(dir, "0f3a7c9e2d5b")
+	it.Nil(err)
+	it.Equal(filepath.Join(dir, "0005_fourth.sql"), filename)
+	contents, err := os.ReadFile(filename)
+	it.Nil(err)
+	it.Equal("-- revision: 0f3a7c9e2d5b\n-- previous: 8e2f6a4d1c3b\n-- description: Fourth\n\nSELECT 1;\n", string(contents))
+
+	migrations, err := golembic.LoadSequence(os.DirFS(dir), ".")
+	it.Nil(err)
+	it.Equal([]string{"a1b2c3d4e5f6", "c7e1a09f4b2d", "5b9d3e1c0a7f", "8e2f6a4d1c3b", "0f3a7c9e2d5b"}, migrations.Revisions())
+}
+
+// branchedMigrations returns a collection of migrations that branches after
+// the second migration.
+func branchedMigrations() []golembic.Migration {
+	return []golembic.Migration{
+		{Revision: "a1b2c3d4e5f6", Description: "First"},
+		{Previous: "a1b2c3d4e5f6", Revision: "c7e1a09f4b2d", Description: "Second"},
+		{Previous: "c7e1a09f4b2d", Revision: "5b9d3e1c0a7f", Description: "Third"},
+		{Previous: "5b9d3e1c0a7f", Revision: "8e2f6a4d1c3b", Description: "Third (continued)"},
+		{Previous: "c7e1a09f4b2d", Revision: "0f3a7c9e2d5b", Description: "Fourth"},
+	}
+}
+
+func compactAll(ms []golembic.Migration) []string {
+	result := make([]string, len(ms))
+	for i, migration := range ms {
+		result[i] = migration.Compact()
+	}
+	return result
+}
@@ -0,0 +1,592 @@
+package golembic
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/blend/go-sdk/db"
+	"github.com/blend/go-sdk/db/migration"
+	"github.com/blend/go-sdk/env"
+	"github.com/blend/go-sdk/ex"
+	"github.com/blend/go-sdk/logger"
+	"github.com/spf13/cobra"
+)
+
+// ManagerFactory creates the manager used by a command. It is invoked
+// after flags have been parsed, so it may depend on flag values.
+type ManagerFactory = func() (*Manager, error)
+
+// PoolFactory creates an open connection pool used by a command.
+type PoolFactory = func(context.Context) (*db.Connection, error)
+
+// NewCommand creates a cobra command with subcommands for managing the
+// migrations of a single manager:
+//
+// - `up`: apply migrations (optionally through a target, stopping at a
+//   milestone or as a dry run)
+// - `plan`: list the migrations that would be applied
+// - `history`: list the migrations that have been applied
+// - `current`: show the latest applied migration
+// - `verify`: verify the applied history against the registered sequence
+// - `stamp`: record migrations as applied without running them
+// - `clear-in-progress`: remove the in progress marker left by an earlier
+//   attempt to apply a non-transactional migration
+// - `describe`: list the registered migrations (no database required)
+// - `revision`: create a new SQL migration file at the end of the sequence
+//   in a directory (no database required)
+// - `rebase`: linearize a branched sequence of SQL migration files in a
+//   directory (no database required)
+//
+// If `poolFactory` is `nil`, `PoolFromEnv(db.Config{})` is used so the
+// connection configuration is resolved from environment variables such as
+// `DB_HOST` and `DATABASE_URL`. If the manager does not have a logger, events
+// are written to the output of the command.
+func NewCommand(managerFactory ManagerFactory, poolFactory PoolFactory) *cobra.Command {
+	if poolFactory == nil {
+		poolFactory = PoolFromEnv(db.Config{})
+	}
+
+	cc := &commandContext{managerFactory: managerFactory, poolFactory: poolFactory}
+	cmd := &cobra.Command{
+		Use:           "golembic",
+		Short:         "Manage database migrations via golembic",
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+
+	cmd.PersistentFlags().BoolVar(
+		&cc.verifyHistory,
+		"verify-history",
+		false,
+		"If set, verify that all of the migration history matches the registered migrations",
+	)
+	cmd.AddCommand(cc.upCommand())
+	cmd.AddCommand(cc.planCommand())
+	cmd.AddCommand(cc.historyCommand())
+	cmd.AddCommand(cc.currentCommand())
+	cmd.AddCommand(cc.verifyCommand())
+	cmd.AddCommand(cc.stampCommand())
+	cmd.AddCommand(cc.clearInProgressCommand())
+	cmd.AddCommand(cc.describeCommand())
+	cmd.AddCommand(cc.revisionCommand())
+	cmd.AddCommand(cc.rebaseCommand())
+
+	return cmd
+}
+
+// PoolFromEnv returns a pool factory that starts from `defaults` and resolves
+// overrides from environment variables (via `db.Config.Resolve()`), then
+// opens the pool and verifies the database can be reached.
+func PoolFromEnv(defaults db.Config) PoolFactory {
+	return func(ctx context.Context) (*db.Connection, error) {
+		cfg := defaults
+		err := (&cfg).Resolve(env.WithVars(ctx, env.Env()))
+		if err != nil {
+			return nil, err
+		}
+
+		pool, err := db.New(db.OptConfig(cfg))
+		if err != nil {
+			return nil, err
+		}
+
+		err = pool.Open()
+		if err != nil {
+			return nil, err
+		}
+
+		err = pool.Connection.PingContext(ctx)
+		if err != nil {
+			_ = pool.Close()
+			return nil, err
+		}
+
+		return pool, nil
+	}
+}
+
+// commandContext holds the factories and shared flags for the subcommands
+// created by `NewCommand()`.
+type commandContext struct {
+	managerFactory ManagerFactory
+	poolFactory    PoolFactory
+	verifyHistory  bool
+}
+
+// manager creates a manager via the factory and applies the shared flags.
+func (cc *commandContext) manager(cmd *cobra.Command) (*Manager, error) {
+	m, err := cc.managerFactory()
+	if err != nil {
+		return nil, err
+	}
+
+	if cc.verifyHistory {
+		m.VerifyHistory = true
+	}
+	if m.Log == nil {
+		m.Log = logger.All(logger.OptOutput(cmd.OutOrStdout()))
+	}
+	return m, nil
+}
+
+// run creates a manager and a pool and invokes `f`; the pool is closed once
+// `f` is done.
+func (cc *commandContext) run(cmd *cobra.Command, f func(context.Context, *Manager, *db.Connection) error) (err error) {
+	m, err := cc.manager(cmd)
+	if err != nil {
+		return
+	}
+
+	ctx := commandContextOrBackground(cmd)
+	pool, err := cc.poolFactory(ctx)
+	if err != nil {
+		return
+	}
+	defer func() {
+		closeErr := pool.Close()
+		if err == nil {
+			err = closeErr
+		}
+	}()
+
+	err = f(ctx, m, pool)
+	return
+}
+
+func (cc *commandContext) upCommand() *cobra.Command {
+	target := ""
+	stopAtMilestone := false
+	dryRun := false
+	singleTransaction := false
+	reportPath := ""
+	cmd := &cobra.Command{
+		Use:   "up",
+		Short: "Apply migrations",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return cc.run(cmd, func(ctx context.Context, m *Manager, pool *db.Connection) error {
+				if dryRun {
+					m.DryRun = true
+				}
+				if singleTransaction {
+					m.SingleTransaction = true
+				}
+				suite, err := GenerateSuite(m, applyOpts(target, stopAtMilestone)...)
+				if err != nil {
+					return err
+				}
+
+				suite.Log = m.Log
+				report, err := ApplyDynamic(ctx, suite, pool)
+				if reportPath == "" {
+					return err
+				}
+
+				writeErr := writeReport(reportPath, report)
+				if err != nil {
+					return err
+				}
+				return writeErr
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(
+		&target,
+		"target",
+		"",
+		"The revision to apply migrations through; if not set, all migrations will be applied",
+	)
+	cmd.Flags().BoolVar(
+		&stopAtMilestone,
+		"stop-at-milestone",
+		false,
+		"If set, stop at the first pending milestone rather than failing when it is not the last migration",
+	)
+	cmd.Flags().BoolVar(
+		&dryRun,
+		"dry-run",
+		false,
+		"If set, print the statements that would be executed rather than applying migrations",
+	)
+	cmd.Flags().BoolVar(
+		&singleTransaction,
+		"single-transaction",
+		false,
+		"If set, apply all migrations in a single transaction so that either all or none are committed",
+	)
+	cmd.Flags().StringVar(
+		&reportPath,
+		"report",
+		"",
+		"If set, write a JSON report of the run to this path (even if the run fails)",
+	)
+
+	return cmd
+}
+
+func (cc *commandContext) planCommand() *cobra.Command {
+	target := ""
+	stopAtMilestone := false
+	cmd := &cobra.Command{
+		Use:   "plan",
+		Short: "List the migrations that would be applied",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return cc.run(cmd, func(ctx context.Context, m *Manager, pool *db.Connection) error {
+				opts := append([]ApplyOption{OptApplyVerifyHistory(m.VerifyHistory)}, applyOpts(target, stopAtMilestone)...)
+				migrations, err := m.planDryRun(ctx, pool, nil, opts...)
+				if err != nil {
+					return err
+				}
+				repeatables := []Migration{}
+				reachesEnd, err := m.planReachesEnd(migrations, opts...)
+				if err != nil {
+					return err
+				}
+				if reachesEnd {
+					repeatables, err = m.planRepeatableDryRun(ctx, pool, nil)
+					if err != nil {
+						return err
+					}
+				}
+
+				w := cmd.OutOrStdout()
+				if len(migrations) == 0 && len(repeatables) == 0 {
+					fmt.Fprintln(w, "No migrations to run")
+					return nil
+				}
+				for _, mi := range migrations {
+					fmt.Fprintf(w, "%s: %s\n", mi.Revision, mi.ExtendedDescription())
+				}
+				for _, mi := range repeatables {
+					fmt.Fprintf(w, "%s: %s [REPEATABLE]\n", mi.Revision, mi.ExtendedDescription())
+				}
+				return nil
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(
+		&target,
+		"target",
+		"",
+		"The revision to plan migrations through; if not set, all migrations will be planned",
+	)
+	cmd.Flags().BoolVar(
+		&stopAtMilestone,
+		"stop-at-milestone",
+		false,
+		"If set, stop at the first pending milestone rather than failing when it is not the last migration",
+	)
+
+	return cmd
+}
+
+func (cc *commandContext) historyCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "history",
+		Short: "List the migrations that have been applied",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return cc.run(cmd, func(ctx context.Context, m *Manager, pool *db.Connection) error {
+				history, err := m.History(ctx, pool)
+				if err != nil {
+					return err
+				}
+
+				return writeHistory(cmd.OutOrStdout(), history)
+			})
+		},
+	}
+}
+
+func (cc *commandContext) currentCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "current",
+		Short: "Show the latest applied migration",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return cc.run(cmd, func(ctx context.Context, m *Manager, pool *db.Connection) error {
+				history, err := m.History(ctx, pool)
+				if err != nil {
+					return err
+				}
+
+				w := cmd.OutOrStdout()
+				if len(history) == 0 {
+					fmt.Fprintln(w, "No migrations have been applied")
+					return nil
+				}
+
+				latest := history[len(history)-1]
+				fmt.Fprintf(w, "%s (applied %s)\n", latest.Revision, latest.CreatedAt.Format(timeFormat))
+				return nil
+			})
+		},
+	}
+}
+
+func (cc *commandContext) verifyCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "verify",
+		Short: "Verify that the migration history matches the registered migrations",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return cc.run(cmd, func(ctx context.Context, m *Manager, pool *db.Connection) error {
+				exists, err := migration.PredicateTableExistsInSchema(ctx, pool, nil, m.metadataSchema(pool), m.MetadataTable)
+				if err != nil {
+					return err
+				}
+
+				applied := 0
+				if exists {
+					history, _, err := m.verifyHistory(ctx, pool, nil)
+					if err != nil {
+						return err
+					}
+					applied = len(history)
+				}
+
+				// NOTE: The pending migrations are planned (rather than counted
+				//       from the sequence) so that a baseline is respected.
+				pending, err := m.planDryRun(ctx, pool, nil)
+				if err != nil {
+					return err
+				}
+				fmt.Fprintf(cmd.OutOrStdout(), "History verified; %d applied, %d pending\n", applied, len(pending))
+				return nil
+			})
+		},
+	}
+}
+
+func (cc *commandContext) stampCommand() *cobra.Command {
+	revision := ""
+	cmd := &cobra.Command{
+		Use:   "stamp",
+		Short: "Record migrations as applied without running them",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return cc.run(cmd, func(ctx context.Context, m *Manager, pool *db.Connection) error {
+				return m.Stamp(ctx, pool, revision)
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(
+		&revision,
+		"revision",
+		"",
+		"The revision to stamp; all migrations through this revision will be recorded as applied",
+	)
+	_ = cmd.MarkFlagRequired("revision")
+
+	return cmd
+}
+
+func (cc *commandContext) clearInProgressCommand() *cobra.Command {
+	revision := ""
+	cmd := &cobra.Command{
+		Use:   "clear-in-progress",
+		Short: "Remove the in progress marker left by an earlier attempt to apply a non-transactional migration",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			return cc.run(cmd, func(ctx context.Context, m *Manager, pool *db.Connection) error {
+				return m.ClearInProgress(ctx, pool, revision)
+			})
+		},
+	}
+
+	cmd.Flags().StringVar(
+		&revision,
+		"revision",
+		"",
+		"The revision of the migration marked as in progress",
+	)
+	_ = cmd.MarkFlagRequired("revision")
+
+	return cmd
+}
+
+func (cc *commandContext) describeCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "describe",
+		Short: "List the registered migrations",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			m, err := cc.manager(cmd)
+			if err != nil {
+				return err
+			}
+
+			return writeSequence(cmd.OutOrStdout(), m.Sequence)
+		},
+	}
+}
+
+func (cc *commandContext) revisionCommand() *cobra.Command {
+	dir := ""
+	description := ""
+	milestone := false
+	transactional := true
+	cmd := &cobra.Command{
+		Use:   "revision",
+		Short: "Create a new SQL migration file at the end of the sequence",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			migrations, err := LoadSequence(os.DirFS(dir), ".")
+			if ex.Is(err, ErrNoMigrations) {
+				migrations, err = nil, nil
+			}
+			if err != nil {
+				return err
+			}
+
+			filename, s, err := WriteScaffold(
+				dir,
+				migrations,
+				OptScaffoldDescription(description),
+				OptScaffoldMilestone(milestone),
+				OptScaffoldTransactional(transactional),
+			)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Created %s (revision %s)\n", filename, s.Revision)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(
+		&dir,
+		"dir",
+		".",
+		"The directory containing SQL migration files",
+	)
+	cmd.Flags().StringVar(
+		&description,
+		"description",
+		"",
+		"The description of the new migration",
+	)
+	cmd.Flags().BoolVar(
+		&milestone,
+		"milestone",
+		false,
+		"If set, mark the new migration as a milestone",
+	)
+	cmd.Flags().BoolVar(
+		&transactional,
+		"transactional",
+		true,
+		"If set, the new migration will run in a transaction; set to false for statements like CREATE INDEX CONCURRENTLY",
+	)
+
+	return cmd
+}
+
+func (cc *commandContext) rebaseCommand() *cobra.Command {
+	dir := ""
+	branch := ""
+	cmd := &cobra.Command{
+		Use:   "rebase",
+		Short: "Linearize a branched sequence of SQL migration files",
+		RunE: func(cmd *cobra.Command, _ []string) error {
+			filename, err := RebaseDirectory(dir, branch)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Rebased branch containing %s; updated %s\n", branch, filename)
+			return nil
+		},
+	}
+
+	cmd.Flags().StringVar(
+		&dir,
+		"dir",
+		".",
+		"The directory containing SQL migration files",
+	)
+	cmd.Flags().StringVar(
+		&branch,
+		"branch",
+		"",
+		"A revision on the branch that should be moved after the other branch",
+	)
+	_ = cmd.MarkFlagRequired("branch")
+
+	return cmd
+}
+
+const (
+	// timeFormat is the format used for timestamps in command output.
+	timeFormat = "2006-01-02T15:04:05Z07:00"
+)
+
+// writeHistory writes the applied migrations as a table.
+func writeHistory(w io.Writer, history []HistoryEntry) error {
+	if len(history) == 0 {
+		_, err := fmt.Fprintln(w, "No migrations have been applied")
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "SERIAL ID\tREVISION\tPREVIOUS\tCREATED AT\tDESCRIPTION")
+	for _, entry := range history {
+		description := entry.Description
+		if entry.Milestone {
+			description += milestoneSuffix
+		}
+		if !entry.Known {
+			description = strings.TrimSpace("[UNKNOWN] " + entry.Description)
+		}
+		fmt.Fprintf(
+			tw,
+			"%d\t%s\t%s\t%s\t%s\n",
+			entry.SerialID,
+			entry.Revision,
+			entry.Previous,
+			entry.CreatedAt.Format(timeFormat),
+			description,
+		)
+	}
+	return tw.Flush()
+}
+
+// writeSequence writes the registered migrations (including repeatable
+// migrations) as a table.
+func writeSequence(w io.Writer, migrations *Migrations) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "REVISION\tPREVIOUS\tDESCRIPTION")
+	for _, mi := range migrations.All() {
+		description := mi.ExtendedDescription()
+		if mi.IsTombstone() {
+			description = "[TOMBSTONE]"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", mi.Revision, mi.Previous, description)
+	}
+	for _, mi := range migrations.Repeatables() {
+		fmt.Fprintf(tw, "%s\t\t%s [REPEATABLE]\n", mi.Revision, mi.ExtendedDescription())
+	}
+	return tw.Flush()
+}
+
+// applyOpts converts the values of the `--target` and `--stop-at-milestone`
+// flags into apply options.
+func applyOpts(target string, stopAtMilestone bool) []ApplyOption {
+	opts := []ApplyOption{}
+	if target != "" {
+		opts = append(opts, OptApplyTarget(target))
+	}
+	if stopAtMilestone {
+		opts = append(opts, OptApplyStopAtMilestone(true))
+	}
+	return opts
+}
+
+// commandContextOrBackground returns the context for a command, falling back
+// to `context.Background()` if the command was not executed with one.
+func commandContextOrBackground(cmd *cobra.Command) context.Context {
+	if ctx := cmd.Context(); ctx != nil {
+		return ctx
+	}
+	return context.Background()
+}
@@ -0,0 +1,338 @@
+package golembic_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/db"
+	"github.com/blend/go-sdk/logger"
+
+	golembic "github.com/dhermes/golembic-blend"
+)
+
+func TestNewCommand_Describe(t *testing.T) {
+	it := assert.New(t)
+
+	managerFactory := func() (*golembic.Manager, error) {
+		migrations, err := makeSequence("flob1", "flob2", 3, true)
+		if err != nil {
+			return nil, err
+		}
+		return golembic.NewManager(golembic.OptManagerSequence(migrations))
+	}
+	poolFactory := func(_ context.Context) (*db.Connection, error) {
+		return nil, fmt.Errorf("describe should not connect to the database")
+	}
+
+	cmd := golembic.NewCommand(managerFactory, poolFactory)
+	names := []string{}
+	for _, sub := range cmd.Commands() {
+		names = append(names, sub.Name())
+	}
+	it.Equal([]string{"clear-in-progress", "current", "describe", "history", "plan", "rebase", "revision", "stamp", "up", "verify"}, names)
+
+	var output bytes.Buffer
+	cmd.SetOut(&output)
+	cmd.SetArgs([]string{"describe"})
+	err := cmd.Execute()
+	it.Nil(err)
+	expected := strings.Join([]string{
+		"REVISION      PREVIOUS      DESCRIPTION",
+		"aa60f058f5f5                Create first table",
+		"ab1208989a3f  aa60f058f5f5  Alter first table [MILESTONE]",
+		"60a33b9d4c77  ab1208989a3f  Add second table",
+		"",
+	}, "\n")
+	it.Equal(expected, output.String())
+
+	// Stamp requires a revision
+	cmd = golembic.NewCommand(managerFactory, poolFactory)
+	cmd.SetOut(&output)
+	cmd.SetErr(&output)
+	cmd.SetArgs([]string{"stamp"})
+	err = cmd.Execute()
+	it.Equal(`required flag(s) "revision" not set`, fmt.Sprintf("%v", err))
+}
+
+func TestNewCommand_Revision(t *testing.T) {
+	it := assert.New(t)
+
+	dir := t.TempDir()
+	execute := func(args ...string) (string, error) {
+		var output bytes.Buffer
+		cmd := golembic.NewCommand(nil, nil)
+		cmd.SetOut(&output)
+		cmd.SetArgs(args)
+		err := cmd.Execute()
+		return output.String(), err
+	}
+	created := regexp.MustCompile(`^Created (.+) \(revision ([0-9a-f]+)\)\n$`)
+
+	output, err := execute("revision", "--dir", dir, "--description", "Create songs table", "--milestone")
+	it.Nil(err)
+	match := created.FindStringSubmatch(output)
+	it.Len(match, 3)
+	it.Equal(filepath.Join(dir, "0001_create_songs_table.sql"), match[1])
+	root := match[2]
+
+	output, err = execute("revision", "--dir", dir, "--description", "Index songs", "--transactional=false")
+	it.Nil(err)
+	match = created.FindStringSubmatch(output)
+	it.Len(match, 3)
+	it.Equal(filepath.Join(dir, "0002_index_songs.sql"), match[1])
+	second := match[2]
+
+	migrations, err := golembic.LoadSequence(os.DirFS(dir), ".")
+	it.Nil(err)
+	it.Equal([]string{root, second}, migrations.Revisions())
+	it.True(migrations.Get(root).Milestone)
+	it.Equal(root, migrations.Get(second).Previous)
+	it.NotNil(migrations.Get(second).UpConn)
+}
+
+func TestNewCommand_Rebase(t *testing.T) {
+	it := assert.New(t)
+
+	dir := t.TempDir()
+	for i, migration := range branchedMigrations() {
+		s, err := golembic.NewScaffold(
+			nil,
+			golembic.OptScaffoldRevision(migration.Revision),
+			golembic.OptScaffoldDescription(migration.Description),
+		)
+		it.Nil(err)
+		s.Previous = migration.Previous
+		s.Index = i + 1
+		contents := append(s.Contents(), []byte("SELECT 1;\n")...)
+		err = os.WriteFile(filepath.Join(dir, s.Filename()), contents, 0644)
+		it.Nil(err)
+	}
+
+	execute := func(args ...string) (string, error) {
+		var output bytes.Buffer
+		cmd := golembic.NewCommand(nil, nil)
+		cmd.SetOut(&output)
+		cmd.SetArgs(args)
+		err := cmd.Execute()
+		return output.String(), err
+	}
+
+	// Rebase requires a branch
+	_, err := execute("rebase", "--dir", dir)
+	it.Equal(`required flag(s) "branch" not set`, fmt.Sprintf("%v", err))
+
+	output, err := execute("rebase", "--dir", dir, "--branch", "0f3a7c9e2d5b")
+	it.Nil(err)
+	it.Equal(fmt.Sprintf("Rebased branch containing 0f3a7c9e2d5b; updated %s\n", filepath.Join(dir, "0005_fourth.sql")), output)
+
+	migrations, err := golembic.LoadSequence(os.DirFS(dir), ".")
+	it.Nil(err)
+	it.Equal([]string{"a1b2c3d4e5f6", "c7e1a09f4b2d", "5b9d3e1c0a7f", "8e2f6a4d1c3b", "0f3a7c9e2d5b"}, migrations.Revisions())
+}
+
+func TestNewCommand(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt := fmt.Sprintf("flob_%s_migrations", suffix)
+	t1 := fmt.Sprintf("flob1_%s", suffix)
+	t2 := fmt.Sprintf("flob2_%s", suffix)
+	t.Cleanup(func() {
+		for _, table := range []string{mt, t1, t2} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+	})
+
+	var logBuffer bytes.Buffer
+	managerFactory := func() (*golembic.Manager, error) {
+		migrations, err := makeSequence(t1, t2, 3, false)
+		if err != nil {
+			return nil, err
+		}
+		return golembic.NewManager(
+			golembic.OptManagerSequence(migrations),
+			golembic.OptManagerMetadataTable(mt),
+			golembic.OptManagerLog(logger.Memory(&logBuffer)),
+		)
+	}
+	poolFactory := golembic.PoolFromEnv(configDefaults())
+
+	execute := func(args ...string) (string, error) {
+		var output bytes.Buffer
+		cmd := golembic.NewCommand(managerFactory, poolFactory)
+		cmd.SetOut(&output)
+		cmd.SetArgs(args)
+		err := cmd.Execute()
+		return output.String(), err
+	}
+
+	output, err := execute("current")
+	it.Nil(err)
+	it.Equal("No migrations have been applied\n", output)
+
+	output, err = execute("plan", "--target", "ab1208989a3f")
+	it.Nil(err)
+	it.Equal("aa60f058f5f5: Create first table\nab1208989a3f: Alter first table\n", output)
+
+	output, err = execute("up", "--target", "ab1208989a3f")
+	it.Nil(err)
+	it.Equal("", output)
+
+	output, err = execute("verify")
+	it.Nil(err)
+	it.Equal("History verified; 2 applied, 1 pending\n", output)
+
+	output, err = execute("current")
+	it.Nil(err)
+	it.True(strings.HasPrefix(output, "ab1208989a3f (applied "))
+
+	output, err = execute("history")
+	it.Nil(err)
+	lines := strings.Split(output, "\n")
+	it.Len(lines, 4)
+	it.True(strings.HasPrefix(lines[0], "SERIAL ID  REVISION      PREVIOUS      CREATED AT"))
+	it.True(strings.HasPrefix(lines[1], "0          aa60f058f5f5                "))
+	it.True(strings.HasSuffix(lines[1], "  Create first table"))
+	it.True(strings.HasPrefix(lines[2], "1          ab1208989a3f  aa60f058f5f5  "))
+	it.True(strings.HasSuffix(lines[2], "  Alter first table"))
+	it.Equal("", lines[3])
+
+	output, err = execute("stamp", "--revision", "60a33b9d4c77")
+	it.Nil(err)
+	it.Equal("", output)
+
+	output, err = execute("plan")
+	it.Nil(err)
+	it.Equal("No migrations to run\n", output)
+}
+
+func TestNewCommand_LegacyTable(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt := fmt.Sprintf("yam_%s_migrations", suffix)
+	t1 := fmt.Sprintf("yam1_%s", suffix)
+	t2 := fmt.Sprintf("yam2_%s", suffix)
+	t.Cleanup(func() {
+		for _, table := range []string{mt, t1, t2} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+	})
+
+	var logBuffer bytes.Buffer
+	managerFactory := func() (*golembic.Manager, error) {
+		migrations, err := makeSequence(t1, t2, 3, false)
+		if err != nil {
+			return nil, err
+		}
+		return golembic.NewManager(
+			golembic.OptManagerSequence(migrations),
+			golembic.OptManagerMetadataTable(mt),
+			golembic.OptManagerLog(logger.Memory(&logBuffer)),
+		)
+	}
+	poolFactory := golembic.PoolFromEnv(configDefaults())
+
+	execute := func(args ...string) (string, error) {
+		var output bytes.Buffer
+		cmd := golembic.NewCommand(managerFactory, poolFactory)
+		cmd.SetOut(&output)
+		cmd.SetArgs(args)
+		err := cmd.Execute()
+		return output.String(), err
+	}
+
+	// Apply the root migration, then make the table look like one at schema
+	// version 1 (i.e. without a `checksum` column)
+	_, err := execute("up", "--target", "aa60f058f5f5")
+	it.Nil(err)
+	qmt := golembic.QuoteIdentifier(mt)
+	statements := []string{
+		fmt.Sprintf("ALTER TABLE %s DROP COLUMN checksum, DROP COLUMN description, DROP COLUMN duration_ms, DROP COLUMN applied_by, DROP COLUMN hostname, DROP COLUMN app_version", qmt),
+		fmt.Sprintf("COMMENT ON TABLE %s IS NULL", qmt),
+	}
+	for _, statement := range statements {
+		_, err = pool.Invoke(db.OptContext(ctx)).Exec(statement)
+		it.Nil(err)
+	}
+
+	output, err := execute("--verify-history", "plan")
+	it.Nil(err)
+	it.Equal("ab1208989a3f: Alter first table\n60a33b9d4c77: Add second table\n", output)
+
+	output, err = execute("history")
+	it.Nil(err)
+	lines := strings.Split(output, "\n")
+	it.Len(lines, 3)
+	it.True(strings.HasPrefix(lines[1], "0          aa60f058f5f5                "))
+	it.True(strings.HasSuffix(lines[1], "  Create first table"))
+}
+
+func TestNewCommand_Baseline(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt := fmt.Sprintf("okra_%s_migrations", suffix)
+	t1 := fmt.Sprintf("okra1_%s", suffix)
+	t2 := fmt.Sprintf("okra2_%s", suffix)
+	t.Cleanup(func() {
+		for _, table := range []string{mt, t1, t2} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+	})
+
+	var logBuffer bytes.Buffer
+	managerFactory := func() (*golembic.Manager, error) {
+		migrations, err := makeSquashedSequence(t1, t2)
+		if err != nil {
+			return nil, err
+		}
+		return golembic.NewManager(
+			golembic.OptManagerSequence(migrations),
+			golembic.OptManagerMetadataTable(mt),
+			golembic.OptManagerLog(logger.Memory(&logBuffer)),
+		)
+	}
+	poolFactory := golembic.PoolFromEnv(configDefaults())
+
+	execute := func(args ...string) (string, error) {
+		var output bytes.Buffer
+		cmd := golembic.NewCommand(managerFactory, poolFactory)
+		cmd.SetOut(&output)
+		cmd.SetArgs(args)
+		err := cmd.Execute()
+		return output.String(), err
+	}
+
+	// On a fresh database, the tombstone before the baseline is not pending
+	output, err := execute("verify")
+	it.Nil(err)
+	it.Equal("History verified; 0 applied, 2 pending\n", output)
+
+	output, err = execute("up", "--target", "ab1208989a3f")
+	it.Nil(err)
+	it.Equal("", output)
+
+	output, err = execute("verify")
+	it.Nil(err)
+	it.Equal("History verified; 1 applied, 1 pending\n", output)
+}
@@ -0,0 +1,216 @@
+package golembic
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/blend/go-sdk/db"
+	"github.com/blend/go-sdk/db/migration"
+	"github.com/blend/go-sdk/ex"
+	"github.com/blend/go-sdk/logger"
+)
+
+// NOTE: Ensure that
+//       * `sequenceAction` satisfies `migration.Action`.
+//       * `resetStatsAction` satisfies `migration.Action`.
+var (
+	_ migration.Action = (*sequenceAction)(nil)
+	_ migration.Action = (*resetStatsAction)(nil)
+)
+
+// NamedSequence is a migration sequence (via a manager) that is run by a
+// coordinator. The name is used to label plan events for the sequence.
+type NamedSequence struct {
+	// Name identifies the sequence, e.g. the module that owns the schema.
+	Name string
+	// Manager orchestrates the migrations in the sequence; each manager must
+	// have its own metadata table.
+	Manager *Manager
+	// After is the list of names of the sequences that must be run before
+	// this one.
+	After []string
+}
+
+// SequenceStats contains the number of actions applied, skipped or failed
+// when running a single named sequence.
+type SequenceStats struct {
+	Name    string `json:"name"`
+	Applied int    `json:"applied"`
+	Skipped int    `json:"skipped"`
+	Failed  int    `json:"failed"`
+	Total   int    `json:"total"`
+}
+
+// Coordinator orchestrates several independent migration sequences, e.g.
+// each owning a different schema, that share a single database. The
+// sequences are run in the order they were declared and a failure in one
+// sequence will prevent the later sequences from running.
+type Coordinator struct {
+	// Sequences is the list of named sequences, in the order they will be
+	// run.
+	Sequences []NamedSequence
+	// Log is used for printing output
+	Log logger.Log
+
+	stats []SequenceStats
+	lock  sync.Mutex
+}
+
+// NewCoordinator creates a new coordinator for running multiple sequences.
+func NewCoordinator(opts ...CoordinatorOption) (*Coordinator, error) {
+	c := &Coordinator{}
+	for _, opt := range opts {
+		err := opt(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// Register adds a named sequence to the coordinator. The sequence name and
+// the metadata table must not be used by any sequence already registered and
+// every sequence in `After` must already be registered.
+func (c *Coordinator) Register(ns NamedSequence) error {
+	if ns.Name == "" {
+		return ex.New(ErrInvalidSequence, ex.OptMessage("A named sequence must have a name"))
+	}
+	if ns.Manager == nil || ns.Manager.Sequence == nil {
+		return ex.New(ErrInvalidSequence, ex.OptMessagef("Name: %q, missing manager or sequence", ns.Name))
+	}
+
+	registered := map[string]bool{}
+	for _, existing := range c.Sequences {
+		if existing.Name == ns.Name {
+			return ex.New(ErrInvalidSequence, ex.OptMessagef("Name: %q, already registered", ns.Name))
+		}
+		if existing.Manager.metadataTableKey() == ns.Manager.metadataTableKey() {
+			err := ex.New(
+				ErrInvalidSequence,
+				ex.OptMessagef("Name: %q, metadata table %q is already used by %q", ns.Name, ns.Manager.qualifiedName(ns.Manager.MetadataTable), existing.Name),
+			)
+			return err
+		}
+		registered[existing.Name] = true
+	}
+
+	for _, name := range ns.After {
+		if !registered[name] {
+			err := ex.New(
+				ErrInvalidSequence,
+				ex.OptMessagef("Name: %q, must come after %q which has not been registered", ns.Name, name),
+			)
+			return err
+		}
+	}
+
+	c.Sequences = append(c.Sequences, ns)
+	return nil
+}
+
+// Stats returns the stats for each of the sequences run during the most
+// recent application of a suite generated by `GenerateCoordinatorSuite()`.
+// Sequences that were not run (e.g. due to a failure in an earlier sequence)
+// are not included.
+func (c *Coordinator) Stats() []SequenceStats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	result := make([]SequenceStats, len(c.stats))
+	copy(result, c.stats)
+	return result
+}
+
+// resetStats clears the stats from an earlier run.
+func (c *Coordinator) resetStats() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.stats = nil
+}
+
+// appendStats adds the stats for a sequence that was just run.
+func (c *Coordinator) appendStats(stats SequenceStats) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.stats = append(c.stats, stats)
+}
+
+// GenerateCoordinatorSuite generates a single suite that runs each of the
+// sequences in a coordinator, in order. Each sequence runs as a nested suite
+// (see `GenerateSuite()`) with the sequence name as a label and the stats for
+// each nested suite are added to the stats of the returned suite. The stats
+// returned by `Stats()` are reset when the suite starts being applied.
+func GenerateCoordinatorSuite(c *Coordinator) (*migration.Suite, error) {
+	groups := []*migration.Group{
+		migration.NewGroup(
+			migration.OptGroupActions(&resetStatsAction{c: c}),
+			migration.OptGroupSkipTransaction(),
+		),
+	}
+	for _, ns := range c.Sequences {
+		groups = append(groups, migration.NewGroup(
+			migration.OptGroupActions(&sequenceAction{c: c, Sequence: ns}),
+			migration.OptGroupSkipTransaction(),
+		))
+	}
+
+	suite := migration.New(
+		migration.OptGroups(groups...),
+		migration.OptLog(c.Log),
+	)
+	return suite, nil
+}
+
+// resetStatsAction is the first action in a coordinator suite; it clears
+// the stats from any earlier run so that `Stats()` only describes the run in
+// progress.
+type resetStatsAction struct {
+	c *Coordinator
+}
+
+// Action resets the stats for the coordinator.
+func (rsa *resetStatsAction) Action(context.Context, *db.Connection, *sql.Tx) error {
+	rsa.c.resetStats()
+	return nil
+}
+
+// sequenceAction is a meta-action that runs the suite for a single named
+// sequence within a coordinator suite.
+type sequenceAction struct {
+	c        *Coordinator
+	Sequence NamedSequence
+}
+
+// Action generates and applies the suite for a named sequence.
+func (sa *sequenceAction) Action(ctx context.Context, pool *db.Connection, _ *sql.Tx) error {
+	suite, err := GenerateSuite(sa.Sequence.Manager)
+	if err != nil {
+		return err
+	}
+
+	ctx = migration.WithLabel(ctx, sa.Sequence.Name)
+	err = applyGroups(ctx, suite, pool)
+
+	stats := SequenceStats{
+		Name:    sa.Sequence.Name,
+		Applied: suite.Applied,
+		Skipped: suite.Skipped,
+		Failed:  suite.Failed,
+		Total:   suite.Total,
+	}
+	sa.c.appendStats(stats)
+	logger.MaybeTriggerContext(ctx, sa.Sequence.Manager.Log, SequenceStatsEvent{Labels: migration.GetContextLabels(ctx), Stats: stats})
+
+	if parent := migration.GetContextSuite(ctx); parent != nil {
+		parent.Applied += suite.Applied
+		parent.Skipped += suite.Skipped
+		parent.Failed += suite.Failed
+		parent.Total += suite.Total
+	}
+
+	return err
+}
@@ -0,0 +1,28 @@
+package golembic
+
+import (
+	"github.com/blend/go-sdk/ex"
+	"github.com/blend/go-sdk/logger"
+)
+
+// OptCoordinatorSequence registers a named sequence with a coordinator. The
+// sequence will be run after all of the sequences named in `after` (which
+// must already be registered).
+func OptCoordinatorSequence(name string, m *Manager, after ...string) CoordinatorOption {
+	return func(c *Coordinator) error {
+		return c.Register(NamedSequence{Name: name, Manager: m, After: after})
+	}
+}
+
+// OptCoordinatorLog sets the logger interface on a coordinator. If `log` is
+// `nil` the option will return an error.
+func OptCoordinatorLog(log logger.Log) CoordinatorOption {
+	return func(c *Coordinator) error {
+		if log == nil {
+			return ex.New(ErrNilInterface)
+		}
+
+		c.Log = log
+		return nil
+	}
+}
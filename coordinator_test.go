@@ -0,0 +1,188 @@
+package golembic_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/logger"
+
+	golembic "github.com/dhermes/golembic-blend"
+)
+
+func TestCoordinator_Register(t *testing.T) {
+	it := assert.New(t)
+
+	users, err := makeSequence("users1", "users2", 1, false)
+	it.Nil(err)
+	m1, err := golembic.NewManager(golembic.OptManagerSequence(users), golembic.OptManagerMetadataTable("users_migrations"))
+	it.Nil(err)
+	billing, err := makeSequence("billing1", "billing2", 1, false)
+	it.Nil(err)
+	m2, err := golembic.NewManager(golembic.OptManagerSequence(billing), golembic.OptManagerMetadataTable("billing_migrations"))
+	it.Nil(err)
+
+	// Dependency not yet registered
+	_, err = golembic.NewCoordinator(
+		golembic.OptCoordinatorSequence("billing", m2, "users"),
+		golembic.OptCoordinatorSequence("users", m1),
+	)
+	it.Equal(`Invalid named sequence; Name: "billing", must come after "users" which has not been registered`, fmt.Sprintf("%v", err))
+
+	// Duplicate name
+	_, err = golembic.NewCoordinator(
+		golembic.OptCoordinatorSequence("users", m1),
+		golembic.OptCoordinatorSequence("users", m2),
+	)
+	it.Equal(`Invalid named sequence; Name: "users", already registered`, fmt.Sprintf("%v", err))
+
+	// Shared metadata table
+	m3, err := golembic.NewManager(golembic.OptManagerSequence(billing))
+	it.Nil(err)
+	m4, err := golembic.NewManager(golembic.OptManagerSequence(users))
+	it.Nil(err)
+	_, err = golembic.NewCoordinator(
+		golembic.OptCoordinatorSequence("users", m3),
+		golembic.OptCoordinatorSequence("billing", m4),
+	)
+	it.Equal(`Invalid named sequence; Name: "billing", metadata table "golembic_migrations" is already used by "users"`, fmt.Sprintf("%v", err))
+
+	// Shared metadata table, with the default schema given explicitly
+	m5, err := golembic.NewManager(golembic.OptManagerSequence(users), golembic.OptManagerMetadataSchema("public"))
+	it.Nil(err)
+	_, err = golembic.NewCoordinator(
+		golembic.OptCoordinatorSequence("users", m3),
+		golembic.OptCoordinatorSequence("billing", m5),
+	)
+	it.Equal(`Invalid named sequence; Name: "billing", metadata table "public.golembic_migrations" is already used by "users"`, fmt.Sprintf("%v", err))
+
+	// Missing name or sequence
+	_, err = golembic.NewCoordinator(golembic.OptCoordinatorSequence("", m1))
+	it.Equal("Invalid named sequence; A named sequence must have a name", fmt.Sprintf("%v", err))
+	_, err = golembic.NewCoordinator(golembic.OptCoordinatorSequence("users", &golembic.Manager{}))
+	it.Equal(`Invalid named sequence; Name: "users", missing manager or sequence`, fmt.Sprintf("%v", err))
+
+	// Success
+	c, err := golembic.NewCoordinator(
+		golembic.OptCoordinatorSequence("users", m1),
+		golembic.OptCoordinatorSequence("billing", m2, "users"),
+	)
+	it.Nil(err)
+	it.Len(c.Sequences, 2)
+	it.Equal("users", c.Sequences[0].Name)
+	it.Equal("billing", c.Sequences[1].Name)
+	it.Equal([]string{"users"}, c.Sequences[1].After)
+}
+
+func TestGenerateCoordinatorSuite(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt1 := fmt.Sprintf("fred_%s_migrations", suffix)
+	mt2 := fmt.Sprintf("plugh_%s_migrations", suffix)
+	t1 := fmt.Sprintf("fred1_%s", suffix)
+	t2 := fmt.Sprintf("fred2_%s", suffix)
+	t3 := fmt.Sprintf("plugh1_%s", suffix)
+	t4 := fmt.Sprintf("plugh2_%s", suffix)
+	t.Cleanup(func() {
+		for _, table := range []string{mt1, mt2, t1, t2, t3, t4} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+	})
+	var logBuffer bytes.Buffer
+	log := logger.Memory(&logBuffer)
+
+	fred, err := makeSequence(t1, t2, 3, false)
+	it.Nil(err)
+	m1, err := golembic.NewManager(
+		golembic.OptManagerSequence(fred),
+		golembic.OptManagerMetadataTable(mt1),
+		golembic.OptManagerLog(log),
+	)
+	it.Nil(err)
+	plugh, err := makeSequence(t3, t4, 1, false)
+	it.Nil(err)
+	m2, err := golembic.NewManager(
+		golembic.OptManagerSequence(plugh),
+		golembic.OptManagerMetadataTable(mt2),
+		golembic.OptManagerLog(log),
+	)
+	it.Nil(err)
+	c, err := golembic.NewCoordinator(
+		golembic.OptCoordinatorSequence("fred", m1),
+		golembic.OptCoordinatorSequence("plugh", m2, "fred"),
+		golembic.OptCoordinatorLog(log),
+	)
+	it.Nil(err)
+
+	suite, err := golembic.GenerateCoordinatorSuite(c)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+
+	logLines := []string{
+		fmt.Sprintf("[db.migration] -- applied fred -- Upgrade metadata table %s to schema version 1: Create migrations metadata table", mt1),
+		fmt.Sprintf("[db.migration] -- applied fred -- Upgrade metadata table %s to schema version 2: Add checksum column", mt1),
+		fmt.Sprintf("[db.migration] -- applied fred -- Upgrade metadata table %s to schema version 3: Add description, duration_ms, applied_by, hostname and app_version columns", mt1),
+		"[db.migration] -- plan fred -- Determine migrations that need to be applied",
+		"[db.migration] -- aa60f058f5f5 fred -- Create first table",
+		"[db.migration] -- ab1208989a3f fred -- Alter first table",
+		"[db.migration] -- 60a33b9d4c77 fred -- Add second table",
+		"[db.migration.stats] fred -- 4 applied 0 skipped 0 failed 4 total",
+		fmt.Sprintf("[db.migration] -- applied plugh -- Upgrade metadata table %s to schema version 1: Create migrations metadata table", mt2),
+		fmt.Sprintf("[db.migration] -- applied plugh -- Upgrade metadata table %s to schema version 2: Add checksum column", mt2),
+		fmt.Sprintf("[db.migration] -- applied plugh -- Upgrade metadata table %s to schema version 3: Add description, duration_ms, applied_by, hostname and app_version columns", mt2),
+		"[db.migration] -- plan plugh -- Determine migrations that need to be applied",
+		"[db.migration] -- aa60f058f5f5 plugh -- Create first table",
+		"[db.migration.stats] plugh -- 2 applied 0 skipped 0 failed 2 total",
+		"[db.migration.stats] 6 applied 0 skipped 0 failed 6 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+	expected := []golembic.SequenceStats{
+		{Name: "fred", Applied: 4, Skipped: 0, Total: 4},
+		{Name: "plugh", Applied: 2, Skipped: 0, Total: 2},
+	}
+	it.Equal(expected, c.Stats())
+
+	// Generating a suite without applying it keeps the stats of the last run
+	_, err = golembic.GenerateCoordinatorSuite(c)
+	it.Nil(err)
+	it.Equal(expected, c.Stats())
+
+	// Extend the second sequence and run again; the first is a no-op
+	plugh, err = makeSequence(t3, t4, 2, false)
+	it.Nil(err)
+	m2.Sequence = plugh
+	suite, err = golembic.GenerateCoordinatorSuite(c)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- skipped fred -- Metadata table %s is at schema version 3", mt1),
+		"[db.migration] -- plan fred -- Determine migrations that need to be applied",
+		"[db.migration] -- plan fred -- No migrations to run; latest revision: 60a33b9d4c77",
+		"[db.migration.stats] fred -- 0 applied 1 skipped 0 failed 1 total",
+		fmt.Sprintf("[db.migration] -- skipped plugh -- Metadata table %s is at schema version 3", mt2),
+		"[db.migration] -- plan plugh -- Determine migrations that need to be applied",
+		"[db.migration] -- ab1208989a3f plugh -- Alter first table",
+		"[db.migration.stats] plugh -- 1 applied 1 skipped 0 failed 2 total",
+		"[db.migration.stats] 1 applied 2 skipped 0 failed 3 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	expected = []golembic.SequenceStats{
+		{Name: "fred", Applied: 0, Skipped: 1, Total: 1},
+		{Name: "plugh", Applied: 1, Skipped: 1, Total: 2},
+	}
+	it.Equal(expected, c.Stats())
+}
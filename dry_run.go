@@ -0,0 +1,234 @@
+package golembic
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/blend/go-sdk/db"
+	"github.com/blend/go-sdk/db/migration"
+)
+
+// NOTE: Ensure that
+//       * `dryRunSetupAction` satisfies `migration.Action`.
+//       * `dryRunAction` satisfies `migration.Action`.
+var (
+	_ migration.Action = (*dryRunSetupAction)(nil)
+	_ migration.Action = (*dryRunAction)(nil)
+)
+
+var (
+	// queryParameterPattern matches the query parameters produced by
+	// `providerQueryParameter()`.
+	queryParameterPattern = regexp.MustCompile(`\$[0-9]+`)
+)
+
+const (
+	// opaqueBody is the body of the plan event emitted in a dry run for a
+	// migration that runs a Go function (rather than SQL).
+	opaqueBody = "[OPAQUE] Go function migration; statements cannot be shown"
+	// dryRunSuffix is appended to the description of a migration in a dry
+	// run.
+	dryRunSuffix = " [DRY RUN]"
+)
+
+// dryRunSetupAction emits the statements that would be used to create (or
+// upgrade) the migrations metadata tables, without executing them.
+type dryRunSetupAction struct {
+	m *Manager
+}
+
+// Action determines which metadata table statements are needed and emits
+// them as plan events.
+func (dsa *dryRunSetupAction) Action(ctx context.Context, pool *db.Connection, tx *sql.Tx) error {
+	m := dsa.m
+	state, err := m.readMetadataState(ctx, pool, tx)
+	if err != nil {
+		return err
+	}
+
+	// NOTE: Only the columns and constraints that exist at the current schema
+	//       version can be validated since the upgrade is not carried out.
+	if state.Exists {
+		err = m.validateMetadataTable(ctx, state, state.Version)
+		if err != nil {
+			return err
+		}
+	}
+
+	statements := m.metadataUpgradeStatements(state)
+	if len(m.Sequence.Repeatables()) > 0 {
+		exists, err := migration.PredicateTableExistsInSchema(ctx, pool, tx, m.metadataSchema(pool), m.repeatableTable())
+		if err != nil {
+			return err
+		}
+		if !exists {
+			statements = append(statements, createRepeatableStatements(m)...)
+		}
+	}
+	if m.hasNonTransactional() {
+		exists, err := migration.PredicateTableExistsInSchema(ctx, pool, tx, m.metadataSchema(pool), m.inProgressTable())
+		if err != nil {
+			return err
+		}
+		if !exists {
+			statements = append(statements, createInProgressStatements(m)...)
+		}
+	}
+
+	for _, statement := range statements {
+		PlanEventWrite(ctx, m.Log, "", compactStatement(statement), PlanStatusDryRun)
+	}
+	return nil
+}
+
+// dryRunAction emits the statements that would be executed when applying a
+// single migration, without executing them.
+type dryRunAction struct {
+	m          *Manager
+	Migration  Migration
+	Repeatable bool
+}
+
+// Action emits the statements for a migration as plan events.
+func (da *dryRunAction) Action(ctx context.Context, _ *db.Connection, _ *sql.Tx) error {
+	m := da.m
+	mi := da.Migration
+	PlanEventWrite(ctx, m.Log, mi.Revision, mi.ExtendedDescription()+dryRunSuffix, PlanStatusDryRun)
+	if mi.UpConn != nil {
+		PlanEventWrite(ctx, m.Log, mi.Revision, renderStatement(m.markInProgressStatement(mi)), "")
+	}
+	timeouts := m.effectiveTimeouts(mi)
+	for _, statement := range timeouts.Statements(mi.UpConn == nil) {
+		PlanEventWrite(ctx, m.Log, mi.Revision, statement, "")
+	}
+	if mi.SQL == "" {
+		PlanEventWrite(ctx, m.Log, mi.Revision, opaqueBody, "")
+	} else {
+		PlanEventWrite(ctx, m.Log, mi.Revision, mi.SQL, "")
+	}
+
+	for _, statement := range m.dryRunBookkeeping(mi, da.Repeatable) {
+		PlanEventWrite(ctx, m.Log, mi.Revision, statement, "")
+	}
+
+	if suite := migration.GetContextSuite(ctx); suite != nil {
+		suite.Skipped++
+		suite.Total++
+	}
+	recordDryRun(ctx)
+	return nil
+}
+
+// planDryRun determines the migrations that would be applied in a dry run.
+// Unlike `Plan()`, this can't assume the migrations metadata table exists
+// since it won't be created during a dry run.
+func (m *Manager) planDryRun(ctx context.Context, pool *db.Connection, tx *sql.Tx, opts ...ApplyOption) ([]Migration, error) {
+	exists, err := migration.PredicateTableExistsInSchema(ctx, pool, tx, m.metadataSchema(pool), m.MetadataTable)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return m.Plan(ctx, pool, tx, opts...)
+	}
+
+	ac, err := NewApplyConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	_, migrations, err := m.sinceOrAll("")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err = m.truncateToTarget(ctx, 0, migrations, ac.TargetRevision)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.validateSquashed(ctx, 0, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	return migrations, nil
+}
+
+// planRepeatableDryRun determines the repeatable migrations that would be
+// applied in a dry run.
+func (m *Manager) planRepeatableDryRun(ctx context.Context, pool *db.Connection, tx *sql.Tx) ([]Migration, error) {
+	exists, err := migration.PredicateTableExistsInSchema(ctx, pool, tx, m.metadataSchema(pool), m.repeatableTable())
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return m.PlanRepeatable(ctx, pool, tx)
+	}
+
+	return m.Sequence.Repeatables(), nil
+}
+
+// dryRunBookkeeping produces the statements that would be used to record
+// that a migration was applied, with parameters rendered as literals.
+func (m *Manager) dryRunBookkeeping(mi Migration, repeatable bool) []string {
+	if repeatable {
+		return []string{renderStatement(m.upsertRepeatableStatement(mi))}
+	}
+
+	rows := []Migration{mi}
+	if mi.Baseline {
+		// NOTE: An error is not possible for a migration that was planned
+		//       from the sequence.
+		rows, _ = m.Sequence.Through(mi.Revision)
+	}
+
+	statements := []string{}
+	if mi.UpConn != nil {
+		statements = append(statements, renderStatement(m.clearInProgressStatement(mi.Revision)))
+	}
+	for _, row := range rows {
+		statements = append(statements, renderStatement(m.insertMigrationStatement(row, 0)))
+	}
+	return statements
+}
+
+// compactStatement collapses the whitespace in a statement (e.g. the
+// statements in `table.go`) so it can be displayed on a single line.
+func compactStatement(statement string) string {
+	return strings.Join(strings.Fields(statement), " ")
+}
+
+// renderStatement replaces the query parameters in a statement with literal
+// values. This is intended for **displaying** statements.
+func renderStatement(statement string, args []interface{}) string {
+	return queryParameterPattern.ReplaceAllStringFunc(statement, func(parameter string) string {
+		index, err := strconv.Atoi(parameter[1:])
+		if err != nil || index < 1 || index > len(args) {
+			return parameter
+		}
+		return renderLiteral(args[index-1])
+	})
+}
+
+func renderLiteral(value interface{}) string {
+	switch typed := value.(type) {
+	case string:
+		return QuoteLiteral(typed)
+	case sql.NullString:
+		if !typed.Valid {
+			return "NULL"
+		}
+		return QuoteLiteral(typed.String)
+	case sql.NullInt64:
+		if !typed.Valid {
+			return "NULL"
+		}
+		return fmt.Sprintf("%d", typed.Int64)
+	default:
+		return fmt.Sprintf("%v", typed)
+	}
+}
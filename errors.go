@@ -35,4 +35,78 @@ var (
 	// ErrCannotPassMilestone is the error returned when a migration sequence
 	// contains a milestone migration that is **NOT** the last step.
 	ErrCannotPassMilestone = ex.Class("If a migration sequence contains a milestone, it must be the last migration")
+	// ErrNoRoot is the error returned when a collection of migrations does
+	// not contain a root migration (i.e. one without a previous migration).
+	ErrNoRoot = ex.Class("Cannot find a root migration")
+	// ErrNoMigrations is the error returned when loading migrations from a
+	// directory that does not contain any migration files.
+	ErrNoMigrations = ex.Class("No migration files found")
+	// ErrInvalidMigrationFile is the error returned when a migration file
+	// cannot be parsed, e.g. if the header is missing a revision.
+	ErrInvalidMigrationFile = ex.Class("Invalid migration file")
+	// ErrMultipleHeads is the error returned when a migration sequence
+	// branches, i.e. two or more migrations have the same previous migration.
+	ErrMultipleHeads = ex.Class("Migration sequence has multiple heads")
+	// ErrCannotRebase is the error returned when a branched collection of
+	// migrations cannot be linearized.
+	ErrCannotRebase = ex.Class("Cannot rebase migration sequence")
+	// ErrChecksumMismatch is the error returned when the checksum stored for
+	// an applied migration does not match the registered migration, i.e. the
+	// migration was modified after being applied.
+	ErrChecksumMismatch = ex.Class("Checksum of applied migration doesn't match sequence")
+	// ErrCannotApplySquashed is the error returned when a plan contains a
+	// migration that has been squashed into a baseline, e.g. a tombstone or a
+	// baseline when the database is not empty.
+	ErrCannotApplySquashed = ex.Class("Cannot apply a migration that has been squashed into a baseline")
+	// ErrInvalidRepeatable is the error returned when attempting to register
+	// a repeatable migration that is not valid, e.g. one without a checksum.
+	ErrInvalidRepeatable = ex.Class("Invalid repeatable migration")
+	// ErrInvalidSequence is the error returned when registering a named
+	// sequence with a coordinator that is not valid, e.g. one that reuses the
+	// metadata table of another sequence.
+	ErrInvalidSequence = ex.Class("Invalid named sequence")
+	// ErrLockNotAcquired is the error returned when the advisory lock that
+	// guards the migrations metadata table can't be acquired, e.g. because
+	// another runner holds it and the manager should fail fast.
+	ErrLockNotAcquired = ex.Class("Could not acquire advisory lock for migrations")
+	// ErrInvalidLockTimeout is the error returned when the timeout for
+	// acquiring an advisory lock is not positive.
+	ErrInvalidLockTimeout = ex.Class("Advisory lock timeout must be positive")
+	// ErrInvalidTimeout is the error returned when a timeout used while
+	// applying a migration (e.g. `lock_timeout`) is negative.
+	ErrInvalidTimeout = ex.Class("Migration timeout must not be negative")
+	// ErrTargetBehind is the error returned when applying migrations up to a
+	// target revision that comes before the latest applied migration.
+	ErrTargetBehind = ex.Class("Target revision is behind the latest applied migration")
+	// ErrInvalidMetadataTable is the error returned when an existing
+	// migrations metadata table does not have the expected columns or
+	// constraints.
+	ErrInvalidMetadataTable = ex.Class("Migrations metadata table does not match the expected schema")
+	// ErrNotTransactional is the error returned when planning migrations in
+	// single transaction mode and the plan contains a migration that must be
+	// run outside of a transaction (i.e. via `UpConn`).
+	ErrNotTransactional = ex.Class("Migration cannot be applied in a single transaction")
+	// ErrInterruptedMigration is the error returned when a non-transactional
+	// migration is still marked as in progress from an earlier attempt and
+	// the migration has no way to check or clean up after that attempt.
+	ErrInterruptedMigration = ex.Class("An earlier attempt to apply a non-transactional migration was interrupted")
+	// ErrNotInProgress is the error returned when clearing the in progress
+	// marker for a migration that is not marked as in progress.
+	ErrNotInProgress = ex.Class("Migration is not marked as in progress")
+	// ErrInvalidRetryPolicy is the error returned when a retry policy has a
+	// negative value or a maximum delay less than the initial delay.
+	ErrInvalidRetryPolicy = ex.Class("Invalid retry policy")
+	// ErrMigrationVetoed is the error returned when a hook invoked before a
+	// migration is applied returns an error.
+	ErrMigrationVetoed = ex.Class("Migration vetoed by hook")
+	// ErrRevisionTooLong is the error returned when a revision does not fit
+	// in the revision column of the migrations metadata table.
+	ErrRevisionTooLong = ex.Class("Revision is too long for the migrations metadata table")
+	// ErrInvalidDescription is the error returned when a scaffold has a
+	// description that can't be written in a migration file header.
+	ErrInvalidDescription = ex.Class("Migration description cannot contain a newline")
+	// ErrPoolTooSmall is the error returned when the connection pool does not
+	// allow enough open connections to hold the advisory lock while applying
+	// migrations.
+	ErrPoolTooSmall = ex.Class("Connection pool is too small to hold the advisory lock while applying migrations")
 )
@@ -15,18 +15,27 @@ import (
 //       * `PlanEvent` satisfies `logger.Event`.
 //       * `PlanEvent` satisfies `logger.TextWritable`.
 //       * `PlanEvent` satisfies `logger.JSONWritable`.
+//       * `SequenceStatsEvent` satisfies `logger.Event`.
+//       * `SequenceStatsEvent` satisfies `logger.TextWritable`.
+//       * `SequenceStatsEvent` satisfies `logger.JSONWritable`.
 var (
 	_ logger.Event        = (*PlanEvent)(nil)
 	_ logger.TextWritable = (*PlanEvent)(nil)
 	_ logger.JSONWritable = (*PlanEvent)(nil)
+	_ logger.Event        = (*SequenceStatsEvent)(nil)
+	_ logger.TextWritable = (*SequenceStatsEvent)(nil)
+	_ logger.JSONWritable = (*SequenceStatsEvent)(nil)
 )
 
 type PlanStatus string
 
 const (
-	PlanStatusUnset   PlanStatus = ""
-	PlanStatusFailed  PlanStatus = migration.StatFailed
-	PlanStatusApplied PlanStatus = migration.StatApplied
+	PlanStatusUnset    PlanStatus = ""
+	PlanStatusFailed   PlanStatus = migration.StatFailed
+	PlanStatusApplied  PlanStatus = migration.StatApplied
+	PlanStatusDryRun   PlanStatus = "dry-run"
+	PlanStatusStamped  PlanStatus = "stamped"
+	PlanStatusRetrying PlanStatus = "retrying"
 )
 
 type PlanEvent struct {
@@ -54,6 +63,15 @@ func (pe PlanEvent) Color() ansi.Color {
 	if pe.Status == PlanStatusFailed {
 		return ansi.ColorRed
 	}
+	if pe.Status == PlanStatusDryRun {
+		return ansi.ColorYellow
+	}
+	if pe.Status == PlanStatusStamped {
+		return ansi.ColorCyan
+	}
+	if pe.Status == PlanStatusRetrying {
+		return ansi.ColorPurple
+	}
 	return ansi.ColorGreen
 }
 
@@ -97,3 +115,42 @@ func PlanEventWrite(ctx context.Context, log logger.Log, revision, body string,
 	pe := PlanEvent{Revision: revision, Body: body, Status: status, Labels: migration.GetContextLabels(ctx)}
 	logger.MaybeTriggerContext(ctx, log, pe)
 }
+
+// SequenceStatsEvent reports the stats for a single named sequence run by a
+// coordinator.
+type SequenceStatsEvent struct {
+	Labels []string
+	Stats  SequenceStats
+}
+
+func (SequenceStatsEvent) GetFlag() string {
+	return migration.FlagStats
+}
+
+// WriteText writes the sequence stats event as text.
+func (sse SequenceStatsEvent) WriteText(tf logger.TextFormatter, wr io.Writer) {
+	if len(sse.Labels) > 0 {
+		fmt.Fprint(wr, strings.Join(sse.Labels, " > "))
+		fmt.Fprint(wr, logger.Space)
+		fmt.Fprint(wr, tf.Colorize("--", ansi.ColorLightBlack))
+		fmt.Fprint(wr, logger.Space)
+	}
+	fmt.Fprintf(wr, "%s applied %s skipped %s failed %s total",
+		tf.Colorize(fmt.Sprintf("%d", sse.Stats.Applied), ansi.ColorGreen),
+		tf.Colorize(fmt.Sprintf("%d", sse.Stats.Skipped), ansi.ColorLightGreen),
+		tf.Colorize(fmt.Sprintf("%d", sse.Stats.Failed), ansi.ColorRed),
+		tf.Colorize(fmt.Sprintf("%d", sse.Stats.Total), ansi.ColorLightWhite),
+	)
+}
+
+// Decompose implements logger.JSONWritable.
+func (sse SequenceStatsEvent) Decompose() map[string]interface{} {
+	return map[string]interface{}{
+		"labels":              sse.Labels,
+		"sequence":            sse.Stats.Name,
+		migration.StatApplied: sse.Stats.Applied,
+		migration.StatSkipped: sse.Stats.Skipped,
+		migration.StatFailed:  sse.Stats.Failed,
+		migration.StatTotal:   sse.Stats.Total,
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"context"
 	"fmt"
 	"os"
 
@@ -13,62 +12,31 @@ import (
 	"github.com/dhermes/golembic-blend/examples"
 )
 
-func run(length int, verifyHistory bool) error {
-	migrations, err := examples.AllMigrations(length)
-	if err != nil {
-		return err
-	}
-
-	log := logger.All()
-	m, err := golembic.NewManager(
-		golembic.OptManagerSequence(migrations),
-		golembic.OptManagerLog(log),
-		golembic.OptManagerVerifyHistory(verifyHistory),
-	)
-	if err != nil {
-		return err
-	}
-
-	suite, err := golembic.GenerateSuite(m)
-	if err != nil {
-		return err
-	}
-
-	suite.Log = log
-
-	ctx := context.Background()
-	pool, err := getPool(ctx)
-	if err != nil {
-		return err
+func managerFactory(length *int) golembic.ManagerFactory {
+	return func() (*golembic.Manager, error) {
+		migrations, err := examples.AllMigrations(*length)
+		if err != nil {
+			return nil, err
+		}
+
+		return golembic.NewManager(
+			golembic.OptManagerSequence(migrations),
+			golembic.OptManagerLog(logger.All()),
+		)
 	}
-
-	return golembic.ApplyDynamic(ctx, suite, pool)
 }
 
 func root() *cobra.Command {
 	length := -1
-	verifyHistory := false
-	cmd := &cobra.Command{
-		Use:           "golembic-blend-example",
-		Short:         "Run example database migrations via golembic-blend",
-		SilenceErrors: true,
-		SilenceUsage:  true,
-		RunE: func(_ *cobra.Command, _ []string) error {
-			return run(length, verifyHistory)
-		},
-	}
+	cmd := golembic.NewCommand(managerFactory(&length), golembic.PoolFromEnv(configDefaults()))
+	cmd.Use = "golembic-blend-example"
+	cmd.Short = "Run example database migrations via golembic-blend"
 
 	cmd.PersistentFlags().IntVar(
 		&length,
 		"length",
 		-1,
-		"The length of the sequence to be run. Must be one of -1, 1, ..., 7.",
-	)
-	cmd.PersistentFlags().BoolVar(
-		&verifyHistory,
-		"verify-history",
-		false,
-		"If set, verify that all of the migration history matches the registered migrations",
+		"The length of the sequence to be used. Must be one of -1, 1, ..., 7.",
 	)
 
 	return cmd
@@ -83,8 +51,11 @@ func main() {
 	}
 }
 
-func getPool(ctx context.Context) (*db.Connection, error) {
-	c := db.Config{
+// configDefaults specifies the default configuration for the example
+// database; these can be overridden via environment variables such as
+// `DB_HOST` or `DB_PORT`.
+func configDefaults() db.Config {
+	return db.Config{
 		Host:     "127.0.0.1",
 		Port:     "23396",
 		Database: "golembic",
@@ -92,20 +63,4 @@ func getPool(ctx context.Context) (*db.Connection, error) {
 		Password: "testpassword_admin",
 		SSLMode:  "disable",
 	}
-	pool, err := db.New(db.OptConfig(c))
-	if err != nil {
-		return nil, err
-	}
-
-	err = pool.Open()
-	if err != nil {
-		return nil, err
-	}
-
-	err = pool.Connection.PingContext(ctx)
-	if err != nil {
-		return nil, err
-	}
-
-	return pool, nil
 }
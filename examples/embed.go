@@ -0,0 +1,19 @@
+package examples
+
+import (
+	"embed"
+
+	golembic "github.com/dhermes/golembic-blend"
+)
+
+// SQLFiles contains the example migrations as SQL files; this is equivalent
+// to the migrations defined in Go in `AllMigrations()`.
+//
+//go:embed sql/*.sql
+var SQLFiles embed.FS
+
+// AllMigrationsFromSQL returns a sequence of migrations loaded from the
+// embedded SQL files in `SQLFiles`.
+func AllMigrationsFromSQL() (*golembic.Migrations, error) {
+	return golembic.LoadSequence(SQLFiles, "sql")
+}
@@ -0,0 +1,8 @@
+-- revision: 3f34bd961f15
+-- description: Create users table
+
+CREATE TABLE users (
+  user_id  INTEGER UNIQUE,
+  username VARCHAR(40),
+  email    VARCHAR(40)
+);
@@ -0,0 +1,7 @@
+-- revision: 464bc456c630
+-- previous: 3f34bd961f15
+-- description: Seed data in users table
+
+INSERT INTO users (user_id, username, email) VALUES
+  (0, 'root', ''),
+  (1, 'dhermes', 'dhermes@mail.invalid');
@@ -0,0 +1,6 @@
+-- revision: 959456a8af88
+-- previous: 464bc456c630
+-- description: Add city column to users table
+
+ALTER TABLE users
+  ADD COLUMN city VARCHAR(100);
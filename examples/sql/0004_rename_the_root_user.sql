@@ -0,0 +1,8 @@
+-- revision: 57393d6ddb95
+-- previous: 959456a8af88
+-- description: Rename the root user
+-- milestone: true
+
+UPDATE users
+  SET username = 'admin'
+  WHERE username = 'root';
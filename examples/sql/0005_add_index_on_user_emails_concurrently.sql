@@ -0,0 +1,6 @@
+-- revision: 4d07dd6af28d
+-- previous: 57393d6ddb95
+-- description: Add index on user emails (concurrently)
+-- transactional: false
+
+CREATE UNIQUE INDEX CONCURRENTLY uq_users_email ON users (email);
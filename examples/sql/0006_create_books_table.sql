@@ -0,0 +1,9 @@
+-- revision: 2a35ccd628bc
+-- previous: 4d07dd6af28d
+-- description: Create books table
+
+CREATE TABLE books (
+  user_id INTEGER,
+  title   VARCHAR(40),
+  author  VARCHAR(40)
+);
@@ -0,0 +1,9 @@
+-- revision: 3196713ca7e6
+-- previous: 2a35ccd628bc
+-- description: Create movies table
+
+CREATE TABLE movies (
+  user_id  INTEGER,
+  title    VARCHAR(40),
+  director VARCHAR(40)
+);
@@ -3,6 +3,7 @@ package golembic
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/blend/go-sdk/db"
 	"github.com/blend/go-sdk/db/migration"
@@ -12,22 +13,51 @@ import (
 // NOTE: Ensure that
 //       * `planAction` satisfies `migration.Action`.
 //       * `applyAction` satisfies `migration.Action`.
+//       * `repeatablePlanAction` satisfies `migration.Action`.
 var (
 	_ migration.Action = (*planAction)(nil)
 	_ migration.Action = (*applyAction)(nil)
+	_ migration.Action = (*repeatablePlanAction)(nil)
 )
 
 // GenerateSuite generates a suite of migrations from a sequence of golembic
-// migrations.
-func GenerateSuite(m *Manager) (*migration.Suite, error) {
-	statements := createMigrationsStatements(m)
-	groups := []*migration.Group{
-		migration.NewGroupWithAction(
-			migration.TableNotExists(m.MetadataTable),
-			migration.Statements(statements...),
-		),
+// migrations. If the sequence has repeatable migrations, they will be planned
+// (and applied) after all of the migrations in the sequence.
+//
+// If the manager is in dry run mode, the suite will not modify the database;
+// instead the statements that would be executed are emitted as plan events.
+// If the manager is in single transaction mode, the metadata tables are set
+// up and every migration is planned and applied in a single group (i.e. a
+// single transaction), so a failure rolls back the whole batch.
+// If the manager has a lock mode, the first group in the suite acquires an
+// advisory lock that is held until the suite is done.
+//
+// The apply options (e.g. `OptApplyTarget()`) are used when planning.
+func GenerateSuite(m *Manager, opts ...ApplyOption) (*migration.Suite, error) {
+	// NOTE: Validate the options up front, rather than during planning.
+	_, err := NewApplyConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []*migration.Group{}
+	if m.LockMode != LockModeNone {
+		groups = append(groups, migration.NewGroup(
+			migration.OptGroupActions(&lockAction{m: m, Connections: m.lockConnections()}),
+			migration.OptGroupSkipTransaction(),
+		))
+	}
+	if m.SingleTransaction && !m.DryRun {
+		groups = append(groups, singleTransactionGroup(m, opts))
+		suite := migration.New(
+			migration.OptGroups(groups...),
+			migration.OptLog(m.Log),
+		)
+		return suite, nil
 	}
-	pa := planAction{m: m}
+
+	groups = append(groups, setupGroups(m)...)
+	pa := planAction{m: m, opts: opts}
 	groups = append(groups, migration.NewGroup(
 		migration.OptGroupActions(&pa),
 	))
@@ -39,11 +69,48 @@ func GenerateSuite(m *Manager) (*migration.Suite, error) {
 	return pa.Suite, nil
 }
 
+// setupGroups produces the groups that create (or upgrade) the migrations
+// metadata tables.
+func setupGroups(m *Manager) []*migration.Group {
+	if m.DryRun {
+		return []*migration.Group{
+			migration.NewGroup(migration.OptGroupActions(&dryRunSetupAction{m: m})),
+		}
+	}
+
+	groups := []*migration.Group{
+		migration.NewGroup(migration.OptGroupActions(&metadataSchemaAction{m: m})),
+	}
+	if len(m.Sequence.Repeatables()) > 0 {
+		groups = append(groups, migration.NewGroupWithAction(
+			m.tableNotExists(m.repeatableTable()),
+			migration.Statements(createRepeatableStatements(m)...),
+		))
+	}
+	if m.hasNonTransactional() {
+		groups = append(groups, migration.NewGroupWithAction(
+			m.tableNotExists(m.inProgressTable()),
+			migration.Statements(createInProgressStatements(m)...),
+		))
+	}
+	return groups
+}
+
+// tableNotExists returns a guard that ensures a metadata table does not
+// exist (in `MetadataSchema`, if set).
+func (m *Manager) tableNotExists(table string) migration.GuardFunc {
+	if m.MetadataSchema != "" {
+		return migration.TableNotExistsInSchema(m.MetadataSchema, table)
+	}
+	return migration.TableNotExists(table)
+}
+
 // planAction is a meta-action. It determines a plan (dynamically) for
 // **more** work to be done and then appends it to the groups in an existing
 // suite.
 type planAction struct {
 	m     *Manager
+	opts  []ApplyOption
 	Suite *migration.Suite
 }
 
@@ -53,9 +120,12 @@ func (pa *planAction) Action(ctx context.Context, pool *db.Connection, tx *sql.T
 		return nil
 	}
 
-	PlanEventWrite(ctx, pa.Suite.Log, "", "Determine migrations that need to be applied", "")
-
-	migrations, err := pa.m.Plan(ctx, pool, tx, OptApplyVerifyHistory(pa.m.VerifyHistory))
+	ctx, span := pa.m.startSpan(ctx, SpanPlan)
+	migrations, err := pa.plan(ctx, pool, tx)
+	if err == nil {
+		span.SetAttributes(Attribute{Key: AttributePending, Value: len(migrations)})
+	}
+	endSpan(span, err)
 	if err != nil {
 		return err
 	}
@@ -63,28 +133,150 @@ func (pa *planAction) Action(ctx context.Context, pool *db.Connection, tx *sql.T
 	//  m.ApplyMigration(ctx, migration)
 	for _, mi := range migrations {
 		pa.Suite.Groups = append(pa.Suite.Groups, migration.NewGroup(
-			migration.OptGroupActions(&applyAction{m: pa.m, Migration: mi}),
+			migration.OptGroupActions(newApplyAction(pa.m, mi, false)),
+		))
+	}
+
+	// Repeatable migrations are planned only **after** every migration in the
+	// sequence has been applied, so they are deferred if the plan stops
+	// short of the end of the sequence.
+	if len(pa.m.Sequence.Repeatables()) > 0 {
+		reachesEnd, err := pa.m.planReachesEnd(migrations, pa.opts...)
+		if err != nil {
+			return err
+		}
+		if !reachesEnd {
+			pa.m.deferRepeatables(ctx)
+			return nil
+		}
+
+		rpa := repeatablePlanAction{m: pa.m, Suite: pa.Suite}
+		pa.Suite.Groups = append(pa.Suite.Groups, migration.NewGroup(
+			migration.OptGroupActions(&rpa),
 		))
 	}
 
 	return nil
 }
 
+// plan determines the migrations that need to be applied, invoking the
+// hooks of the manager before and after.
+func (pa *planAction) plan(ctx context.Context, pool *db.Connection, tx *sql.Tx) ([]Migration, error) {
+	if !pa.m.DryRun {
+		err := pa.m.Hooks.beforePlan(ctx, pool, tx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	PlanEventWrite(ctx, pa.Suite.Log, "", "Determine migrations that need to be applied", "")
+
+	var migrations []Migration
+	var err error
+	opts := append([]ApplyOption{OptApplyVerifyHistory(pa.m.VerifyHistory)}, pa.opts...)
+	if pa.m.DryRun {
+		migrations, err = pa.m.planDryRun(ctx, pool, tx, opts...)
+	} else {
+		migrations, err = pa.m.Plan(ctx, pool, tx, opts...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if pa.m.SingleTransaction {
+		err = validateSingleTransaction(migrations)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !pa.m.DryRun {
+		err = pa.m.Hooks.afterPlan(ctx, pool, tx, migrations)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	recordPending(ctx, migrations, false)
+	return migrations, nil
+}
+
+// repeatablePlanAction is a meta-action, similar to `planAction`. It
+// determines the repeatable migrations that need to be applied and then
+// appends them to the groups in an existing suite.
+type repeatablePlanAction struct {
+	m     *Manager
+	Suite *migration.Suite
+}
+
+// Action carries out the planning and updates `Suite.Groups` accordingly.
+func (rpa *repeatablePlanAction) Action(ctx context.Context, pool *db.Connection, tx *sql.Tx) error {
+	if rpa.Suite == nil {
+		return nil
+	}
+
+	PlanEventWrite(ctx, rpa.Suite.Log, "", "Determine repeatable migrations that need to be applied", "")
+
+	var migrations []Migration
+	var err error
+	if rpa.m.DryRun {
+		migrations, err = rpa.m.planRepeatableDryRun(ctx, pool, tx)
+	} else {
+		migrations, err = rpa.m.PlanRepeatable(ctx, pool, tx)
+	}
+	if err != nil {
+		return err
+	}
+	if rpa.m.SingleTransaction {
+		err = validateSingleTransaction(migrations)
+		if err != nil {
+			return err
+		}
+	}
+	recordPending(ctx, migrations, true)
+
+	for _, mi := range migrations {
+		rpa.Suite.Groups = append(rpa.Suite.Groups, migration.NewGroup(
+			migration.OptGroupActions(newApplyAction(rpa.m, mi, true)),
+		))
+	}
+
+	return nil
+}
+
+// newApplyAction creates the action that applies a planned migration or, in
+// dry run mode, the action that emits the statements for the migration.
+func newApplyAction(m *Manager, mi Migration, repeatable bool) migration.Action {
+	if m.DryRun {
+		return &dryRunAction{m: m, Migration: mi, Repeatable: repeatable}
+	}
+	return &applyAction{m: m, Migration: mi, Repeatable: repeatable}
+}
+
 type applyAction struct {
-	m         *Manager
-	Migration Migration
+	m          *Manager
+	Migration  Migration
+	Repeatable bool
 }
 
-// Action executes ApplyMigration for a given migration.
+// Action executes ApplyMigration (or ApplyRepeatable) for a given migration,
+// retrying according to the retry policy of the manager.
 func (aa *applyAction) Action(ctx context.Context, pool *db.Connection, tx *sql.Tx) error {
-	err := aa.m.ApplyMigration(ctx, pool, tx, aa.Migration)
+	ctx, span := aa.m.startSpan(ctx, SpanApply, migrationAttributes(aa.Migration, aa.Repeatable)...)
+	start := time.Now()
+	err := aa.apply(ctx, pool, tx)
+	duration := time.Since(start)
+	aa.m.recordApply(ctx, aa.Migration, aa.Repeatable, duration, err)
+	recordApply(ctx, aa.Migration, aa.Repeatable, duration, err)
+	endSpan(span, err)
+
 	suite := migration.GetContextSuite(ctx)
+	// NOTE: The effective timeouts (if any) are included with the description.
+	body := aa.Migration.ExtendedDescription() + aa.m.effectiveTimeouts(aa.Migration).suffix()
 
 	if err != nil {
 		if suite != nil {
 			suite.Failed++
 			suite.Total++
-			PlanEventWrite(ctx, aa.m.Log, aa.Migration.Revision, aa.Migration.ExtendedDescription(), PlanStatusFailed)
+			PlanEventWrite(ctx, aa.m.Log, aa.Migration.Revision, body, PlanStatusFailed)
 			return err
 		}
 		return err
@@ -93,17 +285,54 @@ func (aa *applyAction) Action(ctx context.Context, pool *db.Connection, tx *sql.
 	if suite != nil {
 		suite.Applied++
 		suite.Total++
-		PlanEventWrite(ctx, aa.m.Log, aa.Migration.Revision, aa.Migration.ExtendedDescription(), PlanStatusApplied)
+		PlanEventWrite(ctx, aa.m.Log, aa.Migration.Revision, body, PlanStatusApplied)
 	}
 
 	return nil
 }
 
+// apply invokes the hooks of the manager around applying the migration.
+func (aa *applyAction) apply(ctx context.Context, pool *db.Connection, tx *sql.Tx) error {
+	err := aa.m.Hooks.beforeMigration(ctx, pool, tx, aa.Migration)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	err = aa.m.applyWithRetry(ctx, pool, tx, aa.Migration, func() error {
+		if aa.Repeatable {
+			return aa.m.ApplyRepeatable(ctx, pool, tx, aa.Migration)
+		}
+		return aa.m.ApplyMigration(ctx, pool, tx, aa.Migration)
+	})
+	hookErr := aa.m.Hooks.afterMigration(ctx, pool, tx, aa.Migration, time.Since(start), err)
+	if err != nil {
+		return err
+	}
+	return hookErr
+}
+
 // ApplyDynamic applies a migrations suite. Rather than using a `range`
 // over `s.Groups`, it uses a length check, which allows `s.Groups` to
-// change dynamically during the iteration.
-func ApplyDynamic(ctx context.Context, s *migration.Suite, c *db.Connection) (err error) {
+// change dynamically during the iteration. The returned report describes the
+// migrations that were planned, applied, failed or skipped; it is returned
+// even if applying the suite fails.
+func ApplyDynamic(ctx context.Context, s *migration.Suite, c *db.Connection) (*RunReport, error) {
 	defer s.WriteStats(ctx)
+	report := newRunReport()
+	err := applyGroups(withRunReport(ctx, report), s, c)
+	report.finish(s, err)
+	return report, err
+}
+
+// applyGroups applies each group in a migrations suite (see `ApplyDynamic()`)
+// without writing the stats for the suite. Any resources held by actions in
+// the suite (e.g. an advisory lock) are released once done.
+func applyGroups(ctx context.Context, s *migration.Suite, c *db.Connection) (err error) {
+	defer releaseGroups(migration.WithSuite(ctx, s), s)
+	defer func() {
+		completeGroups(migration.WithSuite(ctx, s), s, c, err)
+	}()
 	defer func() {
 		if r := recover(); r != nil {
 			err = ex.New(r)
@@ -113,8 +342,19 @@ func ApplyDynamic(ctx context.Context, s *migration.Suite, c *db.Connection) (er
 	for i := 0; i < len(s.Groups); i++ {
 		group := s.Groups[i]
 		if err = group.Action(migration.WithSuite(ctx, s), c); err != nil {
+			rollbackGroup(migration.WithSuite(ctx, s), group)
 			return
 		}
 	}
 	return
 }
+
+// rollbackGroup notifies the actions in a group that failed (and so was
+// rolled back) that their work was not committed.
+func rollbackGroup(ctx context.Context, group *migration.Group) {
+	for _, action := range group.Actions {
+		if r, ok := action.(rollbacker); ok {
+			r.rollback(ctx)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package golembic_test
 import (
 	"bytes"
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -14,6 +15,7 @@ import (
 	"github.com/blend/go-sdk/assert"
 	"github.com/blend/go-sdk/bufferutil"
 	"github.com/blend/go-sdk/db"
+	"github.com/blend/go-sdk/db/migration"
 	"github.com/blend/go-sdk/logger"
 
 	golembic "github.com/dhermes/golembic-blend"
@@ -58,11 +60,13 @@ func TestGenerateSuite_HappyPath(t *testing.T) {
 	suite, err := golembic.GenerateSuite(m)
 	it.Nil(err)
 
-	err = golembic.ApplyDynamic(ctx, suite, pool)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
 	it.Nil(err)
 
 	logLines := []string{
-		fmt.Sprintf("[db.migration] -- applied -- Check table does not exist: %s", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 1: Create migrations metadata table", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 2: Add checksum column", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 3: Add description, duration_ms, applied_by, hostname and app_version columns", mt),
 		"[db.migration] -- plan -- Determine migrations that need to be applied",
 		"[db.migration] -- aa60f058f5f5 -- Create first table",
 		"[db.migration] -- ab1208989a3f -- Alter first table",
@@ -76,10 +80,10 @@ func TestGenerateSuite_HappyPath(t *testing.T) {
 	// Run again, should be a no-op
 	suite, err = golembic.GenerateSuite(m)
 	it.Nil(err)
-	err = golembic.ApplyDynamic(ctx, suite, pool)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
 	it.Nil(err)
 	logLines = []string{
-		fmt.Sprintf("[db.migration] -- skipped -- Check table does not exist: %s", mt),
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
 		"[db.migration] -- plan -- Determine migrations that need to be applied",
 		"[db.migration] -- plan -- No migrations to run; latest revision: 60a33b9d4c77",
 		"[db.migration.stats] 0 applied 1 skipped 0 failed 1 total",
@@ -97,10 +101,10 @@ func TestGenerateSuite_HappyPath(t *testing.T) {
 
 	suite, err = golembic.GenerateSuite(m)
 	it.Nil(err)
-	err = golembic.ApplyDynamic(ctx, suite, pool)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
 	it.Nil(err)
 	logLines = []string{
-		fmt.Sprintf("[db.migration] -- skipped -- Check table does not exist: %s", mt),
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
 		"[db.migration] -- plan -- Determine migrations that need to be applied",
 		"[db.migration] -- 60a33b9d4c77 -- Add second table",
 		"[db.migration.stats] 1 applied 1 skipped 0 failed 2 total",
@@ -143,7 +147,7 @@ func TestGenerateSuite_StaleCheckout(t *testing.T) {
 	it.Nil(err)
 	suite, err := golembic.GenerateSuite(m)
 	it.Nil(err)
-	err = golembic.ApplyDynamic(ctx, suite, pool)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
 	it.Nil(err)
 	logBuffer.Reset()
 
@@ -157,10 +161,10 @@ func TestGenerateSuite_StaleCheckout(t *testing.T) {
 
 	suite, err = golembic.GenerateSuite(m)
 	it.Nil(err)
-	err = golembic.ApplyDynamic(ctx, suite, pool)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
 	it.Equal(`No migration registered for revision; Revision: "not-in-sequence"`, fmt.Sprintf("%v", err))
 	logLines := []string{
-		fmt.Sprintf("[db.migration] -- skipped -- Check table does not exist: %s", mt),
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
 		"[db.migration] -- plan -- Determine migrations that need to be applied",
 		"[db.migration.stats] 0 applied 1 skipped 0 failed 1 total",
 		"",
@@ -178,10 +182,10 @@ func TestGenerateSuite_StaleCheckout(t *testing.T) {
 	it.Nil(err)
 	suite, err = golembic.GenerateSuite(mVerify)
 	it.Nil(err)
-	err = golembic.ApplyDynamic(ctx, suite, pool)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
 	it.Equal("Migration stored in SQL doesn't match sequence", fmt.Sprintf("%v", err))
 	logLines = []string{
-		fmt.Sprintf("[db.migration] -- skipped -- Check table does not exist: %s", mt),
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
 		"[db.migration] -- plan -- Determine migrations that need to be applied",
 		"[db.migration] -- failed -- Sequence has 3 migrations but 4 are stored in the table",
 		"[db.migration.stats] 0 applied 1 skipped 0 failed 1 total",
@@ -206,10 +210,10 @@ func TestGenerateSuite_StaleCheckout(t *testing.T) {
 
 	suite, err = golembic.GenerateSuite(m)
 	it.Nil(err)
-	err = golembic.ApplyDynamic(ctx, suite, pool)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
 	it.Equal(`No migration registered for revision; Revision: "not-in-sequence"`, fmt.Sprintf("%v", err))
 	logLines = []string{
-		fmt.Sprintf("[db.migration] -- skipped -- Check table does not exist: %s", mt),
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
 		"[db.migration] -- plan -- Determine migrations that need to be applied",
 		"[db.migration.stats] 0 applied 1 skipped 0 failed 1 total",
 		"",
@@ -220,10 +224,10 @@ func TestGenerateSuite_StaleCheckout(t *testing.T) {
 	// Replace last revision with nonsense, but with `--verify-history` turned on
 	suite, err = golembic.GenerateSuite(mVerify)
 	it.Nil(err)
-	err = golembic.ApplyDynamic(ctx, suite, pool)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
 	it.Equal("Migration stored in SQL doesn't match sequence", fmt.Sprintf("%v", err))
 	logLines = []string{
-		fmt.Sprintf("[db.migration] -- skipped -- Check table does not exist: %s", mt),
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
 		"[db.migration] -- plan -- Determine migrations that need to be applied",
 		`[db.migration] -- failed -- Stored migration 2: "not-in-sequence:ab1208989a3f" does not match migration "60a33b9d4c77:ab1208989a3f" in sequence`,
 		"[db.migration.stats] 0 applied 1 skipped 0 failed 1 total",
@@ -266,10 +270,12 @@ func TestGenerateSuite_Milestone(t *testing.T) {
 	it.Nil(err)
 	suite, err := golembic.GenerateSuite(m1)
 	it.Nil(err)
-	err = golembic.ApplyDynamic(ctx, suite, pool)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
 	it.Nil(err)
 	logLines := []string{
-		fmt.Sprintf("[db.migration] -- applied -- Check table does not exist: %s", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 1: Create migrations metadata table", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 2: Add checksum column", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 3: Add description, duration_ms, applied_by, hostname and app_version columns", mt),
 		"[db.migration] -- plan -- Determine migrations that need to be applied",
 		"[db.migration] -- aa60f058f5f5 -- Create first table",
 		"[db.migration.stats] 2 applied 0 skipped 0 failed 2 total",
@@ -289,10 +295,10 @@ func TestGenerateSuite_Milestone(t *testing.T) {
 	it.Nil(err)
 	suite, err = golembic.GenerateSuite(m3)
 	it.Nil(err)
-	err = golembic.ApplyDynamic(ctx, suite, pool)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
 	it.Equal("If a migration sequence contains a milestone, it must be the last migration", fmt.Sprintf("%v", err))
 	logLines = []string{
-		fmt.Sprintf("[db.migration] -- skipped -- Check table does not exist: %s", mt),
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
 		"[db.migration] -- plan -- Determine migrations that need to be applied",
 		"[db.migration] -- failed -- Revision ab1208989a3f (1 / 2 migrations)",
 		"[db.migration.stats] 0 applied 1 skipped 0 failed 1 total",
@@ -312,10 +318,10 @@ func TestGenerateSuite_Milestone(t *testing.T) {
 	it.Nil(err)
 	suite, err = golembic.GenerateSuite(m2)
 	it.Nil(err)
-	err = golembic.ApplyDynamic(ctx, suite, pool)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
 	it.Nil(err)
 	logLines = []string{
-		fmt.Sprintf("[db.migration] -- skipped -- Check table does not exist: %s", mt),
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
 		"[db.migration] -- plan -- Determine migrations that need to be applied",
 		"[db.migration] -- ab1208989a3f -- Alter first table [MILESTONE]",
 		"[db.migration.stats] 1 applied 1 skipped 0 failed 2 total",
@@ -327,10 +333,10 @@ func TestGenerateSuite_Milestone(t *testing.T) {
 	// **Finally** apply all 3 migrations
 	suite, err = golembic.GenerateSuite(m3)
 	it.Nil(err)
-	err = golembic.ApplyDynamic(ctx, suite, pool)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
 	it.Nil(err)
 	logLines = []string{
-		fmt.Sprintf("[db.migration] -- skipped -- Check table does not exist: %s", mt),
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
 		"[db.migration] -- plan -- Determine migrations that need to be applied",
 		"[db.migration] -- 60a33b9d4c77 -- Add second table",
 		"[db.migration.stats] 1 applied 1 skipped 0 failed 2 total",
@@ -340,6 +346,79 @@ func TestGenerateSuite_Milestone(t *testing.T) {
 	logBuffer.Reset()
 }
 
+func TestGenerateSuite_StopAtMilestone(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt := fmt.Sprintf("lox_%s_migrations", suffix)
+	t1 := fmt.Sprintf("lox1_%s", suffix)
+	t2 := fmt.Sprintf("lox2_%s", suffix)
+	t.Cleanup(func() {
+		for _, table := range []string{mt, t1, t2} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+	})
+	var logBuffer bytes.Buffer
+	log := logger.Memory(&logBuffer)
+
+	// Run **just** the first migration
+	migrations1, err := makeSequence(t1, t2, 1, true)
+	it.Nil(err)
+	m1, err := golembic.NewManager(
+		golembic.OptManagerSequence(migrations1),
+		golembic.OptManagerMetadataTable(mt),
+		golembic.OptManagerLog(log),
+	)
+	it.Nil(err)
+	suite, err := golembic.GenerateSuite(m1)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logBuffer.Reset()
+
+	// Stop at the milestone in the middle rather than failing
+	migrations3, err := makeSequence(t1, t2, 3, true)
+	it.Nil(err)
+	m3, err := golembic.NewManager(
+		golembic.OptManagerSequence(migrations3),
+		golembic.OptManagerMetadataTable(mt),
+		golembic.OptManagerLog(log),
+	)
+	it.Nil(err)
+	suite, err = golembic.GenerateSuite(m3, golembic.OptApplyStopAtMilestone(true))
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logLines := []string{
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- plan -- Stopping at milestone ab1208989a3f; 1 migration(s) remain for the next run",
+		"[db.migration] -- ab1208989a3f -- Alter first table [MILESTONE]",
+		"[db.migration.stats] 1 applied 1 skipped 0 failed 2 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// The next run applies the remaining migration
+	suite, err = golembic.GenerateSuite(m3, golembic.OptApplyStopAtMilestone(true))
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- 60a33b9d4c77 -- Add second table",
+		"[db.migration.stats] 1 applied 1 skipped 0 failed 2 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+}
+
 func TestGenerateSuite_FailedDDL(t *testing.T) {
 	it := assert.New(t)
 
@@ -388,12 +467,14 @@ func TestGenerateSuite_FailedDDL(t *testing.T) {
 	it.Nil(err)
 	suite, err := golembic.GenerateSuite(m)
 	it.Nil(err)
-	err = golembic.ApplyDynamic(ctx, suite, pool)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
 	expected := fmt.Sprintf("ERROR: relation %q already exists (SQLSTATE 42P07); %s", t1, ct1)
 	it.Equal(expected, fmt.Sprintf("%v", err))
 
 	logLines := []string{
-		fmt.Sprintf(`{"body":"Check table does not exist: %s","flag":"db.migration","labels":null,"result":"applied"}`, mt),
+		fmt.Sprintf(`{"body":"Upgrade metadata table %s to schema version 1: Create migrations metadata table","flag":"db.migration","labels":null,"result":"applied"}`, mt),
+		fmt.Sprintf(`{"body":"Upgrade metadata table %s to schema version 2: Add checksum column","flag":"db.migration","labels":null,"result":"applied"}`, mt),
+		fmt.Sprintf(`{"body":"Upgrade metadata table %s to schema version 3: Add description, duration_ms, applied_by, hostname and app_version columns","flag":"db.migration","labels":null,"result":"applied"}`, mt),
 		`{"body":"Determine migrations that need to be applied","flag":"db.migration","labels":null,"result":"plan"}`,
 		`{"body":"Create table first time","flag":"db.migration","labels":null,"revision":"af808e6e4d5b","status":"applied"}`,
 		`{"body":"Create table second time","flag":"db.migration","labels":null,"revision":"52d1d91b4f7e","status":"failed"}`,
@@ -404,6 +485,711 @@ func TestGenerateSuite_FailedDDL(t *testing.T) {
 	logBuffer.Reset()
 }
 
+func TestGenerateSuite_ChecksumMismatch(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt := fmt.Sprintf("corge_%s_migrations", suffix)
+	t1 := fmt.Sprintf("corge1_%s", suffix)
+	t2 := fmt.Sprintf("corge2_%s", suffix)
+	t.Cleanup(func() {
+		err1 := dropTable(ctx, pool, mt)
+		err2 := dropTable(ctx, pool, t1)
+		err3 := dropTable(ctx, pool, t2)
+		it.Nil(err1)
+		it.Nil(err2)
+		it.Nil(err3)
+	})
+	var logBuffer bytes.Buffer
+	log := logger.Memory(&logBuffer)
+
+	migrations, err := makeSequence(t1, t2, 2, false)
+	it.Nil(err)
+	m, err := golembic.NewManager(
+		golembic.OptManagerSequence(migrations),
+		golembic.OptManagerMetadataTable(mt),
+		golembic.OptManagerLog(log),
+		golembic.OptManagerVerifyHistory(true),
+	)
+	it.Nil(err)
+	suite, err := golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logBuffer.Reset()
+
+	// Modify the SQL for an applied migration (same revision)
+	root := migrations.Root()
+	modified, err := golembic.NewMigration(
+		golembic.OptRevision(root.Revision),
+		golembic.OptDescription(root.Description),
+		golembic.OptUpFromSQL(fmt.Sprintf("CREATE TABLE %s ( bar INTEGER )", golembic.QuoteIdentifier(t1))),
+	)
+	it.Nil(err)
+	it.NotEqual(root.Checksum, modified.Checksum)
+	migrationsModified, err := golembic.NewSequence(*modified)
+	it.Nil(err)
+	err = migrationsModified.Register(migrations.All()[1])
+	it.Nil(err)
+
+	m.Sequence = migrationsModified
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Equal(`Checksum of applied migration doesn't match sequence; Revision: "aa60f058f5f5"`, fmt.Sprintf("%v", err))
+	logLines := []string{
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		fmt.Sprintf(`[db.migration] -- failed -- Stored migration 0: "aa60f058f5f5" has checksum %s but migration in sequence has checksum %s`, root.Checksum, modified.Checksum),
+		"[db.migration.stats] 0 applied 2 skipped 0 failed 2 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+}
+
+func TestGenerateSuite_Baseline(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	// Two "databases": one that applied each migration and one that is empty.
+	suffix := anyLowercase(6)
+	mtExisting := fmt.Sprintf("grault_%s_migrations", suffix)
+	t1Existing := fmt.Sprintf("grault1_%s", suffix)
+	t2Existing := fmt.Sprintf("grault2_%s", suffix)
+	mtFresh := fmt.Sprintf("garply_%s_migrations", suffix)
+	t1Fresh := fmt.Sprintf("garply1_%s", suffix)
+	t2Fresh := fmt.Sprintf("garply2_%s", suffix)
+	t.Cleanup(func() {
+		for _, table := range []string{mtExisting, t1Existing, t2Existing, mtFresh, t1Fresh, t2Fresh} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+	})
+	var logBuffer bytes.Buffer
+	log := logger.Memory(&logBuffer)
+
+	migrations, err := makeSequence(t1Existing, t2Existing, 2, false)
+	it.Nil(err)
+	m, err := golembic.NewManager(
+		golembic.OptManagerSequence(migrations),
+		golembic.OptManagerMetadataTable(mtExisting),
+		golembic.OptManagerLog(log),
+	)
+	it.Nil(err)
+	suite, err := golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logBuffer.Reset()
+
+	// Existing database continues to verify correctly with a squashed sequence
+	squashed, err := makeSquashedSequence(t1Existing, t2Existing)
+	it.Nil(err)
+	m, err = golembic.NewManager(
+		golembic.OptManagerSequence(squashed),
+		golembic.OptManagerMetadataTable(mtExisting),
+		golembic.OptManagerLog(log),
+		golembic.OptManagerVerifyHistory(true),
+	)
+	it.Nil(err)
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logLines := []string{
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mtExisting),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- 60a33b9d4c77 -- Add second table",
+		"[db.migration.stats] 1 applied 1 skipped 0 failed 2 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// Empty database only runs the baseline (and migrations after it)
+	squashed, err = makeSquashedSequence(t1Fresh, t2Fresh)
+	it.Nil(err)
+	m, err = golembic.NewManager(
+		golembic.OptManagerSequence(squashed),
+		golembic.OptManagerMetadataTable(mtFresh),
+		golembic.OptManagerLog(log),
+		golembic.OptManagerVerifyHistory(true),
+	)
+	it.Nil(err)
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 1: Create migrations metadata table", mtFresh),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 2: Add checksum column", mtFresh),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 3: Add description, duration_ms, applied_by, hostname and app_version columns", mtFresh),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- ab1208989a3f -- Create first table (squashed) [BASELINE]",
+		"[db.migration] -- 60a33b9d4c77 -- Add second table",
+		"[db.migration.stats] 3 applied 0 skipped 0 failed 3 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// Run again, should be a no-op (with the full history verified)
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mtFresh),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- plan -- No migrations to run; latest revision: 60a33b9d4c77",
+		"[db.migration.stats] 0 applied 1 skipped 0 failed 1 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// A database that is partially applied can't use the baseline
+	statement := fmt.Sprintf("DELETE FROM %s WHERE revision IN ($1, $2)", golembic.QuoteIdentifier(mtFresh))
+	_, err = pool.Invoke(db.OptContext(ctx)).Exec(statement, "60a33b9d4c77", "ab1208989a3f")
+	it.Nil(err)
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Equal(`Cannot apply a migration that has been squashed into a baseline; Revision: "ab1208989a3f"`, fmt.Sprintf("%v", err))
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mtFresh),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- failed -- Revision ab1208989a3f is a baseline but 1 migrations have already been applied",
+		"[db.migration.stats] 0 applied 1 skipped 0 failed 1 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+}
+
+func TestGenerateSuite_Squashed(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt := fmt.Sprintf("kiwi_%s_migrations", suffix)
+	t1 := fmt.Sprintf("kiwi1_%s", suffix)
+	t2 := fmt.Sprintf("kiwi2_%s", suffix)
+	t.Cleanup(func() {
+		for _, table := range []string{mt, t1, t2} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+	})
+	var logBuffer bytes.Buffer
+	log := logger.Memory(&logBuffer)
+
+	// An empty database can't target a revision squashed into a baseline
+	squashed, err := makeSquashedSequence(t1, t2)
+	it.Nil(err)
+	m, err := golembic.NewManager(
+		golembic.OptManagerSequence(squashed),
+		golembic.OptManagerMetadataTable(mt),
+		golembic.OptManagerLog(log),
+	)
+	it.Nil(err)
+	suite, err := golembic.GenerateSuite(m, golembic.OptApplyTarget("aa60f058f5f5"))
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Equal(`Cannot apply a migration that has been squashed into a baseline; Revision: "aa60f058f5f5"`, fmt.Sprintf("%v", err))
+	logLines := []string{
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 1: Create migrations metadata table", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 2: Add checksum column", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 3: Add description, duration_ms, applied_by, hostname and app_version columns", mt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration.stats] 1 applied 0 skipped 0 failed 1 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// A tombstone can never be applied
+	migrations, err := golembic.NewSequence(golembic.Migration{Revision: "aa60f058f5f5", Tombstone: true})
+	it.Nil(err)
+	m, err = golembic.NewManager(
+		golembic.OptManagerSequence(migrations),
+		golembic.OptManagerMetadataTable(mt),
+		golembic.OptManagerLog(log),
+	)
+	it.Nil(err)
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Equal(`Cannot apply a migration that has been squashed into a baseline; Revision: "aa60f058f5f5"`, fmt.Sprintf("%v", err))
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- failed -- Revision aa60f058f5f5 is a tombstone",
+		"[db.migration.stats] 0 applied 1 skipped 0 failed 1 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// A migration that is missing `Up` is misconfigured, not a tombstone
+	migrations, err = golembic.NewSequence(golembic.Migration{Revision: "aa60f058f5f5", Description: "Forgot to set Up"})
+	it.Nil(err)
+	m, err = golembic.NewManager(
+		golembic.OptManagerSequence(migrations),
+		golembic.OptManagerMetadataTable(mt),
+		golembic.OptManagerLog(log),
+	)
+	it.Nil(err)
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Equal("Cannot invoke up function for a migration; Neither Up nor UpConn are set", fmt.Sprintf("%v", err))
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- aa60f058f5f5 -- Forgot to set Up",
+		"[db.migration.stats] 0 applied 1 skipped 1 failed 2 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+}
+
+func TestGenerateSuite_Repeatable(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt := fmt.Sprintf("waldo_%s_migrations", suffix)
+	rt := mt + "_repeatable"
+	t1 := fmt.Sprintf("waldo1_%s", suffix)
+	t2 := fmt.Sprintf("waldo2_%s", suffix)
+	v1 := fmt.Sprintf("waldo_view_%s", suffix)
+	t.Cleanup(func() {
+		it.Nil(dropView(ctx, pool, v1))
+		for _, table := range []string{mt, rt, t1, t2} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+	})
+	var logBuffer bytes.Buffer
+	log := logger.Memory(&logBuffer)
+
+	migrations, err := makeSequence(t1, t2, 1, false)
+	it.Nil(err)
+	createView := fmt.Sprintf("CREATE OR REPLACE VIEW %s AS SELECT bar FROM %s", golembic.QuoteIdentifier(v1), golembic.QuoteIdentifier(t1))
+	err = migrations.RegisterRepeatableOpt(
+		golembic.OptRevision("waldo_view"),
+		golembic.OptDescription("Create view"),
+		golembic.OptUpFromSQL(createView),
+	)
+	it.Nil(err)
+	m, err := golembic.NewManager(
+		golembic.OptManagerSequence(migrations),
+		golembic.OptManagerMetadataTable(mt),
+		golembic.OptManagerLog(log),
+	)
+	it.Nil(err)
+	suite, err := golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logLines := []string{
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 1: Create migrations metadata table", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 2: Add checksum column", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 3: Add description, duration_ms, applied_by, hostname and app_version columns", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Check table does not exist: %s", rt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- aa60f058f5f5 -- Create first table",
+		"[db.migration] -- plan -- Determine repeatable migrations that need to be applied",
+		"[db.migration] -- waldo_view -- Create view",
+		"[db.migration.stats] 4 applied 0 skipped 0 failed 4 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// Run again, should be a no-op
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
+		fmt.Sprintf("[db.migration] -- skipped -- Check table does not exist: %s", rt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- plan -- No migrations to run; latest revision: aa60f058f5f5",
+		"[db.migration] -- plan -- Determine repeatable migrations that need to be applied",
+		"[db.migration] -- plan -- No repeatable migrations to run",
+		"[db.migration.stats] 0 applied 2 skipped 0 failed 2 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// Add a migration and change the view; the view is re-applied **after**
+	// the new migration.
+	migrations, err = makeSequence(t1, t2, 2, false)
+	it.Nil(err)
+	createView = fmt.Sprintf("CREATE OR REPLACE VIEW %s AS SELECT bar, quux FROM %s", golembic.QuoteIdentifier(v1), golembic.QuoteIdentifier(t1))
+	err = migrations.RegisterRepeatableOpt(
+		golembic.OptRevision("waldo_view"),
+		golembic.OptDescription("Create view"),
+		golembic.OptUpFromSQL(createView),
+	)
+	it.Nil(err)
+	m.Sequence = migrations
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
+		fmt.Sprintf("[db.migration] -- skipped -- Check table does not exist: %s", rt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- ab1208989a3f -- Alter first table",
+		"[db.migration] -- plan -- Determine repeatable migrations that need to be applied",
+		"[db.migration] -- waldo_view -- Create view",
+		"[db.migration.stats] 2 applied 2 skipped 0 failed 4 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// Add another migration and change the view to depend on it; with a
+	// target before the end of the sequence, the view is deferred.
+	migrations, err = makeSequence(t1, t2, 3, false)
+	it.Nil(err)
+	createView = fmt.Sprintf(
+		"CREATE OR REPLACE VIEW %s AS SELECT bar, quux, baz FROM %s CROSS JOIN %s",
+		golembic.QuoteIdentifier(v1), golembic.QuoteIdentifier(t1), golembic.QuoteIdentifier(t2),
+	)
+	err = migrations.RegisterRepeatableOpt(
+		golembic.OptRevision("waldo_view"),
+		golembic.OptDescription("Create view"),
+		golembic.OptUpFromSQL(createView),
+	)
+	it.Nil(err)
+	m.Sequence = migrations
+	suite, err = golembic.GenerateSuite(m, golembic.OptApplyTarget("ab1208989a3f"))
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
+		fmt.Sprintf("[db.migration] -- skipped -- Check table does not exist: %s", rt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- plan -- No migrations to run; latest revision: ab1208989a3f",
+		"[db.migration] -- plan -- Repeatable migrations deferred until every migration in the sequence has been applied",
+		"[db.migration.stats] 0 applied 2 skipped 0 failed 2 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// Without a target, the view is applied after the new migration
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
+		fmt.Sprintf("[db.migration] -- skipped -- Check table does not exist: %s", rt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- 60a33b9d4c77 -- Add second table",
+		"[db.migration] -- plan -- Determine repeatable migrations that need to be applied",
+		"[db.migration] -- waldo_view -- Create view",
+		"[db.migration.stats] 2 applied 2 skipped 0 failed 4 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+}
+
+func TestGenerateSuite_Target(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt := fmt.Sprintf("grault_%s_migrations", suffix)
+	t1 := fmt.Sprintf("grault1_%s", suffix)
+	t2 := fmt.Sprintf("grault2_%s", suffix)
+	t.Cleanup(func() {
+		for _, table := range []string{mt, t1, t2} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+	})
+	var logBuffer bytes.Buffer
+	log := logger.Memory(&logBuffer)
+
+	// NOTE: The second migration is a milestone, but the plan is truncated
+	//       before the third migration so this is not an error.
+	migrations, err := makeSequence(t1, t2, 3, true)
+	it.Nil(err)
+	m, err := golembic.NewManager(
+		golembic.OptManagerSequence(migrations),
+		golembic.OptManagerMetadataTable(mt),
+		golembic.OptManagerLog(log),
+	)
+	it.Nil(err)
+
+	// Apply the root migration
+	suite, err := golembic.GenerateSuite(m, golembic.OptApplyTarget("aa60f058f5f5"))
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logLines := []string{
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 1: Create migrations metadata table", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 2: Add checksum column", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 3: Add description, duration_ms, applied_by, hostname and app_version columns", mt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- plan -- Target revision aa60f058f5f5; 2 later migration(s) will not be applied",
+		"[db.migration] -- aa60f058f5f5 -- Create first table",
+		"[db.migration.stats] 2 applied 0 skipped 0 failed 2 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// Apply through the milestone
+	suite, err = golembic.GenerateSuite(m, golembic.OptApplyTarget("ab1208989a3f"))
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- plan -- Target revision ab1208989a3f; 1 later migration(s) will not be applied",
+		"[db.migration] -- ab1208989a3f -- Alter first table [MILESTONE]",
+		"[db.migration.stats] 1 applied 1 skipped 0 failed 2 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// Target already applied
+	suite, err = golembic.GenerateSuite(m, golembic.OptApplyTarget("ab1208989a3f"))
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- plan -- No migrations to run; latest revision: ab1208989a3f [MILESTONE]",
+		"[db.migration.stats] 0 applied 1 skipped 0 failed 1 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// Target behind the database
+	suite, err = golembic.GenerateSuite(m, golembic.OptApplyTarget("aa60f058f5f5"))
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	expected := `Target revision is behind the latest applied migration; Target: "aa60f058f5f5", Latest: "ab1208989a3f"`
+	it.Equal(expected, fmt.Sprintf("%v", err))
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- failed -- Target revision aa60f058f5f5 is behind latest revision ab1208989a3f",
+		"[db.migration.stats] 0 applied 1 skipped 0 failed 1 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// Unknown target
+	suite, err = golembic.GenerateSuite(m, golembic.OptApplyTarget("not-registered"))
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Equal(`No migration registered for revision; Revision: "not-registered"`, fmt.Sprintf("%v", err))
+}
+
+func TestGenerateSuite_DryRun(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt := fmt.Sprintf("thud_%s_migrations", suffix)
+	t1 := fmt.Sprintf("thud1_%s", suffix)
+	t2 := fmt.Sprintf("thud2_%s", suffix)
+	t.Cleanup(func() {
+		for _, table := range []string{mt, t1, t2} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+	})
+	var logBuffer bytes.Buffer
+	log := logger.Memory(&logBuffer)
+
+	migrations, err := makeSequence(t1, t2, 1, false)
+	it.Nil(err)
+	err = migrations.RegisterManyOpt([]golembic.MigrationOption{
+		golembic.OptPrevious("aa60f058f5f5"),
+		golembic.OptRevision("d4c1cfb5b1b8"),
+		golembic.OptDescription("Backfill first table"),
+		golembic.OptUp(func(_ context.Context, _ *db.Connection, _ *sql.Tx) error { return nil }),
+	})
+	it.Nil(err)
+	m, err := golembic.NewManager(
+		golembic.OptManagerSequence(migrations),
+		golembic.OptManagerMetadataTable(mt),
+		golembic.OptManagerLog(log),
+		golembic.OptManagerDryRun(true),
+		golembic.OptManagerHostname("thud-host"),
+		golembic.OptManagerAppVersion("v1.2.3"),
+	)
+	it.Nil(err)
+	suite, err := golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+
+	// NOTE: The first 11 lines are the statements that create the metadata
+	//       table and bring it up to the latest schema version.
+	lines := strings.Split(logBuffer.String(), "\n")
+	it.Len(lines, 20)
+	it.True(strings.HasPrefix(lines[0], fmt.Sprintf("[db.migration] -- plan -- CREATE TABLE %s (", golembic.QuoteIdentifier(mt))))
+	ct1 := fmt.Sprintf("CREATE TABLE %s ( bar TEXT )", golembic.QuoteIdentifier(t1))
+	logLines := []string{
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- aa60f058f5f5 -- Create first table [DRY RUN]",
+		fmt.Sprintf("[db.migration] -- aa60f058f5f5 -- %s", ct1),
+		fmt.Sprintf(
+			"[db.migration] -- aa60f058f5f5 -- INSERT INTO %s (serial_id, revision, previous, checksum, description, duration_ms, applied_by, hostname, app_version) VALUES (0, 'aa60f058f5f5', NULL, '%s', 'Create first table', NULL, CURRENT_USER, 'thud-host', 'v1.2.3')",
+			golembic.QuoteIdentifier(mt), golembic.ChecksumSQL(ct1),
+		),
+		"[db.migration] -- d4c1cfb5b1b8 -- Backfill first table [DRY RUN]",
+		"[db.migration] -- d4c1cfb5b1b8 -- [OPAQUE] Go function migration; statements cannot be shown",
+		fmt.Sprintf(
+			"[db.migration] -- d4c1cfb5b1b8 -- INSERT INTO %s (serial_id, revision, previous, checksum, description, duration_ms, applied_by, hostname, app_version) VALUES (1, 'd4c1cfb5b1b8', 'aa60f058f5f5', NULL, 'Backfill first table', NULL, CURRENT_USER, 'thud-host', 'v1.2.3')",
+			golembic.QuoteIdentifier(mt),
+		),
+		"[db.migration.stats] 0 applied 2 skipped 0 failed 2 total",
+		"",
+	}
+	it.Equal(fmt.Sprintf(
+		"[db.migration] -- plan -- COMMENT ON TABLE %s IS 'golembic:schema_version=%d'",
+		golembic.QuoteIdentifier(mt), golembic.MetadataSchemaVersion,
+	), lines[10])
+	it.Equal(logLines, lines[11:])
+	logBuffer.Reset()
+
+	// Nothing was created
+	exists, err := migration.PredicateTableExists(ctx, pool, nil, mt)
+	it.Nil(err)
+	it.False(exists)
+	exists, err = migration.PredicateTableExists(ctx, pool, nil, t1)
+	it.Nil(err)
+	it.False(exists)
+
+	// Apply the root migration, then the dry run only plans the rest
+	m.DryRun = false
+	m.Sequence, err = makeSequence(t1, t2, 1, false)
+	it.Nil(err)
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logBuffer.Reset()
+
+	m.DryRun = true
+	m.Sequence = migrations
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logLines = []string{
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- d4c1cfb5b1b8 -- Backfill first table [DRY RUN]",
+		"[db.migration] -- d4c1cfb5b1b8 -- [OPAQUE] Go function migration; statements cannot be shown",
+		fmt.Sprintf(
+			"[db.migration] -- d4c1cfb5b1b8 -- INSERT INTO %s (serial_id, revision, previous, checksum, description, duration_ms, applied_by, hostname, app_version) VALUES (1, 'd4c1cfb5b1b8', 'aa60f058f5f5', NULL, 'Backfill first table', NULL, CURRENT_USER, 'thud-host', 'v1.2.3')",
+			golembic.QuoteIdentifier(mt),
+		),
+		"[db.migration.stats] 0 applied 1 skipped 0 failed 1 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+}
+
+func TestGenerateSuite_DryRunLegacyTable(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt := fmt.Sprintf("date_%s_migrations", suffix)
+	t1 := fmt.Sprintf("date1_%s", suffix)
+	t2 := fmt.Sprintf("date2_%s", suffix)
+	t.Cleanup(func() {
+		for _, table := range []string{mt, t1, t2} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+	})
+	var logBuffer bytes.Buffer
+	log := logger.Memory(&logBuffer)
+
+	// Apply the root migration, then make the table look like one at schema
+	// version 1 (i.e. without a `checksum` column)
+	m, err := golembic.NewManager(
+		golembic.OptManagerMetadataTable(mt),
+		golembic.OptManagerLog(log),
+		golembic.OptManagerVerifyHistory(true),
+	)
+	it.Nil(err)
+	m.Sequence, err = makeSequence(t1, t2, 1, false)
+	it.Nil(err)
+	suite, err := golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	qmt := golembic.QuoteIdentifier(mt)
+	statements := []string{
+		fmt.Sprintf("ALTER TABLE %s DROP COLUMN checksum, DROP COLUMN description, DROP COLUMN duration_ms, DROP COLUMN applied_by, DROP COLUMN hostname, DROP COLUMN app_version", qmt),
+		fmt.Sprintf("COMMENT ON TABLE %s IS NULL", qmt),
+	}
+	for _, statement := range statements {
+		_, err = pool.Invoke(db.OptContext(ctx)).Exec(statement)
+		it.Nil(err)
+	}
+	logBuffer.Reset()
+
+	// The dry run plans against the table without upgrading it
+	m.DryRun = true
+	m.Sequence, err = makeSequence(t1, t2, 2, false)
+	it.Nil(err)
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logText := logBuffer.String()
+	it.Contains(logText, fmt.Sprintf("[db.migration] -- plan -- ALTER TABLE %s ADD COLUMN IF NOT EXISTS checksum VARCHAR(64)\n", qmt))
+	it.Contains(logText, "[db.migration] -- plan -- Determine migrations that need to be applied\n")
+	it.Contains(logText, "[db.migration] -- ab1208989a3f -- Alter first table [DRY RUN]\n")
+	it.True(strings.HasSuffix(logText, "[db.migration.stats] 0 applied 1 skipped 0 failed 1 total\n"))
+
+	// Nothing was upgraded
+	exists, err := migration.PredicateColumnExists(ctx, pool, nil, mt, "checksum")
+	it.Nil(err)
+	it.False(exists)
+}
+
 func makeSequence(t1, t2 string, length int, milestone bool) (*golembic.Migrations, error) {
 	ct1 := fmt.Sprintf("CREATE TABLE %s ( bar TEXT )", golembic.QuoteIdentifier(t1))
 	root, err := golembic.NewMigration(
@@ -449,6 +1235,41 @@ func makeSequence(t1, t2 string, length int, milestone bool) (*golembic.Migratio
 	return migrations, nil
 }
 
+// makeSquashedSequence is the squashed form of `makeSequence(t1, t2, 3, false)`
+// where the first two migrations have been squashed into a baseline and the
+// root migration has been replaced by a tombstone.
+func makeSquashedSequence(t1, t2 string) (*golembic.Migrations, error) {
+	migrations, err := golembic.NewSequence(golembic.Migration{Revision: "aa60f058f5f5", Tombstone: true})
+	if err != nil {
+		return nil, err
+	}
+
+	qt1 := golembic.QuoteIdentifier(t1)
+	qt2 := golembic.QuoteIdentifier(t2)
+	ct1 := fmt.Sprintf("CREATE TABLE %s ( bar TEXT, quux TEXT )", qt1)
+	ct2 := fmt.Sprintf("CREATE TABLE %s ( baz TEXT )", qt2)
+	err = migrations.RegisterManyOpt(
+		[]golembic.MigrationOption{
+			golembic.OptPrevious("aa60f058f5f5"),
+			golembic.OptRevision("ab1208989a3f"),
+			golembic.OptBaseline(true),
+			golembic.OptDescription("Create first table (squashed)"),
+			golembic.OptUpFromSQL(ct1),
+		},
+		[]golembic.MigrationOption{
+			golembic.OptPrevious("ab1208989a3f"),
+			golembic.OptRevision("60a33b9d4c77"),
+			golembic.OptDescription("Add second table"),
+			golembic.OptUpFromSQL(ct2),
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return migrations, nil
+}
+
 func anyLowercase(n int) string {
 	r := rand.New(rand.NewSource(time.Now().UTC().UnixNano()))
 	letters := []rune("abcdefghijklmnopqrstuvwxyz")
@@ -465,6 +1286,12 @@ func dropTable(ctx context.Context, pool *db.Connection, name string) error {
 	return err
 }
 
+func dropView(ctx context.Context, pool *db.Connection, name string) error {
+	statement := fmt.Sprintf("DROP VIEW IF EXISTS %s", golembic.QuoteIdentifier(name))
+	_, err := pool.Invoke(db.OptContext(ctx)).Exec(statement)
+	return err
+}
+
 type jsonNoTimestamp struct {
 	Wrapped *logger.JSONOutputFormatter
 }
@@ -0,0 +1,133 @@
+package golembic
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/blend/go-sdk/db"
+	"github.com/blend/go-sdk/db/migration"
+)
+
+// HistoryEntry is a row in the migrations metadata table, i.e. a migration
+// that has been applied, joined with the matching registered migration (if
+// any).
+type HistoryEntry struct {
+	// SerialID is the (0-based) position of the migration in the applied
+	// history.
+	SerialID uint32 `json:"serialID"`
+	// Revision is the revision of the applied migration.
+	Revision string `json:"revision"`
+	// Previous is the revision of the migration applied immediately before
+	// this one; this is empty for the root migration.
+	Previous string `json:"previous,omitempty"`
+	// CreatedAt is the moment the row was inserted into the migrations
+	// metadata table.
+	CreatedAt time.Time `json:"createdAt"`
+	// Checksum is the checksum stored when the migration was applied (if
+	// any).
+	Checksum string `json:"checksum,omitempty"`
+	// Known indicates if the revision is registered in the sequence for the
+	// manager.
+	Known bool `json:"known"`
+	// Description is the description of the registered migration; for an
+	// unknown migration, this is the description stored when it was applied
+	// (if any).
+	Description string `json:"description,omitempty"`
+	// Milestone indicates if the registered migration is a milestone.
+	Milestone bool `json:"milestone,omitempty"`
+	// Duration is the amount of time it took to apply the migration; this is
+	// zero if it wasn't recorded (e.g. for a stamped migration).
+	Duration time.Duration `json:"duration,omitempty"`
+	// AppliedBy is the database user that applied the migration.
+	AppliedBy string `json:"appliedBy,omitempty"`
+	// Hostname is the host the migration was applied from.
+	Hostname string `json:"hostname,omitempty"`
+	// AppVersion is the application version (e.g. a git SHA) that applied
+	// the migration.
+	AppVersion string `json:"appVersion,omitempty"`
+}
+
+// historyModel is a row in the migrations metadata table, including the
+// columns that record who applied a migration, from where and how long it
+// took.
+type historyModel struct {
+	SerialID    uint32    `db:"serial_id"`
+	Revision    string    `db:"revision"`
+	Previous    string    `db:"previous"`
+	CreatedAt   time.Time `db:"created_at"`
+	Checksum    string    `db:"checksum"`
+	Description string    `db:"description"`
+	DurationMS  int64     `db:"duration_ms"`
+	AppliedBy   string    `db:"applied_by"`
+	Hostname    string    `db:"hostname"`
+	AppVersion  string    `db:"app_version"`
+}
+
+// History returns all of the migrations that have been applied, in the order
+// they were applied. Each entry is joined with the registered migration
+// matching its revision; entries that don't match a registered migration
+// (e.g. applied from a newer checkout) are marked as unknown. If the
+// migrations metadata table does not exist, the history is empty.
+func (m *Manager) History(ctx context.Context, pool *db.Connection) ([]HistoryEntry, error) {
+	exists, err := migration.PredicateTableExistsInSchema(ctx, pool, nil, m.metadataSchema(pool), m.MetadataTable)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return []HistoryEntry{}, nil
+	}
+
+	// NOTE: A table created before the checksum or audit columns were added
+	//       (and not yet upgraded) can still be read.
+	columns := "serial_id, revision, previous, created_at"
+	hasChecksum, err := migration.PredicateColumnExistsInSchema(ctx, pool, nil, m.metadataSchema(pool), m.MetadataTable, checksumColumn)
+	if err != nil {
+		return nil, err
+	}
+	if hasChecksum {
+		columns += ", " + checksumColumn
+	}
+	hasAppliedBy, err := migration.PredicateColumnExistsInSchema(ctx, pool, nil, m.metadataSchema(pool), m.MetadataTable, appliedByColumn)
+	if err != nil {
+		return nil, err
+	}
+	if hasAppliedBy {
+		columns += ", description, duration_ms, applied_by, hostname, app_version"
+	}
+
+	query := fmt.Sprintf(
+		"SELECT %s FROM %s ORDER BY serial_id ASC",
+		columns,
+		m.quoteTable(m.MetadataTable),
+	)
+	var rows []historyModel
+	err = pool.Invoke(db.OptContext(ctx)).Query(query).OutMany(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]HistoryEntry, len(rows))
+	for i, row := range rows {
+		entry := HistoryEntry{
+			SerialID:    row.SerialID,
+			Revision:    row.Revision,
+			Previous:    row.Previous,
+			CreatedAt:   row.CreatedAt,
+			Checksum:    row.Checksum,
+			Description: row.Description,
+			Duration:    time.Duration(row.DurationMS) * time.Millisecond,
+			AppliedBy:   row.AppliedBy,
+			Hostname:    row.Hostname,
+			AppVersion:  row.AppVersion,
+		}
+		if registered := m.Sequence.Get(row.Revision); registered != nil {
+			entry.Known = true
+			entry.Description = registered.Description
+			entry.Milestone = registered.Milestone
+		}
+		entries[i] = entry
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,96 @@
+package golembic_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/db"
+
+	golembic "github.com/dhermes/golembic-blend"
+)
+
+func TestManager_History(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt := fmt.Sprintf("wobble_%s_migrations", suffix)
+	t1 := fmt.Sprintf("wobble1_%s", suffix)
+	t2 := fmt.Sprintf("wobble2_%s", suffix)
+	t.Cleanup(func() {
+		for _, table := range []string{mt, t1, t2} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+	})
+
+	migrations, err := makeSequence(t1, t2, 2, true)
+	it.Nil(err)
+	m, err := golembic.NewManager(
+		golembic.OptManagerSequence(migrations),
+		golembic.OptManagerMetadataTable(mt),
+		golembic.OptManagerHostname("wobble-host"),
+		golembic.OptManagerAppVersion("v1.2.3"),
+	)
+	it.Nil(err)
+
+	// No metadata table
+	history, err := m.History(ctx, pool)
+	it.Nil(err)
+	it.Equal([]golembic.HistoryEntry{}, history)
+
+	suite, err := golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+
+	// Add a row for a migration that isn't registered
+	statement := fmt.Sprintf(
+		"INSERT INTO %s (serial_id, revision, previous) VALUES (2, 'not-in-sequence', 'ab1208989a3f')",
+		golembic.QuoteIdentifier(mt),
+	)
+	_, err = pool.Invoke(db.OptContext(ctx)).Exec(statement)
+	it.Nil(err)
+
+	history, err = m.History(ctx, pool)
+	it.Nil(err)
+	it.Len(history, 3)
+	for _, entry := range history {
+		it.False(entry.CreatedAt.IsZero())
+	}
+
+	root := migrations.Get("aa60f058f5f5")
+	it.Equal(uint32(0), history[0].SerialID)
+	it.Equal("aa60f058f5f5", history[0].Revision)
+	it.Equal("", history[0].Previous)
+	it.Equal(root.Checksum, history[0].Checksum)
+	it.True(history[0].Known)
+	it.Equal("Create first table", history[0].Description)
+	it.False(history[0].Milestone)
+	it.Equal(pool.Config.Username, history[0].AppliedBy)
+	it.Equal("wobble-host", history[0].Hostname)
+	it.Equal("v1.2.3", history[0].AppVersion)
+	it.True(history[0].Duration >= 0)
+
+	it.Equal(uint32(1), history[1].SerialID)
+	it.Equal("ab1208989a3f", history[1].Revision)
+	it.Equal("aa60f058f5f5", history[1].Previous)
+	it.True(history[1].Known)
+	it.Equal("Alter first table", history[1].Description)
+	it.True(history[1].Milestone)
+
+	it.Equal(uint32(2), history[2].SerialID)
+	it.Equal("not-in-sequence", history[2].Revision)
+	it.Equal("ab1208989a3f", history[2].Previous)
+	it.Equal("", history[2].Checksum)
+	it.False(history[2].Known)
+	it.Equal("", history[2].Description)
+	it.Equal("", history[2].AppliedBy)
+	it.Equal("", history[2].Hostname)
+	it.Equal(time.Duration(0), history[2].Duration)
+}
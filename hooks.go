@@ -0,0 +1,124 @@
+package golembic
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/blend/go-sdk/db"
+	"github.com/blend/go-sdk/db/migration"
+	"github.com/blend/go-sdk/ex"
+)
+
+// NOTE: Ensure that
+//       * `planAction` satisfies `completer`.
+//       * `singleTransactionAction` satisfies `completer`.
+var (
+	_ completer = (*planAction)(nil)
+	_ completer = (*singleTransactionAction)(nil)
+)
+
+// Hooks are functions invoked at points in the lifecycle of applying
+// migrations, e.g. to push deploy annotations or record timings. Hooks of
+// each kind are invoked in the order they were registered. Hooks are not
+// invoked in a dry run.
+type Hooks struct {
+	// BeforePlan hooks are invoked before determining the migrations that
+	// need to be applied. An error stops the run before anything is planned.
+	BeforePlan []BeforePlanHook
+	// AfterPlan hooks are invoked with the migrations in the sequence that
+	// will be applied (repeatable migrations are planned separately, after
+	// the sequence has been applied). An error stops the run before any
+	// migration is applied.
+	AfterPlan []AfterPlanHook
+	// BeforeMigration hooks are invoked before each migration is applied, in
+	// the transaction used for the migration. An error vetoes the migration.
+	BeforeMigration []BeforeMigrationHook
+	// AfterMigration hooks are invoked after each migration is applied (or
+	// fails), in the transaction used for the migration. An error fails a
+	// migration that was otherwise applied, so the transaction is rolled
+	// back. Since the hooks are invoked before the transaction is committed,
+	// a migration may still be rolled back after the hooks see it succeed,
+	// e.g. in single transaction mode when a later migration fails; the
+	// `OnComplete` hooks receive the error in that case.
+	AfterMigration []AfterMigrationHook
+	// OnComplete hooks are invoked once a run is done, whether or not it
+	// succeeded.
+	OnComplete []CompleteHook
+}
+
+// beforePlan invokes each of the `BeforePlan` hooks.
+func (h Hooks) beforePlan(ctx context.Context, pool *db.Connection, tx *sql.Tx) error {
+	for _, hook := range h.BeforePlan {
+		err := hook(ctx, pool, tx)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// afterPlan invokes each of the `AfterPlan` hooks.
+func (h Hooks) afterPlan(ctx context.Context, pool *db.Connection, tx *sql.Tx, migrations []Migration) error {
+	for _, hook := range h.AfterPlan {
+		err := hook(ctx, pool, tx, migrations)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// beforeMigration invokes each of the `BeforeMigration` hooks. If a hook
+// returns an error, the migration is vetoed.
+func (h Hooks) beforeMigration(ctx context.Context, pool *db.Connection, tx *sql.Tx, mi Migration) error {
+	for _, hook := range h.BeforeMigration {
+		err := hook(ctx, pool, tx, mi)
+		if err != nil {
+			return ex.New(ErrMigrationVetoed, ex.OptMessagef("Revision: %q", mi.Revision), ex.OptInner(err))
+		}
+	}
+	return nil
+}
+
+// afterMigration invokes each of the `AfterMigration` hooks.
+func (h Hooks) afterMigration(ctx context.Context, pool *db.Connection, tx *sql.Tx, mi Migration, duration time.Duration, applyErr error) error {
+	for _, hook := range h.AfterMigration {
+		err := hook(ctx, pool, tx, mi, duration, applyErr)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// complete invokes each of the `OnComplete` hooks.
+func (h Hooks) complete(ctx context.Context, pool *db.Connection, err error) {
+	for _, hook := range h.OnComplete {
+		hook(ctx, pool, err)
+	}
+}
+
+// complete invokes the `OnComplete` hooks of the manager.
+func (pa *planAction) complete(ctx context.Context, pool *db.Connection, err error) {
+	if pa.m.DryRun {
+		return
+	}
+	pa.m.Hooks.complete(ctx, pool, err)
+}
+
+// complete invokes the `OnComplete` hooks of the manager.
+func (sta *singleTransactionAction) complete(ctx context.Context, pool *db.Connection, err error) {
+	sta.m.Hooks.complete(ctx, pool, err)
+}
+
+// completeGroups notifies the actions in a suite that the suite is done.
+func completeGroups(ctx context.Context, s *migration.Suite, pool *db.Connection, err error) {
+	for _, group := range s.Groups {
+		for _, action := range group.Actions {
+			if c, ok := action.(completer); ok {
+				c.complete(ctx, pool, err)
+			}
+		}
+	}
+}
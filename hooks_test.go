@@ -0,0 +1,194 @@
+package golembic_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/db"
+	"github.com/blend/go-sdk/logger"
+
+	golembic "github.com/dhermes/golembic-blend"
+)
+
+func TestOptManagerHooks(t *testing.T) {
+	it := assert.New(t)
+
+	beforePlan := func(context.Context, *db.Connection, *sql.Tx) error { return nil }
+	afterPlan := func(context.Context, *db.Connection, *sql.Tx, []golembic.Migration) error { return nil }
+	beforeMigration := func(context.Context, *db.Connection, *sql.Tx, golembic.Migration) error { return nil }
+	afterMigration := func(context.Context, *db.Connection, *sql.Tx, golembic.Migration, time.Duration, error) error {
+		return nil
+	}
+	onComplete := func(context.Context, *db.Connection, error) {}
+	m, err := golembic.NewManager(
+		golembic.OptManagerBeforePlan(beforePlan),
+		golembic.OptManagerAfterPlan(afterPlan),
+		golembic.OptManagerBeforeMigration(beforeMigration),
+		golembic.OptManagerBeforeMigration(beforeMigration),
+		golembic.OptManagerAfterMigration(afterMigration),
+		golembic.OptManagerOnComplete(onComplete),
+	)
+	it.Nil(err)
+	it.Len(m.Hooks.BeforePlan, 1)
+	it.Len(m.Hooks.AfterPlan, 1)
+	it.Len(m.Hooks.BeforeMigration, 2)
+	it.Len(m.Hooks.AfterMigration, 1)
+	it.Len(m.Hooks.OnComplete, 1)
+
+	m, err = golembic.NewManager(golembic.OptManagerBeforeMigration(nil))
+	it.Nil(m)
+	it.Equal("Value satisfying interface was nil", fmt.Sprintf("%v", err))
+
+	m, err = golembic.NewManager(golembic.OptManagerOnComplete(nil))
+	it.Nil(m)
+	it.Equal("Value satisfying interface was nil", fmt.Sprintf("%v", err))
+}
+
+func TestGenerateSuite_Hooks(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt := fmt.Sprintf("pie_%s_migrations", suffix)
+	t1 := fmt.Sprintf("pie1_%s", suffix)
+	t2 := fmt.Sprintf("pie2_%s", suffix)
+	t.Cleanup(func() {
+		for _, table := range []string{mt, t1, t2} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+	})
+	var logBuffer bytes.Buffer
+	log := logger.Memory(&logBuffer)
+
+	createTable := func(table string) golembic.UpMigration {
+		return func(ctx context.Context, pool *db.Connection, tx *sql.Tx) error {
+			_, err := pool.Invoke(db.OptContext(ctx), db.OptTx(tx)).Exec(
+				fmt.Sprintf("CREATE TABLE %s ( bar TEXT )", golembic.QuoteIdentifier(table)),
+			)
+			return err
+		}
+	}
+	migrations, err := golembic.NewSequence(golembic.Migration{
+		Revision:    "c9b52448285b",
+		Description: "Create first table",
+		Up:          createTable(t1),
+	})
+	it.Nil(err)
+
+	var calls []string
+	veto := ""
+	m, err := golembic.NewManager(
+		golembic.OptManagerSequence(migrations),
+		golembic.OptManagerMetadataTable(mt),
+		golembic.OptManagerLog(log),
+		golembic.OptManagerBeforePlan(func(_ context.Context, _ *db.Connection, tx *sql.Tx) error {
+			calls = append(calls, fmt.Sprintf("before plan (tx: %t)", tx != nil))
+			return nil
+		}),
+		golembic.OptManagerAfterPlan(func(_ context.Context, _ *db.Connection, _ *sql.Tx, pending []golembic.Migration) error {
+			revisions := []string{}
+			for _, mi := range pending {
+				revisions = append(revisions, mi.Revision)
+			}
+			calls = append(calls, fmt.Sprintf("after plan %v", revisions))
+			return nil
+		}),
+		golembic.OptManagerBeforeMigration(func(_ context.Context, _ *db.Connection, tx *sql.Tx, mi golembic.Migration) error {
+			calls = append(calls, fmt.Sprintf("before %s (tx: %t)", mi.Revision, tx != nil))
+			if mi.Revision == veto {
+				return errors.New("deploy freeze")
+			}
+			return nil
+		}),
+		golembic.OptManagerAfterMigration(func(_ context.Context, _ *db.Connection, _ *sql.Tx, mi golembic.Migration, d time.Duration, err error) error {
+			calls = append(calls, fmt.Sprintf("after %s (timed: %t, err: %v)", mi.Revision, d > 0, err))
+			return nil
+		}),
+		golembic.OptManagerOnComplete(func(_ context.Context, _ *db.Connection, err error) {
+			calls = append(calls, fmt.Sprintf("complete (err: %v)", err))
+		}),
+	)
+	it.Nil(err)
+
+	suite, err := golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	expected := []string{
+		"before plan (tx: true)",
+		"after plan [c9b52448285b]",
+		"before c9b52448285b (tx: true)",
+		"after c9b52448285b (timed: true, err: <nil>)",
+		"complete (err: <nil>)",
+	}
+	it.Equal(expected, calls)
+	logLines := []string{
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 1: Create migrations metadata table", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 2: Add checksum column", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 3: Add description, duration_ms, applied_by, hostname and app_version columns", mt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- c9b52448285b -- Create first table",
+		"[db.migration.stats] 2 applied 0 skipped 0 failed 2 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// A hook can veto a migration, in which case it is not applied
+	err = migrations.RegisterManyOpt([]golembic.MigrationOption{
+		golembic.OptPrevious("c9b52448285b"),
+		golembic.OptRevision("0ffd5f8d0c8a"),
+		golembic.OptDescription("Create second table"),
+		golembic.OptUp(createTable(t2)),
+	})
+	it.Nil(err)
+	calls = nil
+	veto = "0ffd5f8d0c8a"
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	vetoed := "Migration vetoed by hook; Revision: \"0ffd5f8d0c8a\"\ndeploy freeze"
+	it.Equal(vetoed, fmt.Sprintf("%v", err))
+	expected = []string{
+		"before plan (tx: true)",
+		"after plan [0ffd5f8d0c8a]",
+		"before 0ffd5f8d0c8a (tx: true)",
+		"complete (err: " + vetoed + ")",
+	}
+	it.Equal(expected, calls)
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- 0ffd5f8d0c8a -- Create second table",
+		"[db.migration.stats] 0 applied 1 skipped 1 failed 2 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// Once the veto is lifted, the migration is applied
+	calls = nil
+	veto = ""
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	expected = []string{
+		"before plan (tx: true)",
+		"after plan [0ffd5f8d0c8a]",
+		"before 0ffd5f8d0c8a (tx: true)",
+		"after 0ffd5f8d0c8a (timed: true, err: <nil>)",
+		"complete (err: <nil>)",
+	}
+	it.Equal(expected, calls)
+}
@@ -0,0 +1,144 @@
+package golembic
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// SpanPlan is the name of the span covering the planning of the
+	// migrations that need to be applied.
+	SpanPlan = "golembic.plan"
+	// SpanApply is the name of the span covering a single migration being
+	// applied.
+	SpanApply = "golembic.apply"
+
+	// MetricApplied is the name of the counter incremented when a migration
+	// is applied.
+	MetricApplied = "golembic.migrations.applied"
+	// MetricFailed is the name of the counter incremented when a migration
+	// fails.
+	MetricFailed = "golembic.migrations.failed"
+	// MetricRolledBack is the name of the counter incremented when a
+	// migration that was applied (and counted by `MetricApplied`) is rolled
+	// back, i.e. when a single transaction fails.
+	MetricRolledBack = "golembic.migrations.rolled_back"
+	// MetricDuration is the name of the histogram recording the time (in
+	// milliseconds) taken to apply a migration, whether or not it succeeded.
+	MetricDuration = "golembic.migration.duration_ms"
+
+	// AttributeRevision is the attribute key for the revision of a migration.
+	AttributeRevision = "golembic.revision"
+	// AttributeDescription is the attribute key for the description of a
+	// migration.
+	AttributeDescription = "golembic.description"
+	// AttributeMilestone is the attribute key indicating if a migration is a
+	// milestone.
+	AttributeMilestone = "golembic.milestone"
+	// AttributeRepeatable is the attribute key indicating if a migration is
+	// repeatable.
+	AttributeRepeatable = "golembic.repeatable"
+	// AttributePending is the attribute key for the number of migrations that
+	// were planned.
+	AttributePending = "golembic.pending"
+)
+
+// Attribute is a key-value pair attached to a span or a metric. The value
+// will be a `string`, `bool` or `int`.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// Tracer starts spans. It is intentionally small so that it can be backed by
+// OpenTelemetry (or any other tracing library) or by an in-memory
+// implementation in tests.
+type Tracer interface {
+	// Start starts a span as a child of any span in `ctx` and returns a
+	// context containing the new span.
+	Start(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span)
+}
+
+// Span is a single operation started by a `Tracer`.
+type Span interface {
+	// SetAttributes adds attributes to the span.
+	SetAttributes(attributes ...Attribute)
+	// RecordError records that the operation failed.
+	RecordError(err error)
+	// End completes the span.
+	End()
+}
+
+// Meter records metrics. As with `Tracer`, it is intentionally small so that
+// it can be backed by any metrics library.
+type Meter interface {
+	// Count adds `value` to the counter `name`.
+	Count(ctx context.Context, name string, value int64, attributes ...Attribute)
+	// Record records `value` in the histogram `name`.
+	Record(ctx context.Context, name string, value float64, attributes ...Attribute)
+}
+
+// noopSpan is the span used when a manager has no tracer.
+type noopSpan struct{}
+
+// SetAttributes is a no-op.
+func (noopSpan) SetAttributes(...Attribute) {}
+
+// RecordError is a no-op.
+func (noopSpan) RecordError(error) {}
+
+// End is a no-op.
+func (noopSpan) End() {}
+
+// migrationAttributes returns the attributes that describe a migration.
+func migrationAttributes(mi Migration, repeatable bool) []Attribute {
+	return []Attribute{
+		{Key: AttributeRevision, Value: mi.Revision},
+		{Key: AttributeDescription, Value: mi.Description},
+		{Key: AttributeMilestone, Value: mi.Milestone},
+		{Key: AttributeRepeatable, Value: repeatable},
+	}
+}
+
+// startSpan starts a span with the tracer of the manager (if any).
+func (m *Manager) startSpan(ctx context.Context, name string, attributes ...Attribute) (context.Context, Span) {
+	if m.Tracer == nil {
+		return ctx, noopSpan{}
+	}
+
+	return m.Tracer.Start(ctx, name, attributes...)
+}
+
+// endSpan records `err` (if any) on a span and then ends it.
+func endSpan(span Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// recordApply records the metrics for a migration that was applied (or
+// failed) with the meter of the manager (if any).
+func (m *Manager) recordApply(ctx context.Context, mi Migration, repeatable bool, duration time.Duration, err error) {
+	if m.Meter == nil {
+		return
+	}
+
+	attributes := migrationAttributes(mi, repeatable)
+	if err != nil {
+		m.Meter.Count(ctx, MetricFailed, 1, attributes...)
+	} else {
+		m.Meter.Count(ctx, MetricApplied, 1, attributes...)
+	}
+	m.Meter.Record(ctx, MetricDuration, float64(duration)/float64(time.Millisecond), attributes...)
+}
+
+// recordRollback records the metrics for a migration that was applied and
+// then rolled back with the meter of the manager (if any).
+func (m *Manager) recordRollback(ctx context.Context, mi Migration, repeatable bool) {
+	if m.Meter == nil {
+		return
+	}
+
+	m.Meter.Count(ctx, MetricRolledBack, 1, migrationAttributes(mi, repeatable)...)
+}
@@ -0,0 +1,246 @@
+package golembic_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/db"
+	"github.com/blend/go-sdk/logger"
+
+	golembic "github.com/dhermes/golembic-blend"
+)
+
+// memorySpan is a span recorded by `memoryTracer`.
+type memorySpan struct {
+	Name       string
+	Attributes map[string]interface{}
+	Err        error
+	Ended      bool
+}
+
+func (ms *memorySpan) SetAttributes(attributes ...golembic.Attribute) {
+	for _, attribute := range attributes {
+		ms.Attributes[attribute.Key] = attribute.Value
+	}
+}
+
+func (ms *memorySpan) RecordError(err error) {
+	ms.Err = err
+}
+
+func (ms *memorySpan) End() {
+	ms.Ended = true
+}
+
+// memoryTracer records every span started.
+type memoryTracer struct {
+	Spans []*memorySpan
+}
+
+func (mt *memoryTracer) Start(ctx context.Context, name string, attributes ...golembic.Attribute) (context.Context, golembic.Span) {
+	span := &memorySpan{Name: name, Attributes: map[string]interface{}{}}
+	span.SetAttributes(attributes...)
+	mt.Spans = append(mt.Spans, span)
+	return ctx, span
+}
+
+// memoryMeter records every counter and histogram value by name and revision.
+type memoryMeter struct {
+	Counts     map[string]int64
+	Histograms map[string][]float64
+}
+
+func metricKey(name string, attributes []golembic.Attribute) string {
+	for _, attribute := range attributes {
+		if attribute.Key == golembic.AttributeRevision {
+			return fmt.Sprintf("%s:%v", name, attribute.Value)
+		}
+	}
+	return name
+}
+
+func (mm *memoryMeter) Count(_ context.Context, name string, value int64, attributes ...golembic.Attribute) {
+	mm.Counts[metricKey(name, attributes)] += value
+}
+
+func (mm *memoryMeter) Record(_ context.Context, name string, value float64, attributes ...golembic.Attribute) {
+	key := metricKey(name, attributes)
+	mm.Histograms[key] = append(mm.Histograms[key], value)
+}
+
+func TestOptManagerTracer(t *testing.T) {
+	it := assert.New(t)
+
+	tracer := &memoryTracer{}
+	meter := &memoryMeter{}
+	m, err := golembic.NewManager(golembic.OptManagerTracer(tracer), golembic.OptManagerMeter(meter))
+	it.Nil(err)
+	it.Equal(tracer, m.Tracer)
+	it.Equal(meter, m.Meter)
+
+	m, err = golembic.NewManager(golembic.OptManagerTracer(nil))
+	it.Nil(m)
+	it.Equal("Value satisfying interface was nil", fmt.Sprintf("%v", err))
+
+	m, err = golembic.NewManager(golembic.OptManagerMeter(nil))
+	it.Nil(m)
+	it.Equal("Value satisfying interface was nil", fmt.Sprintf("%v", err))
+}
+
+func TestGenerateSuite_Instrumentation(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt := fmt.Sprintf("tart_%s_migrations", suffix)
+	t1 := fmt.Sprintf("tart1_%s", suffix)
+	t.Cleanup(func() {
+		for _, table := range []string{mt, t1} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+	})
+
+	migrations, err := golembic.NewSequence(golembic.Migration{
+		Revision:    "5e2bd0a1c3f7",
+		Description: "Create first table",
+		Milestone:   true,
+		Up: func(ctx context.Context, pool *db.Connection, tx *sql.Tx) error {
+			_, err := pool.Invoke(db.OptContext(ctx), db.OptTx(tx)).Exec(
+				fmt.Sprintf("CREATE TABLE %s ( bar TEXT )", golembic.QuoteIdentifier(t1)),
+			)
+			return err
+		},
+	})
+	it.Nil(err)
+	err = migrations.RegisterManyOpt([]golembic.MigrationOption{
+		golembic.OptPrevious("5e2bd0a1c3f7"),
+		golembic.OptRevision("71d4c8e9b0a2"),
+		golembic.OptDescription("Fail to alter first table"),
+		golembic.OptUp(func(context.Context, *db.Connection, *sql.Tx) error {
+			return errors.New("boom")
+		}),
+	})
+	it.Nil(err)
+
+	var logBuffer bytes.Buffer
+	tracer := &memoryTracer{}
+	meter := &memoryMeter{Counts: map[string]int64{}, Histograms: map[string][]float64{}}
+	m, err := golembic.NewManager(
+		golembic.OptManagerSequence(migrations),
+		golembic.OptManagerMetadataTable(mt),
+		golembic.OptManagerLog(logger.Memory(&logBuffer)),
+		golembic.OptManagerTracer(tracer),
+		golembic.OptManagerMeter(meter),
+	)
+	it.Nil(err)
+
+	suite, err := golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Equal("boom", fmt.Sprintf("%v", err))
+
+	it.Len(tracer.Spans, 3)
+	plan := tracer.Spans[0]
+	it.Equal(golembic.SpanPlan, plan.Name)
+	it.Equal(map[string]interface{}{golembic.AttributePending: 2}, plan.Attributes)
+	it.Nil(plan.Err)
+	it.True(plan.Ended)
+
+	applied := tracer.Spans[1]
+	it.Equal(golembic.SpanApply, applied.Name)
+	expected := map[string]interface{}{
+		golembic.AttributeRevision:    "5e2bd0a1c3f7",
+		golembic.AttributeDescription: "Create first table",
+		golembic.AttributeMilestone:   true,
+		golembic.AttributeRepeatable:  false,
+	}
+	it.Equal(expected, applied.Attributes)
+	it.Nil(applied.Err)
+	it.True(applied.Ended)
+
+	failed := tracer.Spans[2]
+	it.Equal(golembic.SpanApply, failed.Name)
+	it.Equal("71d4c8e9b0a2", failed.Attributes[golembic.AttributeRevision])
+	it.Equal(false, failed.Attributes[golembic.AttributeMilestone])
+	it.Equal("boom", fmt.Sprintf("%v", failed.Err))
+	it.True(failed.Ended)
+
+	expectedCounts := map[string]int64{
+		golembic.MetricApplied + ":5e2bd0a1c3f7": 1,
+		golembic.MetricFailed + ":71d4c8e9b0a2":  1,
+	}
+	it.Equal(expectedCounts, meter.Counts)
+	it.Len(meter.Histograms, 2)
+	it.Len(meter.Histograms[golembic.MetricDuration+":5e2bd0a1c3f7"], 1)
+	it.Len(meter.Histograms[golembic.MetricDuration+":71d4c8e9b0a2"], 1)
+}
+
+func TestGenerateSuite_InstrumentationRollback(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt := fmt.Sprintf("pear_%s_migrations", suffix)
+	t1 := fmt.Sprintf("pear1_%s", suffix)
+	t.Cleanup(func() {
+		for _, table := range []string{mt, t1} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+	})
+
+	migrations, err := golembic.NewSequence(golembic.Migration{
+		Revision:    "5e2bd0a1c3f7",
+		Description: "Create first table",
+		Up: func(ctx context.Context, pool *db.Connection, tx *sql.Tx) error {
+			_, err := pool.Invoke(db.OptContext(ctx), db.OptTx(tx)).Exec(
+				fmt.Sprintf("CREATE TABLE %s ( bar TEXT )", golembic.QuoteIdentifier(t1)),
+			)
+			return err
+		},
+	})
+	it.Nil(err)
+	err = migrations.RegisterManyOpt([]golembic.MigrationOption{
+		golembic.OptPrevious("5e2bd0a1c3f7"),
+		golembic.OptRevision("71d4c8e9b0a2"),
+		golembic.OptDescription("Fail to alter first table"),
+		golembic.OptUp(func(context.Context, *db.Connection, *sql.Tx) error {
+			return errors.New("boom")
+		}),
+	})
+	it.Nil(err)
+
+	var logBuffer bytes.Buffer
+	meter := &memoryMeter{Counts: map[string]int64{}, Histograms: map[string][]float64{}}
+	m, err := golembic.NewManager(
+		golembic.OptManagerSequence(migrations),
+		golembic.OptManagerMetadataTable(mt),
+		golembic.OptManagerLog(logger.Memory(&logBuffer)),
+		golembic.OptManagerMeter(meter),
+		golembic.OptManagerSingleTransaction(true),
+	)
+	it.Nil(err)
+
+	suite, err := golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Equal("boom", fmt.Sprintf("%v", err))
+
+	// The migration that was applied is counted again once it is rolled back
+	expectedCounts := map[string]int64{
+		golembic.MetricApplied + ":5e2bd0a1c3f7":    1,
+		golembic.MetricRolledBack + ":5e2bd0a1c3f7": 1,
+		golembic.MetricFailed + ":71d4c8e9b0a2":     1,
+	}
+	it.Equal(expectedCounts, meter.Counts)
+}
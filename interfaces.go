@@ -3,6 +3,7 @@ package golembic
 import (
 	"context"
 	"database/sql"
+	"time"
 
 	"github.com/blend/go-sdk/db"
 )
@@ -24,6 +25,31 @@ type UpMigration = func(context.Context, *db.Connection, *sql.Tx) error
 // should only be used in rare situations.
 type UpMigrationConn = func(context.Context, *db.Connection) error
 
+// DoneCheck defines a function interface used to determine if the work of a
+// non-transactional migration has already been carried out, e.g. by an
+// earlier attempt that was interrupted before the migration was recorded.
+type DoneCheck = func(context.Context, *db.Connection) (bool, error)
+
+// BeforePlanHook defines a function interface invoked before the migrations
+// that need to be applied are determined.
+type BeforePlanHook = func(context.Context, *db.Connection, *sql.Tx) error
+
+// AfterPlanHook defines a function interface invoked with the migrations that
+// will be applied.
+type AfterPlanHook = func(context.Context, *db.Connection, *sql.Tx, []Migration) error
+
+// BeforeMigrationHook defines a function interface invoked before a migration
+// is applied. Returning an error vetoes the migration.
+type BeforeMigrationHook = func(context.Context, *db.Connection, *sql.Tx, Migration) error
+
+// AfterMigrationHook defines a function interface invoked after a migration
+// is applied, with the time taken and the error (if any) from applying it.
+type AfterMigrationHook = func(context.Context, *db.Connection, *sql.Tx, Migration, time.Duration, error) error
+
+// CompleteHook defines a function interface invoked once applying migrations
+// is done, with the error (if any) that stopped it.
+type CompleteHook = func(context.Context, *db.Connection, error)
+
 // migrationsFilter defines a function interface that filters migrations
 // based on the `latest` revision. It's expected that a migrations filter
 // will enclose other state such as a `Manager`. In addition to returning
@@ -31,6 +57,26 @@ type UpMigrationConn = func(context.Context, *db.Connection) error
 // number of existing migrations that were filtered out.
 type migrationsFilter = func(latest string) (int, []Migration, error)
 
+// releaser is implemented by actions that hold a resource (e.g. an advisory
+// lock) that must be released once a suite is done, whether or not it
+// succeeded.
+type releaser interface {
+	release(ctx context.Context)
+}
+
+// completer is implemented by actions that need to be notified once a suite
+// is done, whether or not it succeeded.
+type completer interface {
+	complete(ctx context.Context, pool *db.Connection, err error)
+}
+
+// rollbacker is implemented by actions that need to account for their work
+// being rolled back, i.e. when the group containing the action fails
+// (including when the transaction for the group fails to commit).
+type rollbacker interface {
+	rollback(ctx context.Context)
+}
+
 // ManagerOption describes options used to create a new manager.
 type ManagerOption = func(*Manager) error
 
@@ -39,3 +85,9 @@ type MigrationOption = func(*Migration) error
 
 // ApplyOption describes options used to create an apply configuration.
 type ApplyOption = func(*ApplyConfig) error
+
+// ScaffoldOption describes options used to create a new migration scaffold.
+type ScaffoldOption = func(*Scaffold) error
+
+// CoordinatorOption describes options used to create a new coordinator.
+type CoordinatorOption = func(*Coordinator) error
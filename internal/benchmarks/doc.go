@@ -0,0 +1,4 @@
+// Package benchmarks contains benchmarks for `golembic` that do not need a
+// database. They are kept apart from the package tests (which require
+// PostgreSQL) so they can be run anywhere, e.g. via `make bench`.
+package benchmarks
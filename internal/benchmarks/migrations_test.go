@@ -0,0 +1,110 @@
+package benchmarks_test
+
+import (
+	"fmt"
+	"testing"
+
+	golembic "github.com/dhermes/golembic-blend"
+)
+
+var sizes = []int{100, 1000, 10000}
+
+func BenchmarkMigrations_All(b *testing.B) {
+	for _, size := range sizes {
+		migrations := benchmarkSequence(b, size)
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_ = migrations.All()
+			}
+		})
+	}
+}
+
+func BenchmarkMigrations_Since(b *testing.B) {
+	for _, size := range sizes {
+		migrations := benchmarkSequence(b, size)
+		middle := revision(size / 2)
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				_, _, err := migrations.Since(middle)
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMigrations_Register(b *testing.B) {
+	for _, size := range sizes {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				// NOTE: Calling `All()` once the whole sequence is registered
+				//       includes the cost of computing the cached order.
+				_ = benchmarkSequence(b, size).All()
+			}
+		})
+	}
+}
+
+func BenchmarkMigrations_RegisterThenAll(b *testing.B) {
+	// NOTE: The largest size is left out since this is quadratic overall.
+	for _, size := range sizes[:len(sizes)-1] {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				// NOTE: Calling `All()` after each `Register()` includes the
+				//       cost of invalidating (and recomputing) the cached
+				//       order every time. Each recomputation is linear in the
+				//       size of the sequence, so this is quadratic overall.
+				migrations := benchmarkRoot(b)
+				for j := 1; j < size; j++ {
+					benchmarkRegister(b, migrations, j)
+					_ = migrations.All()
+				}
+			}
+		})
+	}
+}
+
+// benchmarkSequence creates a sequence of `size` migrations with revisions
+// `000000000000`, `000000000001`, etc.
+func benchmarkSequence(b *testing.B, size int) *golembic.Migrations {
+	b.Helper()
+
+	migrations := benchmarkRoot(b)
+	for i := 1; i < size; i++ {
+		benchmarkRegister(b, migrations, i)
+	}
+
+	return migrations
+}
+
+// benchmarkRoot creates a sequence containing only the root migration.
+func benchmarkRoot(b *testing.B) *golembic.Migrations {
+	b.Helper()
+
+	migrations, err := golembic.NewSequence(golembic.Migration{Revision: revision(0)})
+	if err != nil {
+		b.Fatal(err)
+	}
+	return migrations
+}
+
+// benchmarkRegister registers the `i`-th migration in a sequence.
+func benchmarkRegister(b *testing.B, migrations *golembic.Migrations, i int) {
+	b.Helper()
+
+	migration := golembic.Migration{
+		Previous: revision(i - 1),
+		Revision: revision(i),
+	}
+	err := migrations.Register(migration)
+	if err != nil {
+		b.Fatal(err)
+	}
+}
+
+// revision returns the revision of the `i`-th migration in a sequence.
+func revision(i int) string {
+	return fmt.Sprintf("%012x", i)
+}
@@ -0,0 +1,346 @@
+package golembic
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/blend/go-sdk/ex"
+)
+
+const (
+	sqlFileExtension  = ".sql"
+	headerPrefix      = "--"
+	headerRevision    = "revision"
+	headerPrevious    = "previous"
+	headerDescription = "description"
+	headerMilestone   = "milestone"
+	headerTransaction = "transactional"
+	headerBaseline    = "baseline"
+	headerTombstone   = "tombstone"
+)
+
+// LoadSequence reads all `.sql` files in `dir` (non-recursively) and builds
+// a sequence of migrations from them. Each file must start with a header
+// made of SQL comments that provide the metadata for the migration, e.g.
+//
+//   -- revision: 464bc456c630
+//   -- previous: 3f34bd961f15
+//   -- description: Seed data in users table
+//   -- milestone: false
+//   -- transactional: true
+//
+//   INSERT INTO users (user_id, username) VALUES (0, 'root');
+//
+// Only `revision` is required; the root migration is the (unique) one without
+// a `previous`. If `transactional` is `false`, the SQL will be run via `UpConn`
+// rather than `Up`. A file with `baseline: true` contains the squashed SQL for
+// every migration through its revision and a file with `tombstone: true` has
+// no SQL (it has been squashed into a later baseline). The header ends at the
+// first line that is not a comment and everything after the header is the SQL
+// statement for the migration.
+//
+// The order of the files within `dir` does not matter; migrations are
+// registered by following the `previous` links from the root. If two files
+// have the same `previous` (e.g. after a merge conflict), an error describing
+// both branches is returned; see `Rebase()` for resolving this.
+func LoadSequence(fsys fs.FS, dir string) (*Migrations, error) {
+	ms, err := LoadMigrations(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	err = ValidateLinear(ms)
+	if err != nil {
+		return nil, err
+	}
+
+	return sequenceFromUnordered(ms)
+}
+
+// LoadMigrations reads all `.sql` files in `dir` (non-recursively) and parses
+// each of them into a migration, in the order of the file names. See
+// `LoadSequence()` for a description of the file format.
+func LoadMigrations(fsys fs.FS, dir string) ([]Migration, error) {
+	files, err := loadMigrationFiles(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	ms := make([]Migration, len(files))
+	for i, file := range files {
+		ms[i] = file.Migration
+	}
+	return ms, nil
+}
+
+// migrationFile is a parsed SQL migration file.
+type migrationFile struct {
+	Filename  string
+	Contents  []byte
+	Migration Migration
+}
+
+func loadMigrationFiles(fsys fs.FS, dir string) ([]migrationFile, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []migrationFile{}
+	for _, entry := range entries {
+		if entry.IsDir() || path.Ext(entry.Name()) != sqlFileExtension {
+			continue
+		}
+
+		filename := path.Join(dir, entry.Name())
+		contents, err := fs.ReadFile(fsys, filename)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, err := ParseMigration(filename, contents)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, migrationFile{Filename: filename, Contents: contents, Migration: *migration})
+	}
+
+	if len(files) == 0 {
+		err = ex.New(ErrNoMigrations, ex.OptMessagef("Directory: %q", dir))
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// ParseMigration parses the contents of a SQL migration file into a
+// migration. The `filename` is only used to provide context in errors. See
+// `LoadSequence()` for a description of the file format.
+func ParseMigration(filename string, contents []byte) (*Migration, error) {
+	header, statement, err := parseHeader(filename, contents)
+	if err != nil {
+		return nil, err
+	}
+
+	revision, ok := header[headerRevision]
+	if !ok {
+		err = ex.New(ErrInvalidMigrationFile, ex.OptMessagef("File: %q, missing %q header", filename, headerRevision))
+		return nil, err
+	}
+
+	milestone, err := parseHeaderBool(filename, header, headerMilestone, false)
+	if err != nil {
+		return nil, err
+	}
+
+	transactional, err := parseHeaderBool(filename, header, headerTransaction, true)
+	if err != nil {
+		return nil, err
+	}
+
+	baseline, err := parseHeaderBool(filename, header, headerBaseline, false)
+	if err != nil {
+		return nil, err
+	}
+
+	tombstone, err := parseHeaderBool(filename, header, headerTombstone, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if baseline && tombstone {
+		err = ex.New(ErrInvalidMigrationFile, ex.OptMessagef("File: %q, cannot be both a baseline and a tombstone", filename))
+		return nil, err
+	}
+
+	opts := []MigrationOption{
+		OptPrevious(header[headerPrevious]),
+		OptRevision(revision),
+		OptDescription(header[headerDescription]),
+		OptMilestone(milestone),
+		OptBaseline(baseline),
+		OptTombstone(tombstone),
+	}
+	if tombstone {
+		if strings.TrimSpace(statement) != "" {
+			err = ex.New(ErrInvalidMigrationFile, ex.OptMessagef("File: %q, a tombstone cannot contain SQL", filename))
+			return nil, err
+		}
+	} else if transactional {
+		opts = append(opts, OptUpFromSQL(statement))
+	} else {
+		opts = append(opts, OptUpConnFromSQL(statement))
+	}
+
+	return NewMigration(opts...)
+}
+
+// parseHeader splits the contents of a SQL migration file into the
+// key-value pairs in the header and the SQL statement that follows the
+// header. Comments in the header that are not of the form `-- key: value`
+// (for a known key) are ignored.
+func parseHeader(filename string, contents []byte) (map[string]string, string, error) {
+	header := map[string]string{}
+	rest := contents
+	for len(rest) > 0 {
+		line, next := rest, rest[len(rest):]
+		if i := bytes.IndexByte(rest, '\n'); i > -1 {
+			line, next = rest[:i], rest[i+1:]
+		}
+
+		trimmed := strings.TrimSpace(string(line))
+		if trimmed != "" && !strings.HasPrefix(trimmed, headerPrefix) {
+			break
+		}
+		rest = next
+
+		key, value, ok := parseHeaderLine(trimmed)
+		if !ok {
+			continue
+		}
+
+		if _, exists := header[key]; exists {
+			err := ex.New(ErrInvalidMigrationFile, ex.OptMessagef("File: %q, duplicate %q header", filename, key))
+			return nil, "", err
+		}
+		header[key] = value
+	}
+
+	return header, string(rest), nil
+}
+
+// replaceHeader replaces the value of the header `key` in the contents of a
+// SQL migration file. If `key` is not present in the header, `ok` will be
+// false and the contents will be returned unchanged.
+func replaceHeader(contents []byte, key, value string) (updated []byte, ok bool) {
+	rest := contents
+	for len(rest) > 0 {
+		end := len(rest)
+		if i := bytes.IndexByte(rest, '\n'); i > -1 {
+			end = i
+		}
+		line := rest[:end]
+
+		trimmed := strings.TrimSpace(string(line))
+		if trimmed != "" && !strings.HasPrefix(trimmed, headerPrefix) {
+			break
+		}
+
+		if lineKey, _, isHeader := parseHeaderLine(trimmed); isHeader && lineKey == key {
+			start := len(contents) - len(rest)
+			replacement := fmt.Sprintf("%s %s: %s", headerPrefix, key, value)
+			if bytes.HasSuffix(line, []byte("\r")) {
+				replacement += "\r"
+			}
+
+			updated = append(updated, contents[:start]...)
+			updated = append(updated, replacement...)
+			updated = append(updated, contents[start+end:]...)
+			return updated, true
+		}
+
+		rest = rest[end:]
+		if len(rest) > 0 {
+			rest = rest[1:]
+		}
+	}
+
+	return contents, false
+}
+
+// parseHeaderLine parses a single header line of the form `-- key: value`.
+// If the line is not of this form or the key is not a known header key,
+// `ok` will be false.
+func parseHeaderLine(line string) (key, value string, ok bool) {
+	if !strings.HasPrefix(line, headerPrefix) {
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(line, headerPrefix), ":", 2)
+	if len(parts) != 2 {
+		return
+	}
+
+	key = strings.ToLower(strings.TrimSpace(parts[0]))
+	switch key {
+	case headerRevision, headerPrevious, headerDescription, headerMilestone, headerTransaction, headerBaseline, headerTombstone:
+		value = strings.TrimSpace(parts[1])
+		ok = true
+	}
+	return
+}
+
+func parseHeaderBool(filename string, header map[string]string, key string, defaultValue bool) (bool, error) {
+	value, ok := header[key]
+	if !ok || value == "" {
+		return defaultValue, nil
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		err = ex.New(ErrInvalidMigrationFile, ex.OptMessagef("File: %q, invalid %q header: %q", filename, key, value))
+		return false, err
+	}
+
+	return b, nil
+}
+
+// sequenceFromUnordered creates a sequence from a slice of migrations that
+// are not necessarily in order. Migrations are registered by starting from
+// the root and following `previous` links; any migrations that cannot be
+// reached from the root will be registered last so that `Register()`
+// produces a descriptive error.
+func sequenceFromUnordered(ms []Migration) (*Migrations, error) {
+	var root *Migration
+	children := map[string][]Migration{}
+	for i, migration := range ms {
+		if migration.Previous == "" && root == nil {
+			root = &ms[i]
+			continue
+		}
+		children[migration.Previous] = append(children[migration.Previous], migration)
+	}
+
+	if root == nil {
+		return nil, ex.New(ErrNoRoot)
+	}
+
+	migrations, err := NewSequence(*root)
+	if err != nil {
+		return nil, err
+	}
+
+	queue := []string{root.Revision}
+	for len(queue) > 0 {
+		previous := queue[0]
+		queue = queue[1:]
+		for _, migration := range children[previous] {
+			err = migrations.Register(migration)
+			if err != nil {
+				return nil, err
+			}
+			queue = append(queue, migration.Revision)
+		}
+		delete(children, previous)
+	}
+
+	// Any migrations remaining were not reachable from the root.
+	remaining := []string{}
+	for previous := range children {
+		remaining = append(remaining, previous)
+	}
+	sort.Strings(remaining)
+	for _, previous := range remaining {
+		err = migrations.RegisterMany(children[previous]...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return migrations, nil
+}
@@ -0,0 +1,139 @@
+package golembic_test
+
+import (
+	"fmt"
+	"testing"
+	"testing/fstest"
+
+	"github.com/blend/go-sdk/assert"
+
+	golembic "github.com/dhermes/golembic-blend"
+	"github.com/dhermes/golembic-blend/examples"
+)
+
+func TestLoadSequence(t *testing.T) {
+	it := assert.New(t)
+
+	// NOTE: File names are intentionally not in sequence order.
+	fsys := fstest.MapFS{
+		"migrations/a.sql": &fstest.MapFile{
+			Data: []byte("-- revision: 2c9a1f0b7d3e\n-- previous: 7f1e0b6d2a4c\n-- description: Add index\n-- transactional: false\n\nCREATE INDEX CONCURRENTLY idx ON t (a);\n"),
+		},
+		"migrations/b.sql": &fstest.MapFile{
+			Data: []byte("-- A comment that is not a header\n-- revision: 0d4c8e2f1a9b\n-- description: Create table\n\nCREATE TABLE t (a TEXT);\n"),
+		},
+		"migrations/c.sql": &fstest.MapFile{
+			Data: []byte("-- revision: 7f1e0b6d2a4c\r\n-- previous: 0d4c8e2f1a9b\r\n-- milestone: true\r\n-- description: Add column\r\nALTER TABLE t ADD COLUMN b TEXT;"),
+		},
+		"migrations/README.md": &fstest.MapFile{Data: []byte("Not a migration")},
+		"migrations/nested/d.sql": &fstest.MapFile{
+			Data: []byte("-- revision: ffffffffffff\n"),
+		},
+	}
+	migrations, err := golembic.LoadSequence(fsys, "migrations")
+	it.Nil(err)
+	it.Equal([]string{"0d4c8e2f1a9b", "7f1e0b6d2a4c", "2c9a1f0b7d3e"}, migrations.Revisions())
+
+	all := migrations.All()
+	it.Equal("Create table", all[0].Description)
+	it.NotNil(all[0].Up)
+	it.Nil(all[0].UpConn)
+	it.True(all[1].Milestone)
+	it.Equal("Add column", all[1].Description)
+	it.Nil(all[2].Up)
+	it.NotNil(all[2].UpConn)
+	it.False(all[2].Milestone)
+
+	// No migration files
+	_, err = golembic.LoadSequence(fsys, "migrations/nested/empty")
+	it.NotNil(err)
+	_, err = golembic.LoadSequence(fstest.MapFS{"x/README.md": &fstest.MapFile{}}, "x")
+	it.Equal(`No migration files found; Directory: "x"`, fmt.Sprintf("%v", err))
+
+	// No root
+	fsys = fstest.MapFS{
+		"a.sql": &fstest.MapFile{Data: []byte("-- revision: 2c9a1f0b7d3e\n-- previous: 7f1e0b6d2a4c\n")},
+	}
+	_, err = golembic.LoadSequence(fsys, ".")
+	it.Equal("Cannot find a root migration", fmt.Sprintf("%v", err))
+
+	// Multiple roots
+	fsys = fstest.MapFS{
+		"a.sql": &fstest.MapFile{Data: []byte("-- revision: 2c9a1f0b7d3e\n")},
+		"b.sql": &fstest.MapFile{Data: []byte("-- revision: 7f1e0b6d2a4c\n")},
+	}
+	_, err = golembic.LoadSequence(fsys, ".")
+	it.Equal(`Cannot register a migration with no previous migration; Revision: "7f1e0b6d2a4c"`, fmt.Sprintf("%v", err))
+
+	// Unreachable migration
+	fsys = fstest.MapFS{
+		"a.sql": &fstest.MapFile{Data: []byte("-- revision: 2c9a1f0b7d3e\n")},
+		"b.sql": &fstest.MapFile{Data: []byte("-- revision: 7f1e0b6d2a4c\n-- previous: 0d4c8e2f1a9b\n")},
+	}
+	_, err = golembic.LoadSequence(fsys, ".")
+	it.Equal(`Cannot register a migration until previous migration is registered; Revision: "7f1e0b6d2a4c", Previous: "0d4c8e2f1a9b"`, fmt.Sprintf("%v", err))
+}
+
+func TestParseMigration(t *testing.T) {
+	it := assert.New(t)
+
+	// Missing revision
+	_, err := golembic.ParseMigration("a.sql", []byte("-- description: Nothing\nSELECT 1;\n"))
+	it.Equal(`Invalid migration file; File: "a.sql", missing "revision" header`, fmt.Sprintf("%v", err))
+
+	// Empty revision
+	_, err = golembic.ParseMigration("a.sql", []byte("-- revision:\nSELECT 1;\n"))
+	it.Equal("A migration must have a revision", fmt.Sprintf("%v", err))
+
+	// Header after the first statement is not part of the header
+	_, err = golembic.ParseMigration("a.sql", []byte("SELECT 1;\n-- revision: 2c9a1f0b7d3e\n"))
+	it.Equal(`Invalid migration file; File: "a.sql", missing "revision" header`, fmt.Sprintf("%v", err))
+
+	// Invalid boolean
+	_, err = golembic.ParseMigration("a.sql", []byte("-- revision: 2c9a1f0b7d3e\n-- milestone: sometimes\n"))
+	it.Equal(`Invalid migration file; File: "a.sql", invalid "milestone" header: "sometimes"`, fmt.Sprintf("%v", err))
+
+	// Duplicate header
+	_, err = golembic.ParseMigration("a.sql", []byte("-- revision: 2c9a1f0b7d3e\n-- Revision: 0d4c8e2f1a9b\n"))
+	it.Equal(`Invalid migration file; File: "a.sql", duplicate "revision" header`, fmt.Sprintf("%v", err))
+
+	// Baseline and tombstone
+	_, err = golembic.ParseMigration("a.sql", []byte("-- revision: 2c9a1f0b7d3e\n-- baseline: true\n-- tombstone: true\n"))
+	it.Equal(`Invalid migration file; File: "a.sql", cannot be both a baseline and a tombstone`, fmt.Sprintf("%v", err))
+	_, err = golembic.ParseMigration("a.sql", []byte("-- revision: 2c9a1f0b7d3e\n-- tombstone: true\n\nSELECT 1;\n"))
+	it.Equal(`Invalid migration file; File: "a.sql", a tombstone cannot contain SQL`, fmt.Sprintf("%v", err))
+	migration, err := golembic.ParseMigration("a.sql", []byte("-- revision: 2c9a1f0b7d3e\n-- tombstone: true\n\n"))
+	it.Nil(err)
+	it.True(migration.IsTombstone())
+	migration, err = golembic.ParseMigration("a.sql", []byte("-- revision: 2c9a1f0b7d3e\n-- baseline: true\nSELECT 1;\n"))
+	it.Nil(err)
+	it.True(migration.Baseline)
+	it.False(migration.IsTombstone())
+	it.Equal(" [BASELINE]", migration.ExtendedDescription())
+
+	// Happy path
+	migration, err = golembic.ParseMigration("a.sql", []byte("-- revision: 2c9a1f0b7d3e\n-- previous: 0d4c8e2f1a9b\n-- milestone: TRUE\nSELECT 1;\n"))
+	it.Nil(err)
+	it.Equal("2c9a1f0b7d3e", migration.Revision)
+	it.Equal("0d4c8e2f1a9b", migration.Previous)
+	it.Equal("", migration.Description)
+	it.True(migration.Milestone)
+	it.NotNil(migration.Up)
+}
+
+func TestLoadSequence_Examples(t *testing.T) {
+	it := assert.New(t)
+
+	expected, err := examples.AllMigrations(-1)
+	it.Nil(err)
+	migrations, err := examples.AllMigrationsFromSQL()
+	it.Nil(err)
+	it.Equal(expected.Revisions(), migrations.Revisions())
+
+	all := migrations.All()
+	for i, migration := range expected.All() {
+		it.Equal(migration.ExtendedDescription(), all[i].ExtendedDescription())
+		it.Equal(migration.Up == nil, all[i].Up == nil)
+		it.Equal(migration.UpConn == nil, all[i].UpConn == nil)
+	}
+}
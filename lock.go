@@ -0,0 +1,213 @@
+package golembic
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"hash/fnv"
+	"time"
+
+	"github.com/blend/go-sdk/db"
+	"github.com/blend/go-sdk/db/migration"
+	"github.com/blend/go-sdk/ex"
+)
+
+// NOTE: Ensure that
+//       * `lockAction` satisfies `migration.Action`.
+//       * `lockAction` satisfies `releaser`.
+var (
+	_ migration.Action = (*lockAction)(nil)
+	_ releaser         = (*lockAction)(nil)
+)
+
+// LockMode determines how a manager acquires an advisory lock before
+// planning and applying migrations.
+type LockMode string
+
+const (
+	// LockModeNone indicates that no advisory lock will be acquired.
+	LockModeNone LockMode = ""
+	// LockModeWait indicates that the manager will wait (indefinitely) for
+	// the advisory lock to be acquired.
+	LockModeWait LockMode = "wait"
+	// LockModeTimeout indicates that the manager will wait for the advisory
+	// lock to be acquired for at most `LockTimeout`.
+	LockModeTimeout LockMode = "timeout"
+	// LockModeFailFast indicates that the manager will fail immediately if
+	// the advisory lock is held by another session.
+	LockModeFailFast LockMode = "fail-fast"
+)
+
+const (
+	// lockPollInterval is the amount of time to wait between attempts to
+	// acquire an advisory lock in `LockModeTimeout`.
+	lockPollInterval = 100 * time.Millisecond
+)
+
+// AdvisoryLockKey determines the key used for the PostgreSQL advisory lock
+// that guards a migrations metadata table. Since the key only depends on the
+// table name (qualified by its schema, e.g. `public.golembic_migrations`),
+// every runner using the same table will contend for the same lock.
+func AdvisoryLockKey(table string) int64 {
+	h := fnv.New64a()
+	// NOTE: `Write()` on a hash never returns an error.
+	_, _ = h.Write([]byte("golembic:" + table))
+	return int64(h.Sum64())
+}
+
+// advisoryLockKey determines the advisory lock key for the migrations
+// metadata table of the manager. The schema is resolved via `pool`, so an
+// unset `MetadataSchema` and the default schema produce the same key.
+func (m *Manager) advisoryLockKey(pool *db.Connection) int64 {
+	return AdvisoryLockKey(m.metadataSchema(pool) + "." + m.MetadataTable)
+}
+
+// lockAction acquires a (session level) PostgreSQL advisory lock keyed on
+// the migrations metadata table. The lock is held on a dedicated connection
+// until `release()` is called after the suite is done.
+type lockAction struct {
+	m    *Manager
+	conn *sql.Conn
+	key  int64
+	// Connections is the number of connections needed (including the one
+	// holding the lock) while the lock is held. If the pool allows fewer,
+	// the action fails rather than deadlocking later in the suite.
+	Connections int
+}
+
+// Action acquires the advisory lock, waiting according to the lock mode of
+// the manager.
+func (la *lockAction) Action(ctx context.Context, pool *db.Connection, _ *sql.Tx) error {
+	m := la.m
+	err := la.checkPoolSize(ctx, pool)
+	if err != nil {
+		return err
+	}
+
+	key := m.advisoryLockKey(pool)
+	conn, err := pool.Connection.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	acquired, err := tryAdvisoryLock(ctx, conn, key)
+	if err == nil && !acquired && m.LockMode != LockModeFailFast {
+		body := fmt.Sprintf("Waiting for advisory lock on %s (key %d)", m.qualifiedName(m.MetadataTable), key)
+		PlanEventWrite(ctx, m.Log, "", body, "")
+		acquired, err = waitAdvisoryLock(ctx, conn, key, m.LockMode, m.LockTimeout)
+	}
+	if err != nil || !acquired {
+		_ = conn.Close()
+		if err != nil {
+			return err
+		}
+
+		body := fmt.Sprintf("Could not acquire advisory lock on %s (key %d)", m.qualifiedName(m.MetadataTable), key)
+		suiteWrite(ctx, m.Log, "failed", body)
+		return ex.New(ErrLockNotAcquired, ex.OptMessagef("Table: %q, Key: %d", m.qualifiedName(m.MetadataTable), key))
+	}
+
+	la.conn = conn
+	la.key = key
+	body := fmt.Sprintf("Acquired advisory lock on %s (key %d)", m.qualifiedName(m.MetadataTable), key)
+	PlanEventWrite(ctx, m.Log, "", body, "")
+	return nil
+}
+
+// checkPoolSize ensures the pool allows enough open connections to hold the
+// lock on one connection while the rest of the suite uses others. Otherwise,
+// e.g. with a pool of 1, the next `pool.Begin()` would block forever.
+func (la *lockAction) checkPoolSize(ctx context.Context, pool *db.Connection) error {
+	maxOpen := pool.Connection.Stats().MaxOpenConnections
+	if maxOpen <= 0 || maxOpen >= la.Connections {
+		return nil
+	}
+
+	body := fmt.Sprintf("Connection pool allows %d connection(s) but %d are needed while holding the advisory lock", maxOpen, la.Connections)
+	suiteWrite(ctx, la.m.Log, "failed", body)
+	return ex.New(ErrPoolTooSmall, ex.OptMessagef("MaxOpenConnections: %d, Required: %d", maxOpen, la.Connections))
+}
+
+// lockConnections is the number of connections needed while the advisory
+// lock is held: one for the lock, one for the transaction of each group and
+// (if there are `UpConn` migrations) one for work done outside of that
+// transaction.
+func (m *Manager) lockConnections() int {
+	if m.hasNonTransactional() {
+		return 3
+	}
+	return 2
+}
+
+// release releases the advisory lock (if it was acquired) and returns the
+// dedicated connection to the pool.
+func (la *lockAction) release(ctx context.Context) {
+	if la.conn == nil {
+		return
+	}
+
+	m := la.m
+	key := la.key
+	conn := la.conn
+	la.conn = nil
+
+	// NOTE: The lock is released even if `ctx` is done, otherwise the
+	//       connection would be returned to the pool with the lock held.
+	_, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", key)
+	if err != nil {
+		// NOTE: Discard the connection (rather than returning it to the pool)
+		//       so that the session, and the lock along with it, ends.
+		_ = conn.Raw(func(_ interface{}) error { return driver.ErrBadConn })
+		_ = conn.Close()
+		body := fmt.Sprintf("Discarded connection holding advisory lock on %s (key %d): %v", m.qualifiedName(m.MetadataTable), key, err)
+		suiteWrite(ctx, m.Log, "failed", body)
+		return
+	}
+
+	_ = conn.Close()
+	body := fmt.Sprintf("Released advisory lock on %s (key %d)", m.qualifiedName(m.MetadataTable), key)
+	PlanEventWrite(ctx, m.Log, "", body, "")
+}
+
+// releaseGroups releases any resources held by the actions in a suite.
+func releaseGroups(ctx context.Context, s *migration.Suite) {
+	for i := len(s.Groups) - 1; i >= 0; i-- {
+		for _, action := range s.Groups[i].Actions {
+			if r, ok := action.(releaser); ok {
+				r.release(ctx)
+			}
+		}
+	}
+}
+
+func tryAdvisoryLock(ctx context.Context, conn *sql.Conn, key int64) (bool, error) {
+	acquired := false
+	err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&acquired)
+	return acquired, err
+}
+
+// waitAdvisoryLock waits for an advisory lock. In `LockModeWait` this blocks
+// in the database, otherwise it polls until the timeout is reached.
+func waitAdvisoryLock(ctx context.Context, conn *sql.Conn, key int64, mode LockMode, timeout time.Duration) (bool, error) {
+	if mode == LockModeWait {
+		_, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", key)
+		return err == nil, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+
+		acquired, err := tryAdvisoryLock(ctx, conn, key)
+		if err != nil || acquired {
+			return acquired, err
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,187 @@
+package golembic_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/db"
+	"github.com/blend/go-sdk/logger"
+
+	golembic "github.com/dhermes/golembic-blend"
+)
+
+func TestAdvisoryLockKey(t *testing.T) {
+	it := assert.New(t)
+
+	key := golembic.AdvisoryLockKey("golembic_migrations")
+	it.Equal(key, golembic.AdvisoryLockKey("golembic_migrations"))
+	it.NotEqual(key, golembic.AdvisoryLockKey("other_migrations"))
+}
+
+func TestOptManagerLockTimeout(t *testing.T) {
+	it := assert.New(t)
+
+	m, err := golembic.NewManager(golembic.OptManagerLockTimeout(time.Second))
+	it.Nil(err)
+	it.Equal(golembic.LockModeTimeout, m.LockMode)
+	it.Equal(time.Second, m.LockTimeout)
+
+	m, err = golembic.NewManager(golembic.OptManagerLockTimeout(0))
+	it.Nil(m)
+	it.Equal("Advisory lock timeout must be positive; Timeout: 0s", fmt.Sprintf("%v", err))
+}
+
+func TestGenerateSuite_LockPoolSize(t *testing.T) {
+	it := assert.New(t)
+
+	// NOTE: The pool is never connected to; the pool size is checked before
+	//       the advisory lock is acquired.
+	ctx := context.TODO()
+	pool, err := db.New(db.OptConfig(db.Config{Host: "127.0.0.1", Port: "1", Database: "golembic", MaxConnections: 1}))
+	it.Nil(err)
+	it.Nil(pool.Open())
+	t.Cleanup(func() {
+		it.Nil(pool.Close())
+	})
+	var logBuffer bytes.Buffer
+	log := logger.Memory(&logBuffer)
+
+	migrations, err := makeSequence("unused1", "unused2", 1, false)
+	it.Nil(err)
+	m, err := golembic.NewManager(
+		golembic.OptManagerSequence(migrations),
+		golembic.OptManagerLog(log),
+		golembic.OptManagerLockWait(),
+	)
+	it.Nil(err)
+	suite, err := golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Equal("Connection pool is too small to hold the advisory lock while applying migrations; MaxOpenConnections: 1, Required: 2", fmt.Sprintf("%v", err))
+	logLines := []string{
+		"[db.migration] -- failed -- Connection pool allows 1 connection(s) but 2 are needed while holding the advisory lock",
+		"[db.migration.stats] 0 applied 0 skipped 0 failed 0 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+}
+
+func TestGenerateSuite_Lock(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt := fmt.Sprintf("xyzzy_%s_migrations", suffix)
+	t1 := fmt.Sprintf("xyzzy1_%s", suffix)
+	t2 := fmt.Sprintf("xyzzy2_%s", suffix)
+	t.Cleanup(func() {
+		for _, table := range []string{mt, t1, t2} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+	})
+	var logBuffer bytes.Buffer
+	log := logger.Memory(&logBuffer)
+	key := golembic.AdvisoryLockKey("public." + mt)
+
+	// Hold the lock in another session
+	conn, err := pool.Connection.Conn(ctx)
+	it.Nil(err)
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", key)
+	it.Nil(err)
+
+	migrations, err := makeSequence(t1, t2, 1, false)
+	it.Nil(err)
+	m, err := golembic.NewManager(
+		golembic.OptManagerSequence(migrations),
+		golembic.OptManagerMetadataTable(mt),
+		golembic.OptManagerLog(log),
+		golembic.OptManagerLockFailFast(),
+	)
+	it.Nil(err)
+	suite, err := golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	expected := fmt.Sprintf("Could not acquire advisory lock for migrations; Table: %q, Key: %d", mt, key)
+	it.Equal(expected, fmt.Sprintf("%v", err))
+	logLines := []string{
+		fmt.Sprintf("[db.migration] -- failed -- Could not acquire advisory lock on %s (key %d)", mt, key),
+		"[db.migration.stats] 0 applied 0 skipped 0 failed 0 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// Time out while waiting
+	m.LockMode = golembic.LockModeTimeout
+	m.LockTimeout = 250 * time.Millisecond
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Equal(expected, fmt.Sprintf("%v", err))
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- plan -- Waiting for advisory lock on %s (key %d)", mt, key),
+		fmt.Sprintf("[db.migration] -- failed -- Could not acquire advisory lock on %s (key %d)", mt, key),
+		"[db.migration.stats] 0 applied 0 skipped 0 failed 0 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// Setting the default schema explicitly contends for the same lock
+	m.LockMode = golembic.LockModeFailFast
+	m.MetadataSchema = "public"
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	expected = fmt.Sprintf("Could not acquire advisory lock for migrations; Table: %q, Key: %d", "public."+mt, key)
+	it.Equal(expected, fmt.Sprintf("%v", err))
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- failed -- Could not acquire advisory lock on public.%s (key %d)", mt, key),
+		"[db.migration.stats] 0 applied 0 skipped 0 failed 0 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+	m.MetadataSchema = ""
+
+	// Release the lock in the other session, then wait
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", key)
+	it.Nil(err)
+	it.Nil(conn.Close())
+	m.LockMode = golembic.LockModeWait
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- plan -- Acquired advisory lock on %s (key %d)", mt, key),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 1: Create migrations metadata table", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 2: Add checksum column", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 3: Add description, duration_ms, applied_by, hostname and app_version columns", mt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- aa60f058f5f5 -- Create first table",
+		fmt.Sprintf("[db.migration] -- plan -- Released advisory lock on %s (key %d)", mt, key),
+		"[db.migration.stats] 2 applied 0 skipped 0 failed 2 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+
+	// The lock is no longer held
+	conn, err = pool.Connection.Conn(ctx)
+	it.Nil(err)
+	acquired := false
+	err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&acquired)
+	it.Nil(err)
+	it.True(acquired)
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", key)
+	it.Nil(err)
+	it.Nil(conn.Close())
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/blend/go-sdk/db"
@@ -22,6 +23,21 @@ const (
 	// DefaultMetadataTable is the default name for the table used to store
 	// metadata about migrations.
 	DefaultMetadataTable = "golembic_migrations"
+	// repeatableTableSuffix is appended to the metadata table name to
+	// determine the default name of the table used to store metadata about
+	// repeatable migrations.
+	repeatableTableSuffix = "_repeatable"
+	// inProgressTableSuffix is appended to the metadata table name to
+	// determine the default name of the table used to track non-transactional
+	// migrations that are in progress.
+	inProgressTableSuffix = "_in_progress"
+
+	// checksumColumn is the column used to determine if the migrations
+	// metadata table has the column added in schema version 2.
+	checksumColumn = "checksum"
+	// appliedByColumn is the column used to determine if the migrations
+	// metadata table has the columns added in schema version 3.
+	appliedByColumn = "applied_by"
 )
 
 // Manager orchestrates database operations done via `Up` / `UpConn` as well as
@@ -32,6 +48,22 @@ type Manager struct {
 	// The expected default value (`DefaultMetadataTable`) is
 	// "golembic_migrations".
 	MetadataTable string
+	// RepeatableTable is the name of the table that stores metadata for
+	// repeatable migrations. If not set, this is `MetadataTable` with a
+	// "_repeatable" suffix, e.g. "golembic_migrations_repeatable".
+	RepeatableTable string
+	// InProgressTable is the name of the table used to mark non-transactional
+	// (i.e. `UpConn`) migrations as in progress while they are applied. If
+	// not set, this is `MetadataTable` with an "_in_progress" suffix, e.g.
+	// "golembic_migrations_in_progress".
+	InProgressTable string
+	// MetadataSchema is the schema containing the metadata tables. If not
+	// set, the tables are unqualified, i.e. they are resolved via the
+	// `search_path` (and checked for in the schema of the connection pool).
+	MetadataSchema string
+	// CreateSchema indicates that `MetadataSchema` should be created (if it
+	// does not exist) along with the migrations metadata table.
+	CreateSchema bool
 	// Sequence is the collection of registered migrations to be applied,
 	// verified, described, etc. by this manager.
 	Sequence *Migrations
@@ -45,13 +77,60 @@ type Manager struct {
 	// and migrations will be applied from scratch (including milestones that
 	// may not come at the end).
 	DevelopmentMode bool
+	// LockMode determines if (and how) a PostgreSQL advisory lock, keyed on
+	// the metadata table, is acquired before planning and held until all
+	// migrations have been applied. This protects against concurrent runners
+	// (e.g. several replicas starting at once). Since the lock is held by a
+	// session, this can't be used with a connection pooler in transaction
+	// mode. The lock occupies a connection of its own, so the pool must allow
+	// at least 2 connections (3 if the sequence has `UpConn` migrations).
+	LockMode LockMode
+	// LockTimeout is the maximum amount of time to wait for the advisory lock
+	// in `LockModeTimeout`.
+	LockTimeout time.Duration
+	// Timeouts are the default PostgreSQL timeouts (e.g. `lock_timeout`) set
+	// while applying each migration. Timeouts set on a migration take
+	// precedence.
+	Timeouts Timeouts
+	// RetryPolicy determines if (and how) a transactional migration that fails
+	// with a transient error (e.g. a deadlock) is retried. By default,
+	// migrations are not retried.
+	RetryPolicy RetryPolicy
+	// Tracer (if set) is used to start spans for planning and for each
+	// migration that is applied.
+	Tracer Tracer
+	// Meter (if set) is used to record metrics for each migration that is
+	// applied.
+	Meter Meter
+	// Hooks are invoked at points in the lifecycle of applying migrations,
+	// e.g. before each migration.
+	Hooks Hooks
+	// Hostname is stored in the migrations metadata table with each applied
+	// migration. This defaults to the hostname reported by the kernel.
+	Hostname string
+	// AppVersion is an application version (e.g. a git SHA) supplied by the
+	// caller that is stored in the migrations metadata table with each
+	// applied migration.
+	AppVersion string
+	// SingleTransaction indicates that a suite generated for this manager
+	// should set up the metadata tables, plan and apply every migration in
+	// one transaction, so that either all of the migrations are committed or
+	// none of them are. Planning fails if a migration must be run outside of
+	// a transaction (i.e. via `UpConn`).
+	SingleTransaction bool
+	// DryRun indicates that a suite generated for this manager should plan
+	// migrations but, rather than applying them, emit the statements that
+	// would be executed (including writes to the migration metadata table).
+	DryRun bool
 	// Log is used for printing output
 	Log logger.Log
 }
 
 // NewManager creates a new manager for orchestrating migrations.
 func NewManager(opts ...ManagerOption) (*Manager, error) {
-	m := &Manager{MetadataTable: DefaultMetadataTable}
+	// NOTE: The hostname is only informational, so an error is ignored.
+	hostname, _ := os.Hostname()
+	m := &Manager{MetadataTable: DefaultMetadataTable, Hostname: hostname}
 	for _, opt := range opts {
 		err := opt(m)
 		if err != nil {
@@ -63,45 +142,115 @@ func NewManager(opts ...ManagerOption) (*Manager, error) {
 }
 
 // InsertMigration inserts a migration into the migrations metadata table.
+// Along with the revision, the row records the description of the migration,
+// the database user, the hostname and the application version for the
+// manager.
 func (m *Manager) InsertMigration(ctx context.Context, pool *db.Connection, tx *sql.Tx, migration Migration) error {
+	return m.insertMigration(ctx, pool, tx, migration, 0)
+}
+
+// insertMigration inserts a migration into the migrations metadata table,
+// including the amount of time it took to apply the migration (if known).
+func (m *Manager) insertMigration(ctx context.Context, pool *db.Connection, tx *sql.Tx, migration Migration, duration time.Duration) error {
+	statement, args := m.insertMigrationStatement(migration, duration)
+	_, err := pool.Invoke(db.OptContext(ctx), db.OptTx(tx)).Exec(statement, args...)
+	return err
+}
+
+// insertMigrationStatement produces the statement (and parameters) used by
+// `InsertMigration()`. The database user is determined by `CURRENT_USER` and
+// a `duration` of zero is stored as `NULL`.
+func (m *Manager) insertMigrationStatement(migration Migration, duration time.Duration) (string, []interface{}) {
 	if migration.Previous == "" {
 		statement := fmt.Sprintf(
-			"INSERT INTO %s (serial_id, revision, previous) VALUES (0, %s, NULL)",
-			providerQuoteIdentifier(m.MetadataTable),
+			"INSERT INTO %s (serial_id, revision, previous, checksum, description, duration_ms, applied_by, hostname, app_version) "+
+				"VALUES (0, %s, NULL, %s, %s, %s, CURRENT_USER, %s, %s)",
+			m.quoteTable(m.MetadataTable),
 			providerQueryParameter(1),
+			providerQueryParameter(2),
+			providerQueryParameter(3),
+			providerQueryParameter(4),
+			providerQueryParameter(5),
+			providerQueryParameter(6),
 		)
-		_, err := pool.Invoke(db.OptContext(ctx), db.OptTx(tx)).Exec(statement, migration.Revision)
-		return err
+		args := []interface{}{
+			migration.Revision,                    // Parameter 1
+			nullableString(migration.Checksum),    // Parameter 2
+			nullableString(migration.Description), // Parameter 3
+			nullableMilliseconds(duration),        // Parameter 4
+			nullableString(m.Hostname),            // Parameter 5
+			nullableString(m.AppVersion),          // Parameter 6
+		}
+		return statement, args
 	}
 
 	statement := fmt.Sprintf(
-		"INSERT INTO %s (serial_id, revision, previous) VALUES (%s, %s, %s)",
-		providerQuoteIdentifier(m.MetadataTable),
+		"INSERT INTO %s (serial_id, revision, previous, checksum, description, duration_ms, applied_by, hostname, app_version) "+
+			"VALUES (%s, %s, %s, %s, %s, %s, CURRENT_USER, %s, %s)",
+		m.quoteTable(m.MetadataTable),
 		providerQueryParameter(1),
 		providerQueryParameter(2),
 		providerQueryParameter(3),
+		providerQueryParameter(4),
+		providerQueryParameter(5),
+		providerQueryParameter(6),
+		providerQueryParameter(7),
+		providerQueryParameter(8),
 	)
-	_, err := pool.Invoke(db.OptContext(ctx), db.OptTx(tx)).Exec(
-		statement,
-		migration.serialID, // Parameter 1
-		migration.Revision, // Parameter 2
-		migration.Previous, // Parameter 3
-	)
-	return err
+	args := []interface{}{
+		migration.serialID,                    // Parameter 1
+		migration.Revision,                    // Parameter 2
+		migration.Previous,                    // Parameter 3
+		nullableString(migration.Checksum),    // Parameter 4
+		nullableString(migration.Description), // Parameter 5
+		nullableMilliseconds(duration),        // Parameter 6
+		nullableString(m.Hostname),            // Parameter 7
+		nullableString(m.AppVersion),          // Parameter 8
+	}
+	return statement, args
 }
 
-// ApplyMigration creates a transaction that runs the "Up" migration.
+// ApplyMigration runs the "Up" migration in `tx` (with the effective timeouts
+// for the migration) and records it in the migrations metadata table. A
+// non-transactional migration (i.e. `UpConn`) runs outside of `tx`; if the in
+// progress table exists, the migration is marked as in progress while it
+// runs (see `invokeUpConnTracked()`). If the migration is a baseline, a row
+// will be inserted into the migrations metadata table for each migration
+// squashed into the baseline as well. The time taken to run "Up" is stored
+// with the row for the migration.
 func (m *Manager) ApplyMigration(ctx context.Context, pool *db.Connection, tx *sql.Tx, migration Migration) (err error) {
-	err = migration.InvokeUp(ctx, pool, tx)
+	start := time.Now()
+	if migration.UpConn != nil {
+		err = m.invokeUpConnTracked(ctx, pool, tx, migration)
+	} else {
+		err = m.invokeUp(ctx, pool, tx, migration)
+	}
 	if err != nil {
 		return
 	}
+	duration := time.Since(start)
+
+	if !migration.Baseline {
+		err = m.insertMigration(ctx, pool, tx, migration, duration)
+		return
+	}
 
-	err = m.InsertMigration(ctx, pool, tx, migration)
+	squashed, err := m.Sequence.Through(migration.Revision)
 	if err != nil {
 		return
 	}
 
+	for _, row := range squashed {
+		rowDuration := time.Duration(0)
+		if row.Revision == migration.Revision {
+			rowDuration = duration
+		}
+		err = m.insertMigration(ctx, pool, tx, row, rowDuration)
+		if err != nil {
+			return
+		}
+	}
+
 	return
 }
 
@@ -115,6 +264,7 @@ func (m *Manager) filterMigrations(ctx context.Context, pool *db.Connection, tx
 	if err != nil {
 		return 0, nil, err
 	}
+	recordStart(ctx, latest)
 
 	pastMigrationCount, migrations, err := filter(latest)
 	if err != nil {
@@ -138,6 +288,27 @@ func (m *Manager) filterMigrations(ctx context.Context, pool *db.Connection, tx
 	return pastMigrationCount, migrations, nil
 }
 
+// validateSquashed ensures that no migrations that have been squashed into a
+// baseline will be applied. Tombstones can never be applied and a baseline can
+// only be applied to an empty database.
+func (m *Manager) validateSquashed(ctx context.Context, pastMigrationCount int, migrations []Migration) error {
+	for _, migration := range migrations {
+		if migration.IsTombstone() {
+			body := fmt.Sprintf("Revision %s is a tombstone", migration.Revision)
+			suiteWrite(ctx, m.Log, "failed", body)
+			return ex.New(ErrCannotApplySquashed, ex.OptMessagef("Revision: %q", migration.Revision))
+		}
+
+		if migration.Baseline && pastMigrationCount > 0 {
+			body := fmt.Sprintf("Revision %s is a baseline but %d migrations have already been applied", migration.Revision, pastMigrationCount)
+			suiteWrite(ctx, m.Log, "failed", body)
+			return ex.New(ErrCannotApplySquashed, ex.OptMessagef("Revision: %q", migration.Revision))
+		}
+	}
+
+	return nil
+}
+
 func (m *Manager) validateMilestones(ctx context.Context, pastMigrationCount int, migrations []Migration) error {
 	// Early exit if no migrations have been run yet. This **assumes** that the
 	// database is being brought up from scratch.
@@ -171,32 +342,163 @@ func (m *Manager) validateMilestones(ctx context.Context, pastMigrationCount int
 }
 
 // Plan gathers (and verifies) all migrations that have not yet been applied.
+// If a target revision is provided (via `OptApplyTarget()`), only the
+// migrations through the target are included. If `OptApplyStopAtMilestone()`
+// is used, only the migrations through the first pending milestone are
+// included.
 func (m *Manager) Plan(ctx context.Context, pool *db.Connection, tx *sql.Tx, opts ...ApplyOption) ([]Migration, error) {
 	ac, err := NewApplyConfig(opts...)
 	if err != nil {
 		return nil, err
 	}
 
-	pastMigrationCount, migrations, err := m.filterMigrations(ctx, pool, tx, m.sinceOrAll, ac.VerifyHistory)
+	pastMigrationCount, unapplied, err := m.filterMigrations(ctx, pool, tx, m.sinceOrAll, ac.VerifyHistory)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := m.truncateToTarget(ctx, pastMigrationCount, unapplied, ac.TargetRevision)
 	if err != nil {
 		return nil, err
 	}
 
 	if migrations == nil {
+		recordDeferred(ctx, unapplied)
 		return nil, nil
 	}
 
+	if ac.StopAtMilestone {
+		migrations = m.truncateToMilestone(ctx, pastMigrationCount, migrations)
+	}
+
+	err = m.validateSquashed(ctx, pastMigrationCount, migrations)
+	if err != nil {
+		return nil, err
+	}
+
 	err = m.validateMilestones(ctx, pastMigrationCount, migrations)
 	if err != nil {
 		return nil, err
 	}
 
+	recordDeferred(ctx, unapplied[len(migrations):])
 	return migrations, nil
 }
 
+// planReachesEnd indicates if applying the planned `migrations` brings the
+// database to the end of the sequence, i.e. the plan was not cut short by a
+// target revision (via `OptApplyTarget()`) or a milestone (via
+// `OptApplyStopAtMilestone()`). Repeatable migrations are only planned when
+// this is the case, since they may depend on any migration in the sequence.
+func (m *Manager) planReachesEnd(migrations []Migration, opts ...ApplyOption) (bool, error) {
+	ac, err := NewApplyConfig(opts...)
+	if err != nil {
+		return false, err
+	}
+
+	all := m.Sequence.All()
+	last := all[len(all)-1].Revision
+	if len(migrations) > 0 {
+		return migrations[len(migrations)-1].Revision == last, nil
+	}
+
+	// NOTE: With nothing planned, either every migration has been applied or
+	//       the target revision has been applied.
+	return ac.TargetRevision == "" || ac.TargetRevision == last, nil
+}
+
+// deferRepeatables emits a plan event explaining that the repeatable
+// migrations will not be planned since the plan does not reach the end of
+// the sequence.
+func (m *Manager) deferRepeatables(ctx context.Context) {
+	PlanEventWrite(ctx, m.Log, "", "Repeatable migrations deferred until every migration in the sequence has been applied", "")
+}
+
+// truncateToTarget truncates the planned `migrations` so that the last
+// migration is the `target` revision. If `target` is empty, `migrations`
+// will be returned unchanged. If the target has already been applied, there
+// are no migrations to run; if the target is **before** the latest applied
+// migration, that is an error.
+func (m *Manager) truncateToTarget(ctx context.Context, pastMigrationCount int, migrations []Migration, target string) ([]Migration, error) {
+	if target == "" {
+		return migrations, nil
+	}
+
+	for i, migration := range migrations {
+		if migration.Revision != target {
+			continue
+		}
+
+		remaining := len(migrations) - i - 1
+		if remaining > 0 {
+			body := fmt.Sprintf("Target revision %s; %d later migration(s) will not be applied", target, remaining)
+			PlanEventWrite(ctx, m.Log, "", body, "")
+		}
+		return migrations[:i+1], nil
+	}
+
+	through, err := m.Sequence.Through(target)
+	if err != nil {
+		return nil, err
+	}
+
+	// NOTE: At this point, `target` is registered but not planned, so it has
+	//       either already been applied or squashed into a baseline.
+	if pastMigrationCount == 0 {
+		return nil, ex.New(ErrCannotApplySquashed, ex.OptMessagef("Revision: %q", target))
+	}
+
+	all := m.Sequence.All()
+	latest := all[pastMigrationCount-1].Revision
+	if len(through) < pastMigrationCount {
+		body := fmt.Sprintf("Target revision %s is behind latest revision %s", target, latest)
+		suiteWrite(ctx, m.Log, "failed", body)
+		return nil, ex.New(ErrTargetBehind, ex.OptMessagef("Target: %q, Latest: %q", target, latest))
+	}
+
+	// NOTE: If `migrations` is empty, `filterMigrations()` has already
+	//       reported that there is nothing to run.
+	if len(migrations) > 0 {
+		body := fmt.Sprintf("No migrations to run; latest revision: %s", latest)
+		if all[pastMigrationCount-1].Milestone {
+			body += milestoneSuffix
+		}
+		PlanEventWrite(ctx, m.Log, "", body, "")
+	}
+	return nil, nil
+}
+
+// truncateToMilestone truncates the planned `migrations` so that the last
+// migration is the first pending milestone (if any). As in
+// `validateMilestones()`, if no migrations have been applied yet, the
+// database is assumed to be brought up from scratch so `migrations` will be
+// returned unchanged.
+func (m *Manager) truncateToMilestone(ctx context.Context, pastMigrationCount int, migrations []Migration) []Migration {
+	if pastMigrationCount == 0 {
+		return migrations
+	}
+
+	for i, migration := range migrations {
+		if !migration.Milestone {
+			continue
+		}
+
+		remaining := len(migrations) - i - 1
+		if remaining > 0 {
+			body := fmt.Sprintf("Stopping at milestone %s; %d migration(s) remain for the next run", migration.Revision, remaining)
+			PlanEventWrite(ctx, m.Log, "", body, "")
+		}
+		return migrations[:i+1]
+	}
+
+	return migrations
+}
+
+// sinceOrAll returns the migrations after `revision` or, if no migrations
+// have been applied, the migrations from the latest baseline (if any).
 func (m *Manager) sinceOrAll(revision string) (int, []Migration, error) {
 	if revision == "" {
-		return 0, m.Sequence.All(), nil
+		return 0, m.Sequence.FromBaseline(), nil
 	}
 
 	return m.Sequence.Since(revision)
@@ -210,7 +512,7 @@ func (m *Manager) sinceOrAll(revision string) (int, []Migration, error) {
 func (m *Manager) Latest(ctx context.Context, pool *db.Connection, tx *sql.Tx) (revision string, createdAt time.Time, err error) {
 	query := fmt.Sprintf(
 		"SELECT revision, previous, created_at FROM %s ORDER BY serial_id DESC LIMIT 1",
-		providerQuoteIdentifier(m.MetadataTable),
+		m.quoteTable(m.MetadataTable),
 	)
 	rows, err := readAllMigration(ctx, pool, tx, query)
 	if err != nil {
@@ -253,11 +555,26 @@ func (m *Manager) latestMaybeVerify(ctx context.Context, pool *db.Connection, tx
 // verifyHistory retrieves a full history of migrations and compares it against
 // the sequence of registered migrations. If they match (up to the end of the
 // history, the registered sequence can be longer), this will return with no
-// error and include slices of the history and the registered migrations.
+// error and include slices of the history and the registered migrations. If
+// a checksum is stored for an applied migration, it must also match the
+// checksum of the registered migration.
 func (m *Manager) verifyHistory(ctx context.Context, pool *db.Connection, tx *sql.Tx) (history, registered []Migration, err error) {
+	// NOTE: A table created before the checksum column was added (and not yet
+	//       upgraded, e.g. in a dry run) can still be verified, without
+	//       checksums.
+	columns := "revision, previous, created_at"
+	hasChecksum, err := dbmigration.PredicateColumnExistsInSchema(ctx, pool, tx, m.metadataSchema(pool), m.MetadataTable, checksumColumn)
+	if err != nil {
+		return
+	}
+	if hasChecksum {
+		columns += ", " + checksumColumn
+	}
+
 	query := fmt.Sprintf(
-		"SELECT revision, previous, created_at FROM %s ORDER BY serial_id ASC",
-		providerQuoteIdentifier(m.MetadataTable),
+		"SELECT %s FROM %s ORDER BY serial_id ASC",
+		columns,
+		m.quoteTable(m.MetadataTable),
 	)
 	history, err = readAllMigration(ctx, pool, tx, query)
 	if err != nil {
@@ -280,6 +597,20 @@ func (m *Manager) verifyHistory(ctx context.Context, pool *db.Connection, tx *sq
 			err = ex.New(ErrMigrationMismatch)
 			return
 		}
+
+		// NOTE: Migrations applied before checksums were stored (or migrations
+		//       without a checksum) can't be verified. A baseline is also not
+		//       verified since the stored checksum may be for the migration
+		//       before it was squashed.
+		if expected.Baseline {
+			continue
+		}
+		if row.Checksum != "" && expected.Checksum != "" && row.Checksum != expected.Checksum {
+			body := fmt.Sprintf("Stored migration %d: %q has checksum %s but migration in sequence has checksum %s", i, row.Revision, row.Checksum, expected.Checksum)
+			suiteWrite(ctx, m.Log, "failed", body)
+			err = ex.New(ErrChecksumMismatch, ex.OptMessagef("Revision: %q", row.Revision))
+			return
+		}
 	}
 
 	return
@@ -1,6 +1,8 @@
 package golembic
 
 import (
+	"time"
+
 	"github.com/blend/go-sdk/ex"
 	"github.com/blend/go-sdk/logger"
 )
@@ -13,6 +15,43 @@ func OptManagerMetadataTable(table string) ManagerOption {
 	}
 }
 
+// OptManagerRepeatableTable sets the repeatable migrations metadata table
+// name on a manager.
+func OptManagerRepeatableTable(table string) ManagerOption {
+	return func(m *Manager) error {
+		m.RepeatableTable = table
+		return nil
+	}
+}
+
+// OptManagerMetadataSchema sets the schema containing the metadata tables on
+// a manager. Note that the table name set via `OptManagerMetadataTable()` is
+// always a single identifier, so a schema must be provided here rather than
+// as part of the table name.
+func OptManagerMetadataSchema(schema string) ManagerOption {
+	return func(m *Manager) error {
+		m.MetadataSchema = schema
+		return nil
+	}
+}
+
+// OptManagerCreateSchema sets `CreateSchema` on a manager.
+func OptManagerCreateSchema(create bool) ManagerOption {
+	return func(m *Manager) error {
+		m.CreateSchema = create
+		return nil
+	}
+}
+
+// OptManagerInProgressTable sets the name of the table used to mark
+// non-transactional migrations as in progress on a manager.
+func OptManagerInProgressTable(table string) ManagerOption {
+	return func(m *Manager) error {
+		m.InProgressTable = table
+		return nil
+	}
+}
+
 // OptManagerSequence sets the migrations sequence on a manager.
 func OptManagerSequence(migrations *Migrations) ManagerOption {
 	return func(m *Manager) error {
@@ -37,6 +76,193 @@ func OptDevelopmentMode(mode bool) ManagerOption {
 	}
 }
 
+// OptManagerHostname sets the hostname stored with each applied migration on
+// a manager.
+func OptManagerHostname(hostname string) ManagerOption {
+	return func(m *Manager) error {
+		m.Hostname = hostname
+		return nil
+	}
+}
+
+// OptManagerAppVersion sets the application version (e.g. a git SHA) stored
+// with each applied migration on a manager.
+func OptManagerAppVersion(version string) ManagerOption {
+	return func(m *Manager) error {
+		m.AppVersion = version
+		return nil
+	}
+}
+
+// OptManagerLockWait sets a manager to wait (indefinitely) for the advisory
+// lock that guards the metadata table.
+func OptManagerLockWait() ManagerOption {
+	return func(m *Manager) error {
+		m.LockMode = LockModeWait
+		m.LockTimeout = 0
+		return nil
+	}
+}
+
+// OptManagerLockTimeout sets a manager to wait for at most `timeout` for the
+// advisory lock that guards the metadata table.
+func OptManagerLockTimeout(timeout time.Duration) ManagerOption {
+	return func(m *Manager) error {
+		if timeout <= 0 {
+			return ex.New(ErrInvalidLockTimeout, ex.OptMessagef("Timeout: %s", timeout))
+		}
+
+		m.LockMode = LockModeTimeout
+		m.LockTimeout = timeout
+		return nil
+	}
+}
+
+// OptManagerLockFailFast sets a manager to fail immediately if the advisory
+// lock that guards the metadata table is held by another runner.
+func OptManagerLockFailFast() ManagerOption {
+	return func(m *Manager) error {
+		m.LockMode = LockModeFailFast
+		m.LockTimeout = 0
+		return nil
+	}
+}
+
+// OptManagerTimeouts sets the default timeouts used while applying each
+// migration. If the sequence has `UpConn` migrations, the connection pool
+// must be created with a `Config` (see `Timeouts`).
+func OptManagerTimeouts(timeouts Timeouts) ManagerOption {
+	return func(m *Manager) error {
+		err := timeouts.validate()
+		if err != nil {
+			return err
+		}
+
+		m.Timeouts = timeouts
+		return nil
+	}
+}
+
+// OptManagerRetryPolicy sets the retry policy for transient failures on a
+// manager.
+func OptManagerRetryPolicy(policy RetryPolicy) ManagerOption {
+	return func(m *Manager) error {
+		err := policy.validate()
+		if err != nil {
+			return err
+		}
+
+		m.RetryPolicy = policy
+		return nil
+	}
+}
+
+// OptManagerTracer sets the tracer on a manager.
+func OptManagerTracer(tracer Tracer) ManagerOption {
+	return func(m *Manager) error {
+		if tracer == nil {
+			return ex.New(ErrNilInterface)
+		}
+
+		m.Tracer = tracer
+		return nil
+	}
+}
+
+// OptManagerMeter sets the meter on a manager.
+func OptManagerMeter(meter Meter) ManagerOption {
+	return func(m *Manager) error {
+		if meter == nil {
+			return ex.New(ErrNilInterface)
+		}
+
+		m.Meter = meter
+		return nil
+	}
+}
+
+// OptManagerBeforePlan registers a hook on a manager that is invoked before
+// the migrations that need to be applied are determined.
+func OptManagerBeforePlan(hook BeforePlanHook) ManagerOption {
+	return func(m *Manager) error {
+		if hook == nil {
+			return ex.New(ErrNilInterface)
+		}
+
+		m.Hooks.BeforePlan = append(m.Hooks.BeforePlan, hook)
+		return nil
+	}
+}
+
+// OptManagerAfterPlan registers a hook on a manager that is invoked with the
+// migrations that will be applied.
+func OptManagerAfterPlan(hook AfterPlanHook) ManagerOption {
+	return func(m *Manager) error {
+		if hook == nil {
+			return ex.New(ErrNilInterface)
+		}
+
+		m.Hooks.AfterPlan = append(m.Hooks.AfterPlan, hook)
+		return nil
+	}
+}
+
+// OptManagerBeforeMigration registers a hook on a manager that is invoked
+// before each migration is applied; the hook can veto the migration by
+// returning an error.
+func OptManagerBeforeMigration(hook BeforeMigrationHook) ManagerOption {
+	return func(m *Manager) error {
+		if hook == nil {
+			return ex.New(ErrNilInterface)
+		}
+
+		m.Hooks.BeforeMigration = append(m.Hooks.BeforeMigration, hook)
+		return nil
+	}
+}
+
+// OptManagerAfterMigration registers a hook on a manager that is invoked
+// after each migration is applied (or fails).
+func OptManagerAfterMigration(hook AfterMigrationHook) ManagerOption {
+	return func(m *Manager) error {
+		if hook == nil {
+			return ex.New(ErrNilInterface)
+		}
+
+		m.Hooks.AfterMigration = append(m.Hooks.AfterMigration, hook)
+		return nil
+	}
+}
+
+// OptManagerOnComplete registers a hook on a manager that is invoked once
+// applying migrations is done.
+func OptManagerOnComplete(hook CompleteHook) ManagerOption {
+	return func(m *Manager) error {
+		if hook == nil {
+			return ex.New(ErrNilInterface)
+		}
+
+		m.Hooks.OnComplete = append(m.Hooks.OnComplete, hook)
+		return nil
+	}
+}
+
+// OptManagerSingleTransaction sets `SingleTransaction` on a manager.
+func OptManagerSingleTransaction(single bool) ManagerOption {
+	return func(m *Manager) error {
+		m.SingleTransaction = single
+		return nil
+	}
+}
+
+// OptManagerDryRun sets `DryRun` on a manager.
+func OptManagerDryRun(dryRun bool) ManagerOption {
+	return func(m *Manager) error {
+		m.DryRun = dryRun
+		return nil
+	}
+}
+
 // OptManagerLog sets the logger interface on a manager. If `log` is `nil`code man
 // the option will return an error.
 func OptManagerLog(log logger.Log) ManagerOption {
@@ -0,0 +1,355 @@
+package golembic
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/blend/go-sdk/db"
+	"github.com/blend/go-sdk/db/migration"
+	"github.com/blend/go-sdk/ex"
+)
+
+// NOTE: Ensure that
+//       * `metadataSchemaAction` satisfies `migration.Action`.
+var (
+	_ migration.Action = (*metadataSchemaAction)(nil)
+)
+
+const (
+	// MetadataSchemaVersion is the version of the schema for the migrations
+	// metadata table used by this package. An existing table at an earlier
+	// version is upgraded before migrations are planned.
+	MetadataSchemaVersion = 3
+	// metadataVersionPrefix is the prefix of the comment on the migrations
+	// metadata table that records the schema version.
+	metadataVersionPrefix = "golembic:schema_version="
+	// maxIdentifierLength is the maximum length (in bytes) of an identifier
+	// in PostgreSQL; longer identifiers are truncated.
+	maxIdentifierLength = 63
+)
+
+// metadataUpgrade is a single step in the evolution of the schema for the
+// migrations metadata table.
+type metadataUpgrade struct {
+	// Version is the schema version after this step is applied.
+	Version int
+	// Description is a short description of the step.
+	Description string
+	// Columns are the columns added in this step.
+	Columns []string
+	// Statements produces the statements that carry out this step.
+	Statements func(*Manager) []string
+}
+
+// metadataUpgrades are the steps used to create (and upgrade) the migrations
+// metadata table, in order. Each step must be safe to run against a table
+// where the step was carried out manually (e.g. via `IF NOT EXISTS`).
+var metadataUpgrades = []metadataUpgrade{
+	{
+		Version:     1,
+		Description: "Create migrations metadata table",
+		Columns:     []string{"serial_id", "revision", "previous", "created_at"},
+		Statements:  createMigrationsStatements,
+	},
+	{
+		Version:     2,
+		Description: "Add checksum column",
+		Columns:     []string{"checksum"},
+		Statements: func(m *Manager) []string {
+			return []string{addChecksumMigrationsSQL(m)}
+		},
+	},
+	{
+		Version:     3,
+		Description: "Add description, duration_ms, applied_by, hostname and app_version columns",
+		Columns:     []string{"description", "duration_ms", "applied_by", "hostname", "app_version"},
+		Statements: func(m *Manager) []string {
+			return []string{addAuditMigrationsSQL(m)}
+		},
+	},
+}
+
+// metadataState describes the current state of the migrations metadata table.
+type metadataState struct {
+	// Exists indicates if the table exists.
+	Exists bool
+	// Version is the schema version of the table. If the version has not
+	// been recorded (i.e. the table was created before schema versions were
+	// tracked), it is inferred from the columns in the table.
+	Version int
+	// Recorded indicates if the schema version is recorded on the table.
+	Recorded bool
+	// Columns is the set of columns in the table.
+	Columns map[string]bool
+	// Constraints is the set of (names of) constraints on the table.
+	Constraints map[string]bool
+}
+
+type tableCommentModel struct {
+	Comment string `db:"comment"`
+}
+
+type columnModel struct {
+	Name string `db:"column_name"`
+}
+
+type constraintModel struct {
+	Name string `db:"conname"`
+}
+
+// readMetadataState reads the current state of the migrations metadata table.
+func (m *Manager) readMetadataState(ctx context.Context, pool *db.Connection, tx *sql.Tx) (metadataState, error) {
+	state := metadataState{Columns: map[string]bool{}, Constraints: map[string]bool{}}
+	schema := m.metadataSchema(pool)
+
+	var comments []tableCommentModel
+	err := pool.Invoke(db.OptContext(ctx), db.OptTx(tx)).Query(
+		"SELECT COALESCE(obj_description(c.oid, 'pg_class'), '') AS comment "+
+			"FROM pg_catalog.pg_class c JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace "+
+			"WHERE c.relname = $1 AND n.nspname = $2 AND c.relkind IN ('r', 'p')",
+		m.MetadataTable,
+		schema,
+	).OutMany(&comments)
+	if err != nil {
+		return state, err
+	}
+	if len(comments) == 0 {
+		return state, nil
+	}
+	state.Exists = true
+
+	var columns []columnModel
+	err = pool.Invoke(db.OptContext(ctx), db.OptTx(tx)).Query(
+		"SELECT column_name FROM information_schema.columns WHERE table_name = $1 AND table_schema = $2",
+		m.MetadataTable,
+		schema,
+	).OutMany(&columns)
+	if err != nil {
+		return state, err
+	}
+	for _, column := range columns {
+		state.Columns[column.Name] = true
+	}
+
+	var constraints []constraintModel
+	err = pool.Invoke(db.OptContext(ctx), db.OptTx(tx)).Query(
+		"SELECT co.conname FROM pg_catalog.pg_constraint co "+
+			"JOIN pg_catalog.pg_class c ON c.oid = co.conrelid "+
+			"JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace "+
+			"WHERE c.relname = $1 AND n.nspname = $2",
+		m.MetadataTable,
+		schema,
+	).OutMany(&constraints)
+	if err != nil {
+		return state, err
+	}
+	for _, constraint := range constraints {
+		state.Constraints[constraint.Name] = true
+	}
+
+	version, ok := parseMetadataVersion(comments[0].Comment)
+	if ok {
+		state.Version = version
+		state.Recorded = true
+		return state, nil
+	}
+
+	// NOTE: A table that exists is at least at version 1; if any of the
+	//       columns from version 1 are missing, validation will fail.
+	state.Version = 1
+	for _, upgrade := range metadataUpgrades[1:] {
+		if !state.hasColumns(upgrade.Columns) {
+			break
+		}
+		state.Version = upgrade.Version
+	}
+	return state, nil
+}
+
+// hasColumns checks if all of `columns` are in the table.
+func (ms metadataState) hasColumns(columns []string) bool {
+	for _, column := range columns {
+		if !ms.Columns[column] {
+			return false
+		}
+	}
+	return true
+}
+
+// hasConstraint checks if the constraint produced by `format` is on the table,
+// either with its current name or a name used by an earlier version of this
+// package.
+func (ms metadataState) hasConstraint(format, table string) bool {
+	if ms.Constraints[constraintName(format, table)] {
+		return true
+	}
+	for _, name := range legacyConstraintNames(format, table) {
+		if ms.Constraints[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// pendingMetadataUpgrades determines the upgrade steps that have not been
+// carried out for the migrations metadata table.
+func pendingMetadataUpgrades(state metadataState) []metadataUpgrade {
+	if !state.Exists {
+		return metadataUpgrades
+	}
+
+	pending := []metadataUpgrade{}
+	for _, upgrade := range metadataUpgrades {
+		if upgrade.Version > state.Version {
+			pending = append(pending, upgrade)
+		}
+	}
+	return pending
+}
+
+// metadataUpgradeStatements produces the statements needed to bring the
+// migrations metadata table up to `MetadataSchemaVersion` (including
+// recording the version), for use in a dry run.
+func (m *Manager) metadataUpgradeStatements(state metadataState) []string {
+	statements := []string{}
+	for _, upgrade := range pendingMetadataUpgrades(state) {
+		statements = append(statements, upgrade.Statements(m)...)
+	}
+	if len(statements) > 0 || !state.Recorded {
+		statements = append(statements, commentMigrationsSQL(m, MetadataSchemaVersion))
+	}
+	return statements
+}
+
+// upgradeMetadataTable creates the migrations metadata table or upgrades an
+// existing table to `MetadataSchemaVersion`, then validates that the table
+// has the expected columns and constraints. The return value indicates if
+// any changes were made.
+func (m *Manager) upgradeMetadataTable(ctx context.Context, pool *db.Connection, tx *sql.Tx) (bool, error) {
+	state, err := m.readMetadataState(ctx, pool, tx)
+	if err != nil {
+		return false, err
+	}
+
+	if state.Version > MetadataSchemaVersion {
+		body := fmt.Sprintf("Metadata table %s is at schema version %d (newer than %d)", m.qualifiedName(m.MetadataTable), state.Version, MetadataSchemaVersion)
+		suiteWrite(ctx, m.Log, migration.StatSkipped, body)
+		return false, m.validateMetadataTable(ctx, state, MetadataSchemaVersion)
+	}
+
+	pending := pendingMetadataUpgrades(state)
+	if len(pending) == 0 && state.Recorded {
+		body := fmt.Sprintf("Metadata table %s is at schema version %d", m.qualifiedName(m.MetadataTable), state.Version)
+		suiteWrite(ctx, m.Log, migration.StatSkipped, body)
+		return false, m.validateMetadataTable(ctx, state, MetadataSchemaVersion)
+	}
+
+	for _, upgrade := range pending {
+		for _, statement := range upgrade.Statements(m) {
+			_, err = pool.Invoke(db.OptContext(ctx), db.OptTx(tx)).Exec(statement)
+			if err != nil {
+				return false, err
+			}
+		}
+		body := fmt.Sprintf("Upgrade metadata table %s to schema version %d: %s", m.qualifiedName(m.MetadataTable), upgrade.Version, upgrade.Description)
+		suiteWrite(ctx, m.Log, migration.StatApplied, body)
+	}
+
+	_, err = pool.Invoke(db.OptContext(ctx), db.OptTx(tx)).Exec(commentMigrationsSQL(m, MetadataSchemaVersion))
+	if err != nil {
+		return false, err
+	}
+	if len(pending) == 0 {
+		body := fmt.Sprintf("Record schema version %d for metadata table %s", MetadataSchemaVersion, m.qualifiedName(m.MetadataTable))
+		suiteWrite(ctx, m.Log, migration.StatApplied, body)
+	}
+
+	state, err = m.readMetadataState(ctx, pool, tx)
+	if err != nil {
+		return false, err
+	}
+	return true, m.validateMetadataTable(ctx, state, MetadataSchemaVersion)
+}
+
+// validateMetadataTable checks that the migrations metadata table has all of
+// the columns and constraints expected at `version`.
+func (m *Manager) validateMetadataTable(ctx context.Context, state metadataState, version int) error {
+	for _, upgrade := range metadataUpgrades {
+		if upgrade.Version > version {
+			break
+		}
+		for _, column := range upgrade.Columns {
+			if state.Columns[column] {
+				continue
+			}
+			body := fmt.Sprintf("Metadata table %s is missing column %s", m.qualifiedName(m.MetadataTable), column)
+			suiteWrite(ctx, m.Log, migration.StatFailed, body)
+			return ex.New(ErrInvalidMetadataTable, ex.OptMessagef("Table: %q, Column: %q", m.qualifiedName(m.MetadataTable), column))
+		}
+	}
+
+	for _, format := range migrationsConstraintFormats {
+		if state.hasConstraint(format, m.MetadataTable) {
+			continue
+		}
+		constraint := constraintName(format, m.MetadataTable)
+		body := fmt.Sprintf("Metadata table %s is missing constraint %s", m.qualifiedName(m.MetadataTable), constraint)
+		suiteWrite(ctx, m.Log, migration.StatFailed, body)
+		return ex.New(ErrInvalidMetadataTable, ex.OptMessagef("Table: %q, Constraint: %q", m.qualifiedName(m.MetadataTable), constraint))
+	}
+
+	return nil
+}
+
+// metadataSchemaAction creates (or upgrades) the migrations metadata table.
+type metadataSchemaAction struct {
+	m *Manager
+}
+
+// Action upgrades the migrations metadata table and counts the step as
+// applied (if changes were made) or skipped.
+func (msa *metadataSchemaAction) Action(ctx context.Context, pool *db.Connection, tx *sql.Tx) error {
+	upgraded, err := msa.m.upgradeMetadataTable(ctx, pool, tx)
+	suite := migration.GetContextSuite(ctx)
+	if suite == nil {
+		return err
+	}
+
+	suite.Total++
+	switch {
+	case err != nil:
+		suite.Failed++
+	case upgraded:
+		suite.Applied++
+	default:
+		suite.Skipped++
+	}
+	return err
+}
+
+// parseMetadataVersion parses the schema version from the comment on the
+// migrations metadata table.
+func parseMetadataVersion(comment string) (int, bool) {
+	if !strings.HasPrefix(comment, metadataVersionPrefix) {
+		return 0, false
+	}
+
+	version, err := strconv.Atoi(strings.TrimPrefix(comment, metadataVersionPrefix))
+	if err != nil || version < 1 {
+		return 0, false
+	}
+	return version, true
+}
+
+// normalizeIdentifier converts an identifier into the form used for
+// comparison with names stored by PostgreSQL, which folds unquoted
+// identifiers to lower case and truncates identifiers that are too long.
+func normalizeIdentifier(name string) string {
+	if len(name) > maxIdentifierLength {
+		name = name[:maxIdentifierLength]
+	}
+	return strings.ToLower(name)
+}
@@ -0,0 +1,205 @@
+package golembic_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/db"
+	"github.com/blend/go-sdk/logger"
+
+	golembic "github.com/dhermes/golembic-blend"
+)
+
+func TestGenerateSuite_MetadataUpgrade(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt := fmt.Sprintf("spam_%s_migrations", suffix)
+	t1 := fmt.Sprintf("spam1_%s", suffix)
+	t2 := fmt.Sprintf("spam2_%s", suffix)
+	t.Cleanup(func() {
+		for _, table := range []string{mt, t1, t2} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+	})
+	var logBuffer bytes.Buffer
+	log := logger.Memory(&logBuffer)
+
+	migrations, err := makeSequence(t1, t2, 2, false)
+	it.Nil(err)
+	m, err := golembic.NewManager(
+		golembic.OptManagerSequence(migrations),
+		golembic.OptManagerMetadataTable(mt),
+		golembic.OptManagerLog(log),
+	)
+	it.Nil(err)
+	suite, err := golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logBuffer.Reset()
+
+	// Make the table look like one created before schema version 3 (and
+	// before schema versions were recorded)
+	qmt := golembic.QuoteIdentifier(mt)
+	statements := []string{
+		fmt.Sprintf("ALTER TABLE %s DROP COLUMN description, DROP COLUMN duration_ms, DROP COLUMN applied_by, DROP COLUMN hostname, DROP COLUMN app_version", qmt),
+		fmt.Sprintf("COMMENT ON TABLE %s IS NULL", qmt),
+	}
+	for _, statement := range statements {
+		_, err = pool.Invoke(db.OptContext(ctx)).Exec(statement)
+		it.Nil(err)
+	}
+
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logLines := []string{
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 3: Add description, duration_ms, applied_by, hostname and app_version columns", mt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- plan -- No migrations to run; latest revision: ab1208989a3f",
+		"[db.migration.stats] 1 applied 0 skipped 0 failed 1 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// A table with every column but no recorded version only needs the
+	// version to be recorded
+	_, err = pool.Invoke(db.OptContext(ctx)).Exec(fmt.Sprintf("COMMENT ON TABLE %s IS NULL", qmt))
+	it.Nil(err)
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- applied -- Record schema version 3 for metadata table %s", mt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- plan -- No migrations to run; latest revision: ab1208989a3f",
+		"[db.migration.stats] 1 applied 0 skipped 0 failed 1 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// A table that is missing a constraint is not valid
+	uqConstraint := fmt.Sprintf("uq_%s_previous", mt)
+	_, err = pool.Invoke(db.OptContext(ctx)).Exec(fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s", qmt, uqConstraint))
+	it.Nil(err)
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	expected := fmt.Sprintf("Migrations metadata table does not match the expected schema; Table: %q, Constraint: %q", mt, uqConstraint)
+	it.Equal(expected, fmt.Sprintf("%v", err))
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
+		fmt.Sprintf("[db.migration] -- failed -- Metadata table %s is missing constraint %s", mt, uqConstraint),
+		"[db.migration.stats] 0 applied 0 skipped 1 failed 1 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+}
+
+func TestGenerateSuite_MetadataSchema(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	schema := fmt.Sprintf("eggs_%s", suffix)
+	// NOTE: The table name is long enough that some constraint names must be
+	//       shortened to fit in 63 bytes.
+	mt := fmt.Sprintf("eggs_%s_%s_migrations", suffix, strings.Repeat("x", 40))
+	t1 := fmt.Sprintf("eggs1_%s", suffix)
+	t2 := fmt.Sprintf("eggs2_%s", suffix)
+	t.Cleanup(func() {
+		for _, table := range []string{t1, t2} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+		it.Nil(dropSchema(ctx, pool, schema))
+	})
+	var logBuffer bytes.Buffer
+	log := logger.Memory(&logBuffer)
+
+	migrations, err := makeSequence(t1, t2, 2, false)
+	it.Nil(err)
+	m, err := golembic.NewManager(
+		golembic.OptManagerSequence(migrations),
+		golembic.OptManagerMetadataSchema(schema),
+		golembic.OptManagerCreateSchema(true),
+		golembic.OptManagerMetadataTable(mt),
+		golembic.OptManagerLog(log),
+	)
+	it.Nil(err)
+
+	suite, err := golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	qualified := schema + "." + mt
+	logLines := []string{
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 1: Create migrations metadata table", qualified),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 2: Add checksum column", qualified),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 3: Add description, duration_ms, applied_by, hostname and app_version columns", qualified),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- aa60f058f5f5 -- Create first table",
+		"[db.migration] -- ab1208989a3f -- Alter first table",
+		"[db.migration.stats] 3 applied 0 skipped 0 failed 3 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// The metadata table is in the schema, with 7 distinct constraints
+	var names []struct {
+		Name string `db:"conname"`
+	}
+	err = pool.Invoke(db.OptContext(ctx)).Query(
+		"SELECT co.conname FROM pg_catalog.pg_constraint co "+
+			"JOIN pg_catalog.pg_class c ON c.oid = co.conrelid "+
+			"JOIN pg_catalog.pg_namespace n ON n.oid = c.relnamespace "+
+			"WHERE c.relname = $1 AND n.nspname = $2",
+		mt,
+		schema,
+	).OutMany(&names)
+	it.Nil(err)
+	it.Len(names, 7)
+	for _, name := range names {
+		it.True(len(name.Name) <= 63)
+	}
+
+	// Applying again is a no-op and the history can be read
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", qualified),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- plan -- No migrations to run; latest revision: ab1208989a3f",
+		"[db.migration.stats] 0 applied 1 skipped 0 failed 1 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+
+	history, err := m.History(ctx, pool)
+	it.Nil(err)
+	it.Len(history, 2)
+}
+
+func dropSchema(ctx context.Context, pool *db.Connection, name string) error {
+	statement := fmt.Sprintf("DROP SCHEMA IF EXISTS %s CASCADE", golembic.QuoteIdentifier(name))
+	_, err := pool.Invoke(db.OptContext(ctx)).Exec(statement)
+	return err
+}
@@ -2,7 +2,9 @@ package golembic
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
 	"time"
 
@@ -12,6 +14,7 @@ import (
 
 const (
 	milestoneSuffix = " [MILESTONE]"
+	baselineSuffix  = " [BASELINE]"
 )
 
 // Migration represents an individual migration to be applied; typically as
@@ -38,6 +41,20 @@ type Migration struct {
 	// milestone marks the last point where old / new versions of application
 	// code should be expected to be able to interact with the current schema.
 	Milestone bool
+	// Baseline is a flag indicating if the current migration is a baseline.
+	// A baseline represents the "squashed" state of the database through
+	// this revision, i.e. `Up` / `UpConn` does the work of this migration
+	// **and** every migration before it. A baseline is only applied to an
+	// empty database; when it is, rows are written to the migrations metadata
+	// table for every migration through the baseline so that the history
+	// matches databases that applied each migration individually. Once a
+	// baseline exists, the migrations before it can be replaced by tombstones
+	// (see `Tombstone`).
+	Baseline bool
+	// Tombstone is a flag indicating if the current migration is a tombstone,
+	// i.e. a migration that only retains a `Previous` and `Revision` after
+	// being squashed into a later baseline. A tombstone can never be applied.
+	Tombstone bool
 	// Up is the function to be executed when a migration is being applied. Either
 	// this field or `UpConn` are required (not both) and this field should be
 	// the default choice in most cases. This function will be run in a transaction
@@ -48,6 +65,32 @@ type Migration struct {
 	// rare situations where a migration cannot run inside a transaction, e.g.
 	// a `CREATE UNIQUE INDEX CONCURRENTLY` statement.
 	UpConn UpMigrationConn
+	// CheckDone is an optional check for `UpConn` migrations. If an earlier
+	// attempt to apply the migration was interrupted (i.e. it is still marked
+	// as in progress), this determines if the work was already carried out,
+	// in which case the migration is recorded without running `UpConn` again.
+	CheckDone DoneCheck
+	// Cleanup is an optional function for `UpConn` migrations. If an earlier
+	// attempt to apply the migration was interrupted (and `CheckDone` does not
+	// determine that it is done), this is run before `UpConn` is retried,
+	// e.g. to drop an INVALID index left by `CREATE INDEX CONCURRENTLY`.
+	Cleanup UpMigrationConn
+	// Checksum is a digest of the contents of the migration. It is stored in
+	// the migrations metadata table when the migration is applied and is
+	// used to detect (when verifying history) that an already applied
+	// migration has been modified. This is set automatically for SQL
+	// migrations (e.g. via `OptUpFromSQL()`) and can optionally be provided
+	// for migrations that run Go functions. If empty, no verification occurs.
+	Checksum string
+	// Timeouts are the PostgreSQL timeouts (e.g. `lock_timeout`) set while
+	// applying this migration. Any timeouts not set here fall back to the
+	// defaults for the manager.
+	Timeouts Timeouts
+	// SQL is the statement executed by `Up` / `UpConn` for migrations created
+	// from SQL (e.g. via `OptUpFromSQL()`). It is used to display the
+	// migration in a dry run and will be empty for migrations that run Go
+	// functions.
+	SQL string
 	// createdAt is stored in the migrations metadata table and represents the
 	// moment when the migration was inserted into the table.  It is **not**
 	// exported because it is internal to the implementation and should not be
@@ -77,11 +120,23 @@ func NewMigration(opts ...MigrationOption) (*Migration, error) {
 // ExtendedDescription is an extended form of `m.Description` that also
 // incorporates other information like whether `m` is a milestone.
 func (m Migration) ExtendedDescription() string {
+	description := m.Description
+	if m.Baseline {
+		description += baselineSuffix
+	}
 	if m.Milestone {
-		return m.Description + milestoneSuffix
+		description += milestoneSuffix
 	}
 
-	return m.Description
+	return description
+}
+
+// IsTombstone indicates if `m` is a tombstone, i.e. a migration that only
+// retains a `Previous` and `Revision` after being squashed into a baseline.
+// A tombstone can never be applied. Note that a migration with neither `Up`
+// nor `UpConn` set is **not** a tombstone unless `Tombstone` is set.
+func (m Migration) IsTombstone() bool {
+	return m.Tombstone
 }
 
 // Like is "almost" an equality check, it compares the `Previous` and `Revision`.
@@ -104,6 +159,9 @@ func (m Migration) Compact() string {
 // sets the relevant timeouts when creating a new connection to make sure
 // migrations don't cause disruptions in application performance due to
 // accidentally holding locks for an extended period.
+//
+// NOTE: This does not set `Timeouts`; when a migration is applied by a
+// `Manager`, the timeouts are set before this is invoked.
 func (m Migration) InvokeUp(ctx context.Context, pool *db.Connection, tx *sql.Tx) error {
 	// Handle the `UpConn` case first.
 	if m.UpConn != nil {
@@ -121,3 +179,10 @@ func (m Migration) InvokeUp(ctx context.Context, pool *db.Connection, tx *sql.Tx
 
 	return m.Up(ctx, pool, tx)
 }
+
+// ChecksumSQL computes the checksum (a hex encoded SHA-256 digest) of a SQL
+// statement used in a migration.
+func ChecksumSQL(statement string) string {
+	digest := sha256.Sum256([]byte(statement))
+	return hex.EncodeToString(digest[:])
+}
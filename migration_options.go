@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"io/ioutil"
+	"time"
 
 	"github.com/blend/go-sdk/db"
 	"github.com/blend/go-sdk/ex"
@@ -45,6 +46,71 @@ func OptMilestone(milestone bool) MigrationOption {
 	}
 }
 
+// OptBaseline sets the baseline flag on a migration.
+func OptBaseline(baseline bool) MigrationOption {
+	return func(m *Migration) error {
+		m.Baseline = baseline
+		return nil
+	}
+}
+
+// OptTombstone sets the tombstone flag on a migration.
+func OptTombstone(tombstone bool) MigrationOption {
+	return func(m *Migration) error {
+		m.Tombstone = tombstone
+		return nil
+	}
+}
+
+// OptLockTimeout sets the `lock_timeout` used while applying a migration. For
+// an `UpConn` migration, the connection pool must be created with a `Config`
+// (see `Timeouts`).
+func OptLockTimeout(timeout time.Duration) MigrationOption {
+	return func(m *Migration) error {
+		t := m.Timeouts
+		t.LockTimeout = timeout
+		err := t.validate()
+		if err != nil {
+			return err
+		}
+
+		m.Timeouts = t
+		return nil
+	}
+}
+
+// OptStatementTimeout sets the `statement_timeout` used while applying a
+// migration.
+func OptStatementTimeout(timeout time.Duration) MigrationOption {
+	return func(m *Migration) error {
+		t := m.Timeouts
+		t.StatementTimeout = timeout
+		err := t.validate()
+		if err != nil {
+			return err
+		}
+
+		m.Timeouts = t
+		return nil
+	}
+}
+
+// OptIdleInTransactionSessionTimeout sets the
+// `idle_in_transaction_session_timeout` used while applying a migration.
+func OptIdleInTransactionSessionTimeout(timeout time.Duration) MigrationOption {
+	return func(m *Migration) error {
+		t := m.Timeouts
+		t.IdleInTransactionSessionTimeout = timeout
+		err := t.validate()
+		if err != nil {
+			return err
+		}
+
+		m.Timeouts = t
+		return nil
+	}
+}
+
 // OptUp sets the `up` function on a migration.
 func OptUp(up UpMigration) MigrationOption {
 	return func(m *Migration) error {
@@ -58,7 +124,8 @@ func OptUp(up UpMigration) MigrationOption {
 }
 
 // OptUpFromSQL returns an option that sets the `up` function to execute a
-// SQL statement.
+// SQL statement. The checksum (and SQL) of the migration will also be set from
+// the statement.
 func OptUpFromSQL(statement string) MigrationOption {
 	up := func(ctx context.Context, pool *db.Connection, tx *sql.Tx) error {
 		i := pool.Invoke(db.OptContext(ctx), db.OptTx(tx))
@@ -66,8 +133,11 @@ func OptUpFromSQL(statement string) MigrationOption {
 		return err
 	}
 
+	checksum := ChecksumSQL(statement)
 	return func(m *Migration) error {
 		m.Up = up
+		m.Checksum = checksum
+		m.SQL = statement
 		return nil
 	}
 }
@@ -96,7 +166,8 @@ func OptUpConn(up UpMigrationConn) MigrationOption {
 }
 
 // OptUpConnFromSQL returns an option that sets the non-transctional `up`
-// function to execute a SQL statement.
+// function to execute a SQL statement. The checksum (and SQL) of the migration
+// will also be set from the statement.
 func OptUpConnFromSQL(statement string) MigrationOption {
 	up := func(ctx context.Context, pool *db.Connection) error {
 		i := pool.Invoke(db.OptContext(ctx))
@@ -104,8 +175,11 @@ func OptUpConnFromSQL(statement string) MigrationOption {
 		return err
 	}
 
+	checksum := ChecksumSQL(statement)
 	return func(m *Migration) error {
 		m.UpConn = up
+		m.Checksum = checksum
+		m.SQL = statement
 		return nil
 	}
 }
@@ -121,6 +195,56 @@ func OptUpConnFromFile(filename string) MigrationOption {
 	return OptUpConnFromSQL(string(statement))
 }
 
+// OptCheckDone sets the check used to determine if an interrupted attempt
+// to apply a non-transactional migration already carried out the work.
+func OptCheckDone(check DoneCheck) MigrationOption {
+	return func(m *Migration) error {
+		if check == nil {
+			return ex.New(ErrNilInterface)
+		}
+
+		m.CheckDone = check
+		return nil
+	}
+}
+
+// OptCleanup sets the function used to clean up after an interrupted attempt
+// to apply a non-transactional migration.
+func OptCleanup(cleanup UpMigrationConn) MigrationOption {
+	return func(m *Migration) error {
+		if cleanup == nil {
+			return ex.New(ErrNilInterface)
+		}
+
+		m.Cleanup = cleanup
+		return nil
+	}
+}
+
+// OptCleanupFromSQL returns an option that sets the cleanup function for a
+// non-transactional migration to execute a SQL statement, e.g.
+// `DROP INDEX CONCURRENTLY IF EXISTS ...`.
+func OptCleanupFromSQL(statement string) MigrationOption {
+	cleanup := func(ctx context.Context, pool *db.Connection) error {
+		i := pool.Invoke(db.OptContext(ctx))
+		_, err := i.Exec(statement)
+		return err
+	}
+
+	return OptCleanup(cleanup)
+}
+
+// OptChecksum sets the checksum on a migration. This is intended for
+// migrations that run Go functions (e.g. via `OptUp()`), where the checksum
+// can't be determined automatically; callers are responsible for changing the
+// checksum whenever the behavior of the function changes.
+func OptChecksum(checksum string) MigrationOption {
+	return func(m *Migration) error {
+		m.Checksum = checksum
+		return nil
+	}
+}
+
 // OptAlwaysError returns an option that always returns an error.
 func OptAlwaysError(err error) MigrationOption {
 	return func(m *Migration) error {
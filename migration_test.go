@@ -0,0 +1,43 @@
+package golembic_test
+
+import (
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+
+	golembic "github.com/dhermes/golembic-blend"
+)
+
+func TestChecksumSQL(t *testing.T) {
+	it := assert.New(t)
+
+	it.Equal("e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", golembic.ChecksumSQL(""))
+
+	m, err := golembic.NewMigration(golembic.OptUpFromSQL("SELECT 1"))
+	it.Nil(err)
+	it.Equal(golembic.ChecksumSQL("SELECT 1"), m.Checksum)
+
+	m, err = golembic.NewMigration(golembic.OptUpConnFromSQL("SELECT 2"))
+	it.Nil(err)
+	it.Equal(golembic.ChecksumSQL("SELECT 2"), m.Checksum)
+
+	m, err = golembic.NewMigration(golembic.OptUp(nil), golembic.OptChecksum("v1"))
+	it.Nil(m)
+	it.NotNil(err)
+	m, err = golembic.NewMigration(golembic.OptChecksum("v1"))
+	it.Nil(err)
+	it.Equal("v1", m.Checksum)
+}
+
+func TestMigration_IsTombstone(t *testing.T) {
+	it := assert.New(t)
+
+	// A migration with neither `Up` nor `UpConn` is misconfigured, not a tombstone
+	m, err := golembic.NewMigration(golembic.OptRevision("2c9a1f0b7d3e"))
+	it.Nil(err)
+	it.False(m.IsTombstone())
+
+	m, err = golembic.NewMigration(golembic.OptRevision("2c9a1f0b7d3e"), golembic.OptTombstone(true))
+	it.Nil(err)
+	it.True(m.IsTombstone())
+}
@@ -15,7 +15,21 @@ var (
 // Migrations represents a sequence of migrations to be applied.
 type Migrations struct {
 	sequence map[string]Migration
-	lock     sync.Mutex
+	// root is the revision of the root migration.
+	root string
+	// next is an index from a revision to the revision of the migration
+	// immediately after it, i.e. it maps `previous -> revision`.
+	next map[string]string
+	// ordered is a cache of the migrations in the sequence, in order. It is
+	// computed lazily and invalidated whenever a migration is registered.
+	ordered []Migration
+	// positions is an index from a revision to its position in `ordered`;
+	// it is computed (and invalidated) along with `ordered`.
+	positions map[string]int
+	// repeatables are the registered repeatable migrations, in the order
+	// they should be applied.
+	repeatables []Migration
+	lock        sync.Mutex
 }
 
 // NewSequence creates a new sequence of migrations rooted in a single
@@ -37,6 +51,8 @@ func NewSequence(root Migration) (*Migrations, error) {
 		sequence: map[string]Migration{
 			root.Revision: root,
 		},
+		root: root.Revision,
+		next: map[string]string{},
 		lock: sync.Mutex{},
 	}
 	return m, nil
@@ -44,7 +60,8 @@ func NewSequence(root Migration) (*Migrations, error) {
 
 // Register adds a new migration to an existing sequence of migrations, if
 // possible. The new migration must have a previous migration and have a valid
-// revision that is not already registered.
+// revision that is not already registered. Additionally, no other migration
+// may have the same previous migration (i.e. the sequence can't branch).
 func (m *Migrations) Register(migration Migration) error {
 	m.lock.Lock()
 	defer m.lock.Unlock()
@@ -81,9 +98,20 @@ func (m *Migrations) Register(migration Migration) error {
 		return err
 	}
 
+	if existing, ok := m.next[migration.Previous]; ok {
+		err := ex.New(
+			ErrMultipleHeads,
+			ex.OptMessagef("Revisions %q and %q both have Previous: %q", existing, migration.Revision, migration.Previous),
+		)
+		return err
+	}
+
 	// NOTE: This crucially relies on `m.sequence` being locked.
 	migration.serialID = uint32(len(m.sequence))
 	m.sequence[migration.Revision] = migration
+	m.next[migration.Previous] = migration.Revision
+	m.ordered = nil
+	m.positions = nil
 	return nil
 }
 
@@ -120,9 +148,80 @@ func (m *Migrations) RegisterManyOpt(manyOpts ...[]MigrationOption) error {
 	return nil
 }
 
-// Root does a linear scan of every migration in the sequence and returns
-// the root migration. In the "general" case such a scan would be expensive, but
-// the number of migrations should always be a small number.
+// RegisterRepeatable adds a new repeatable migration. A repeatable migration
+// is intended for objects like views, functions and triggers that are
+// redefined over time; it is (re-)applied after all pending migrations in the
+// sequence whenever its checksum changes.
+//
+// A repeatable migration is identified by its `Revision`, which acts as a
+// stable name (rather than an identifier for a specific version). It must
+// have an `Up` function and a `Checksum` (which is set automatically by
+// `OptUpFromSQL()`) and can't have a previous migration. Repeatable migrations
+// are applied in the order they are registered.
+func (m *Migrations) RegisterRepeatable(migration Migration) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if migration.Revision == "" {
+		return ex.New(ErrMissingRevision)
+	}
+
+	invalid := ""
+	switch {
+	case migration.Previous != "":
+		invalid = "cannot have a previous migration"
+	case migration.Up == nil || migration.UpConn != nil:
+		invalid = "must set Up (and not UpConn)"
+	case migration.Checksum == "":
+		invalid = "must have a checksum"
+	case migration.Milestone || migration.Baseline:
+		invalid = "cannot be a milestone or baseline"
+	}
+	if invalid != "" {
+		err := ex.New(
+			ErrInvalidRepeatable,
+			ex.OptMessagef("Revision: %q, %s", migration.Revision, invalid),
+		)
+		return err
+	}
+
+	for _, existing := range m.repeatables {
+		if existing.Revision == migration.Revision {
+			err := ex.New(
+				ErrAlreadyRegistered,
+				ex.OptMessagef("Revision: %q", migration.Revision),
+			)
+			return err
+		}
+	}
+
+	m.repeatables = append(m.repeatables, migration)
+	return nil
+}
+
+// RegisterRepeatableOpt attempts to register a repeatable migration
+// constructed from a slice of options.
+func (m *Migrations) RegisterRepeatableOpt(opts ...MigrationOption) error {
+	migration, err := NewMigration(opts...)
+	if err != nil {
+		return err
+	}
+
+	return m.RegisterRepeatable(*migration)
+}
+
+// Repeatables produces the registered repeatable migrations, in the order
+// they were registered.
+func (m *Migrations) Repeatables() []Migration {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	result := make([]Migration, len(m.repeatables))
+	copy(result, m.repeatables)
+	return result
+}
+
+// Root returns the root migration.
 //
 // NOTE: This does not verify or enforce the invariant that there must be
 // exactly one migration without a previous migration. This invariant is enforced
@@ -132,84 +231,129 @@ func (m *Migrations) Root() Migration {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
-	for _, migration := range m.sequence {
-		if migration.Previous == "" {
-			return migration
-		}
-	}
-
-	return Migration{}
+	return m.sequence[m.root]
 }
 
 // All produces the migrations in the sequence, in order.
 //
+// The ordered migrations are cached, so repeated calls only pay the cost of
+// copying the cached slice (the cache is invalidated by `Register()`).
+//
 // NOTE: This does not verify or enforce the invariant that there must be
 //       exactly one migration without a previous migration. This invariant is
 //       enforced by the exported methods such as `Register()` and
 //       `RegisterMany()` and the constructor `NewSequence()`.
 func (m *Migrations) All() []Migration {
-	root := m.Root()
-
 	m.lock.Lock()
 	defer m.lock.Unlock()
-	result := []Migration{root}
-	// Find the unique revision (without validation) that points at the
-	// current `previous`.
-	previous := root.Revision
-	for i := 0; i < len(m.sequence)-1; i++ {
-		for _, migration := range m.sequence {
-			if migration.Previous != previous {
-				continue
-			}
-
-			result = append(result, migration)
-			previous = migration.Revision
-			break
-		}
-	}
 
+	ordered := m.orderedLocked()
+	result := make([]Migration, len(ordered))
+	copy(result, ordered)
 	return result
 }
 
 // Since returns the migrations that occur **after** `revision`.
 //
-// This utilizes `All()` and returns all migrations after the one that
-// matches `revision`. If none match, an error will be returned. If
-// `revision` is the **last** migration, the migrations returned will be an
-// empty slice.
+// This returns all migrations after the one that matches `revision`. If none
+// match, an error will be returned. If `revision` is the **last** migration,
+// the migrations returned will be an empty slice.
 func (m *Migrations) Since(revision string) (int, []Migration, error) {
-	all := m.All()
-	found := false
-
-	result := []Migration{}
-	pastMigrationCount := 0
-	for _, migration := range all {
-		if found {
-			result = append(result, migration)
-			continue
-		}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	ordered := m.orderedLocked()
+	index, ok := m.positions[revision]
+	if !ok {
+		err := ex.New(ErrMigrationNotRegistered, ex.OptMessagef("Revision: %q", revision))
+		return 0, nil, err
+	}
+
+	result := make([]Migration, len(ordered)-index-1)
+	copy(result, ordered[index+1:])
+	return index + 1, result, nil
+}
+
+// FromBaseline returns the migrations that should be applied to an empty
+// database, in order. This starts from the **last** baseline migration in
+// the sequence (i.e. skipping any migrations squashed into it) or includes
+// all migrations if there is no baseline.
+func (m *Migrations) FromBaseline() []Migration {
+	m.lock.Lock()
+	defer m.lock.Unlock()
 
-		pastMigrationCount++
-		if migration.Revision == revision {
-			found = true
+	ordered := m.orderedLocked()
+	start := 0
+	for i, migration := range ordered {
+		if migration.Baseline {
+			start = i
 		}
 	}
 
-	if !found {
+	result := make([]Migration, len(ordered)-start)
+	copy(result, ordered[start:])
+	return result
+}
+
+// Through returns the migrations that occur before `revision` as well as the
+// migration matching `revision`, in order. If none match, an error will be
+// returned.
+func (m *Migrations) Through(revision string) ([]Migration, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	ordered := m.orderedLocked()
+	index, ok := m.positions[revision]
+	if !ok {
 		err := ex.New(ErrMigrationNotRegistered, ex.OptMessagef("Revision: %q", revision))
-		return 0, nil, err
+		return nil, err
 	}
 
-	return pastMigrationCount, result, nil
+	result := make([]Migration, index+1)
+	copy(result, ordered[:index+1])
+	return result, nil
 }
 
-// Revisions produces the revisions in the sequence, in order.
+// orderedLocked returns the (cached) migrations in the sequence, in order,
+// computing them from the `previous -> revision` index if needed. The
+// returned slice must not be modified by the caller.
 //
-// This utilizes `All()` and just extracts the revisions.
+// NOTE: This crucially relies on `m.lock` being held by the caller.
+func (m *Migrations) orderedLocked() []Migration {
+	if m.ordered != nil {
+		return m.ordered
+	}
+
+	ordered := make([]Migration, 0, len(m.sequence))
+	positions := make(map[string]int, len(m.sequence))
+	current := m.sequence[m.root]
+	ordered = append(ordered, current)
+	positions[current.Revision] = 0
+	for {
+		revision, ok := m.next[current.Revision]
+		if !ok {
+			break
+		}
+
+		current = m.sequence[revision]
+		positions[revision] = len(ordered)
+		ordered = append(ordered, current)
+	}
+
+	m.ordered = ordered
+	m.positions = positions
+	return ordered
+}
+
+// Revisions produces the revisions in the sequence, in order.
 func (m *Migrations) Revisions() []string {
-	result := []string{}
-	for _, migration := range m.All() {
-		result = append(result, migration.Revision)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	ordered := m.orderedLocked()
+	result := make([]string, len(ordered))
+	for i, migration := range ordered {
+		result[i] = migration.Revision
 	}
 	return result
 }
@@ -1,10 +1,13 @@
 package golembic_test
 
 import (
+	"context"
+	"database/sql"
 	"fmt"
 	"testing"
 
 	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/db"
 	"github.com/blend/go-sdk/ex"
 
 	golembic "github.com/dhermes/golembic-blend"
@@ -94,6 +97,17 @@ func TestMigrations_Register(t *testing.T) {
 	expected = `Migration has already been registered; Revision: "9f67b79c824c"`
 	it.Equal(expected, fmt.Sprintf("%v", err))
 	it.Equal([]string{"9f67b79c824c", "24d7ac7c42c5"}, migrations.Revisions())
+
+	// `Previous` already has a migration after it (i.e. a branch)
+	migration = golembic.Migration{
+		Previous:    "9f67b79c824c",
+		Revision:    "e3b9f2d41c07",
+		Description: "The second (again)",
+	}
+	err = migrations.Register(migration)
+	expected = `Migration sequence has multiple heads; Revisions "24d7ac7c42c5" and "e3b9f2d41c07" both have Previous: "9f67b79c824c"`
+	it.Equal(expected, fmt.Sprintf("%v", err))
+	it.Equal([]string{"9f67b79c824c", "24d7ac7c42c5"}, migrations.Revisions())
 }
 
 func TestMigrations_RegisterMany(t *testing.T) {
@@ -181,3 +195,86 @@ func TestMigrations_Get(t *testing.T) {
 	migration := migrations.Get("ee6f7cc897ba")
 	it.Nil(migration)
 }
+
+func TestMigrations_FromBaseline(t *testing.T) {
+	it := assert.New(t)
+
+	migrations, err := golembic.NewSequence(golembic.Migration{Revision: "1e5d3c0b9a27"})
+	it.Nil(err)
+	it.Equal([]string{"1e5d3c0b9a27"}, revisionsOf(migrations.FromBaseline()))
+
+	err = migrations.RegisterMany(
+		golembic.Migration{Previous: "1e5d3c0b9a27", Revision: "6a0c4f2e8d1b", Baseline: true},
+		golembic.Migration{Previous: "6a0c4f2e8d1b", Revision: "b2d8f6a0c4e1"},
+		golembic.Migration{Previous: "b2d8f6a0c4e1", Revision: "0c4e1a7f3b9d", Baseline: true},
+		golembic.Migration{Previous: "0c4e1a7f3b9d", Revision: "9d5b3f1c7e0a"},
+	)
+	it.Nil(err)
+	it.Equal([]string{"0c4e1a7f3b9d", "9d5b3f1c7e0a"}, revisionsOf(migrations.FromBaseline()))
+
+	through, err := migrations.Through("b2d8f6a0c4e1")
+	it.Nil(err)
+	it.Equal([]string{"1e5d3c0b9a27", "6a0c4f2e8d1b", "b2d8f6a0c4e1"}, revisionsOf(through))
+
+	_, err = migrations.Through("ffffffffffff")
+	it.Equal(`No migration registered for revision; Revision: "ffffffffffff"`, fmt.Sprintf("%v", err))
+}
+
+func TestMigrations_RegisterRepeatable(t *testing.T) {
+	it := assert.New(t)
+
+	migrations, err := golembic.NewSequence(golembic.Migration{Revision: "1e5d3c0b9a27"})
+	it.Nil(err)
+	it.Equal([]golembic.Migration{}, migrations.Repeatables())
+
+	// Missing checksum
+	up := golembic.OptUp(func(_ context.Context, _ *db.Connection, _ *sql.Tx) error { return nil })
+	err = migrations.RegisterRepeatableOpt(golembic.OptRevision("active_users_view"), up)
+	it.Equal(`Invalid repeatable migration; Revision: "active_users_view", must have a checksum`, fmt.Sprintf("%v", err))
+
+	// Has a previous migration
+	err = migrations.RegisterRepeatableOpt(
+		golembic.OptRevision("active_users_view"),
+		golembic.OptPrevious("1e5d3c0b9a27"),
+		golembic.OptUpFromSQL("CREATE OR REPLACE VIEW active_users AS SELECT 1"),
+	)
+	it.Equal(`Invalid repeatable migration; Revision: "active_users_view", cannot have a previous migration`, fmt.Sprintf("%v", err))
+
+	// Non-transactional
+	err = migrations.RegisterRepeatableOpt(
+		golembic.OptRevision("active_users_view"),
+		golembic.OptUpConnFromSQL("CREATE OR REPLACE VIEW active_users AS SELECT 1"),
+	)
+	it.Equal(`Invalid repeatable migration; Revision: "active_users_view", must set Up (and not UpConn)`, fmt.Sprintf("%v", err))
+
+	// Success
+	err = migrations.RegisterRepeatableOpt(
+		golembic.OptRevision("active_users_view"),
+		golembic.OptUpFromSQL("CREATE OR REPLACE VIEW active_users AS SELECT 1"),
+	)
+	it.Nil(err)
+	err = migrations.RegisterRepeatableOpt(
+		golembic.OptRevision("touch_updated_at"),
+		up,
+		golembic.OptChecksum("v1"),
+	)
+	it.Nil(err)
+	it.Equal([]string{"active_users_view", "touch_updated_at"}, revisionsOf(migrations.Repeatables()))
+	// Repeatable migrations are not part of the sequence.
+	it.Equal([]string{"1e5d3c0b9a27"}, migrations.Revisions())
+
+	// Already registered
+	err = migrations.RegisterRepeatableOpt(
+		golembic.OptRevision("active_users_view"),
+		golembic.OptUpFromSQL("CREATE OR REPLACE VIEW active_users AS SELECT 2"),
+	)
+	it.Equal(`Migration has already been registered; Revision: "active_users_view"`, fmt.Sprintf("%v", err))
+}
+
+func revisionsOf(ms []golembic.Migration) []string {
+	result := make([]string, len(ms))
+	for i, migration := range ms {
+		result[i] = migration.Revision
+	}
+	return result
+}
@@ -0,0 +1,253 @@
+package golembic
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/blend/go-sdk/db"
+	"github.com/blend/go-sdk/db/migration"
+	"github.com/blend/go-sdk/ex"
+)
+
+// inProgressModel is a row in the table used to mark non-transactional
+// migrations as in progress.
+type inProgressModel struct {
+	Revision  string    `db:"revision"`
+	StartedAt time.Time `db:"started_at"`
+	Hostname  string    `db:"hostname"`
+	LastError string    `db:"last_error"`
+}
+
+// describe describes the earlier attempt that left the marker; a marker
+// without an error was left by an attempt that never finished (e.g. the
+// process crashed).
+func (ipm inProgressModel) describe() string {
+	if ipm.LastError == "" {
+		return fmt.Sprintf("started %s on %q; interrupted", ipm.StartedAt.Format(timeFormat), ipm.Hostname)
+	}
+	return fmt.Sprintf("started %s on %q; failed: %s", ipm.StartedAt.Format(timeFormat), ipm.Hostname, ipm.LastError)
+}
+
+// inProgressTable returns the name of the table used to mark
+// non-transactional migrations as in progress.
+func (m *Manager) inProgressTable() string {
+	if m.InProgressTable != "" {
+		return m.InProgressTable
+	}
+
+	return m.MetadataTable + inProgressTableSuffix
+}
+
+// hasNonTransactional indicates if any migration in the sequence must be
+// applied outside of a transaction (i.e. via `UpConn`), in which case the
+// in progress table is needed.
+func (m *Manager) hasNonTransactional() bool {
+	for _, mi := range m.Sequence.All() {
+		if mi.UpConn != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// inProgressTableExists indicates if the table used to mark non-transactional
+// migrations as in progress exists.
+func (m *Manager) inProgressTableExists(ctx context.Context, pool *db.Connection, tx *sql.Tx) (bool, error) {
+	return migration.PredicateTableExistsInSchema(ctx, pool, tx, m.metadataSchema(pool), m.inProgressTable())
+}
+
+// invokeUpConnTracked invokes a non-transactional migration, marking it as
+// in progress first. The marker is committed **before** `UpConn` is invoked
+// and removed within `tx`, i.e. in the same transaction that records the
+// migration. So if the process crashes (or `UpConn` fails) after the work
+// has started, the marker remains and is detected on the next attempt. If
+// `UpConn` fails, the error is recorded with the marker so the next attempt
+// can tell a failure from a crash.
+//
+// If the migration is already marked as in progress, `CheckDone` (if set)
+// determines if the work was already carried out and `Cleanup` (if set) is
+// run before `UpConn` is retried. If neither is set, it's not safe to retry
+// so `ErrInterruptedMigration` is returned.
+//
+// If the in progress table does not exist (e.g. when `ApplyMigration()` is
+// called directly rather than via `GenerateSuite()`), the migration is not
+// tracked.
+func (m *Manager) invokeUpConnTracked(ctx context.Context, pool *db.Connection, tx *sql.Tx, migration Migration) error {
+	tracked, err := m.inProgressTableExists(ctx, pool, tx)
+	if err != nil {
+		return err
+	}
+	if !tracked {
+		return m.invokeUp(ctx, pool, tx, migration)
+	}
+
+	marker, found, err := m.readInProgress(ctx, pool, tx, migration.Revision)
+	if err != nil {
+		return err
+	}
+
+	if !found {
+		err = m.markInProgress(ctx, pool, migration)
+		if err != nil {
+			return err
+		}
+	} else {
+		body := fmt.Sprintf("Found in progress marker from an earlier attempt (%s)", marker.describe())
+		PlanEventWrite(ctx, m.Log, migration.Revision, body, "")
+
+		if migration.CheckDone == nil && migration.Cleanup == nil {
+			message := fmt.Sprintf("Revision: %q, Started: %q, Hostname: %q", migration.Revision, marker.StartedAt.Format(timeFormat), marker.Hostname)
+			if marker.LastError != "" {
+				message += fmt.Sprintf(", Error: %q", marker.LastError)
+			}
+			return ex.New(ErrInterruptedMigration, ex.OptMessage(message))
+		}
+
+		if migration.CheckDone != nil {
+			done, err := migration.CheckDone(ctx, pool)
+			if err != nil {
+				return err
+			}
+			if done {
+				PlanEventWrite(ctx, m.Log, migration.Revision, "Earlier attempt is done; recording without running again", "")
+				return m.clearInProgress(ctx, pool, tx, migration.Revision)
+			}
+		}
+
+		if migration.Cleanup != nil {
+			PlanEventWrite(ctx, m.Log, migration.Revision, "Cleaning up after earlier attempt", "")
+			err = migration.Cleanup(ctx, pool)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	err = m.invokeUp(ctx, pool, tx, migration)
+	if err != nil {
+		recordErr := m.recordInProgressError(ctx, pool, migration.Revision, err)
+		if recordErr != nil {
+			return ex.Nest(err, recordErr)
+		}
+		return err
+	}
+
+	return m.clearInProgress(ctx, pool, tx, migration.Revision)
+}
+
+// readInProgress reads the in progress marker for `revision` (if any).
+func (m *Manager) readInProgress(ctx context.Context, pool *db.Connection, tx *sql.Tx, revision string) (inProgressModel, bool, error) {
+	query := fmt.Sprintf(
+		"SELECT revision, started_at, COALESCE(hostname, '') AS hostname, COALESCE(last_error, '') AS last_error FROM %s WHERE revision = %s",
+		m.quoteTable(m.inProgressTable()),
+		providerQueryParameter(1),
+	)
+	var rows []inProgressModel
+	err := pool.Invoke(db.OptContext(ctx), db.OptTx(tx)).Query(query, revision).OutMany(&rows)
+	if err != nil || len(rows) == 0 {
+		return inProgressModel{}, false, err
+	}
+
+	return rows[0], true, nil
+}
+
+// markInProgress marks a migration as in progress. This intentionally does
+// **not** use a transaction so the marker is committed immediately.
+func (m *Manager) markInProgress(ctx context.Context, pool *db.Connection, migration Migration) error {
+	statement, args := m.markInProgressStatement(migration)
+	_, err := pool.Invoke(db.OptContext(ctx)).Exec(statement, args...)
+	return err
+}
+
+// markInProgressStatement produces the statement (and parameters) used by
+// `markInProgress()`.
+func (m *Manager) markInProgressStatement(migration Migration) (string, []interface{}) {
+	statement := fmt.Sprintf(
+		"INSERT INTO %s (revision, hostname) VALUES (%s, %s)",
+		m.quoteTable(m.inProgressTable()),
+		providerQueryParameter(1),
+		providerQueryParameter(2),
+	)
+	args := []interface{}{
+		migration.Revision,         // Parameter 1
+		nullableString(m.Hostname), // Parameter 2
+	}
+	return statement, args
+}
+
+// recordInProgressError records the error from a failed attempt with the in
+// progress marker for `revision`. As with `markInProgress()`, this does
+// **not** use a transaction since the transaction for the migration will be
+// rolled back.
+func (m *Manager) recordInProgressError(ctx context.Context, pool *db.Connection, revision string, cause error) error {
+	statement := fmt.Sprintf(
+		"UPDATE %s SET last_error = %s WHERE revision = %s",
+		m.quoteTable(m.inProgressTable()),
+		providerQueryParameter(1),
+		providerQueryParameter(2),
+	)
+	_, err := pool.Invoke(db.OptContext(ctx)).Exec(statement, fmt.Sprintf("%v", cause), revision)
+	return err
+}
+
+// ClearInProgress removes the in progress marker left for `revision` by an
+// earlier attempt to apply a non-transactional migration. This is intended
+// for an operator who has finished (or undone) the work by hand; the next
+// attempt will then run `UpConn` as if for the first time. It is an error if
+// there is no marker for `revision`.
+func (m *Manager) ClearInProgress(ctx context.Context, pool *db.Connection, revision string) (err error) {
+	if m.LockMode != LockModeNone {
+		la := &lockAction{m: m, Connections: 2}
+		err = la.Action(ctx, pool, nil)
+		if err != nil {
+			return
+		}
+		defer la.release(ctx)
+	}
+
+	exists, err := m.inProgressTableExists(ctx, pool, nil)
+	if err != nil {
+		return
+	}
+	if !exists {
+		err = ex.New(ErrNotInProgress, ex.OptMessagef("Revision: %q", revision))
+		return
+	}
+
+	statement, args := m.clearInProgressStatement(revision)
+	result, err := pool.Invoke(db.OptContext(ctx)).Exec(statement, args...)
+	if err != nil {
+		return
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return
+	}
+	if rows == 0 {
+		err = ex.New(ErrNotInProgress, ex.OptMessagef("Revision: %q", revision))
+		return
+	}
+
+	PlanEventWrite(ctx, m.Log, revision, "Cleared in progress marker", "")
+	return
+}
+
+// clearInProgress removes the in progress marker for `revision`.
+func (m *Manager) clearInProgress(ctx context.Context, pool *db.Connection, tx *sql.Tx, revision string) error {
+	statement, args := m.clearInProgressStatement(revision)
+	_, err := pool.Invoke(db.OptContext(ctx), db.OptTx(tx)).Exec(statement, args...)
+	return err
+}
+
+// clearInProgressStatement produces the statement (and parameters) used by
+// `clearInProgress()`.
+func (m *Manager) clearInProgressStatement(revision string) (string, []interface{}) {
+	statement := fmt.Sprintf(
+		"DELETE FROM %s WHERE revision = %s",
+		m.quoteTable(m.inProgressTable()),
+		providerQueryParameter(1),
+	)
+	return statement, []interface{}{revision}
+}
@@ -0,0 +1,221 @@
+package golembic_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/db"
+	"github.com/blend/go-sdk/db/migration"
+	"github.com/blend/go-sdk/logger"
+
+	golembic "github.com/dhermes/golembic-blend"
+)
+
+func TestManager_ApplyMigration_InProgress(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt := fmt.Sprintf("jam_%s_migrations", suffix)
+	pt := mt + "_in_progress"
+	t1 := fmt.Sprintf("jam1_%s", suffix)
+	t.Cleanup(func() {
+		for _, table := range []string{mt, pt, t1} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+	})
+	var logBuffer bytes.Buffer
+	log := logger.Memory(&logBuffer)
+
+	idx1 := golembic.QuoteIdentifier(fmt.Sprintf("jam1_%s_bar", suffix))
+	idx2 := golembic.QuoteIdentifier(fmt.Sprintf("jam2_%s_bar", suffix))
+	createIndex1 := fmt.Sprintf("CREATE INDEX CONCURRENTLY %s ON %s (bar)", idx1, golembic.QuoteIdentifier(t1))
+	createIndex2 := fmt.Sprintf("CREATE UNIQUE INDEX CONCURRENTLY %s ON %s (bar)", idx2, golembic.QuoteIdentifier(t1))
+	index1Exists := func(ctx context.Context, pool *db.Connection) (bool, error) {
+		return pool.Invoke(db.OptContext(ctx)).Query(
+			"SELECT 1 FROM pg_catalog.pg_indexes WHERE indexname = $1",
+			fmt.Sprintf("jam1_%s_bar", suffix),
+		).Any()
+	}
+	makeManager := func(hooks ...golembic.MigrationOption) *golembic.Manager {
+		migrations, err := golembic.NewSequence(golembic.Migration{
+			Revision:    "aa60f058f5f5",
+			Description: "Create first table",
+			Up: func(ctx context.Context, pool *db.Connection, tx *sql.Tx) error {
+				_, err := pool.Invoke(db.OptContext(ctx), db.OptTx(tx)).Exec(
+					fmt.Sprintf("CREATE TABLE %s ( bar TEXT )", golembic.QuoteIdentifier(t1)),
+				)
+				return err
+			},
+		})
+		it.Nil(err)
+		err = migrations.RegisterManyOpt(
+			append([]golembic.MigrationOption{
+				golembic.OptPrevious("aa60f058f5f5"),
+				golembic.OptRevision("b7e1c2d3a4f5"),
+				golembic.OptDescription("Add index"),
+				golembic.OptUpConnFromSQL(createIndex1),
+			}, hooks...),
+			[]golembic.MigrationOption{
+				golembic.OptPrevious("b7e1c2d3a4f5"),
+				golembic.OptRevision("c4d5e6f7a8b9"),
+				golembic.OptDescription("Add unique index"),
+				golembic.OptUpConnFromSQL(createIndex2),
+				golembic.OptCleanupFromSQL(fmt.Sprintf("DROP INDEX CONCURRENTLY IF EXISTS %s", idx2)),
+			},
+		)
+		it.Nil(err)
+
+		m, err := golembic.NewManager(
+			golembic.OptManagerSequence(migrations),
+			golembic.OptManagerMetadataTable(mt),
+			golembic.OptManagerHostname("jam-host"),
+			golembic.OptManagerLog(log),
+		)
+		it.Nil(err)
+		return m
+	}
+	apply := func(m *golembic.Manager, opts ...golembic.ApplyOption) error {
+		suite, err := golembic.GenerateSuite(m, opts...)
+		it.Nil(err)
+		_, err = golembic.ApplyDynamic(ctx, suite, pool)
+		return err
+	}
+	exec := func(statement string) {
+		_, err := pool.Invoke(db.OptContext(ctx)).Exec(statement)
+		it.Nil(err)
+	}
+	markInProgress := fmt.Sprintf("INSERT INTO %s (revision, hostname) VALUES ('%%s', 'jam-host')", golembic.QuoteIdentifier(pt))
+
+	// Apply the root migration, which creates the in progress table
+	m := makeManager()
+	err := apply(m, golembic.OptApplyTarget("aa60f058f5f5"))
+	it.Nil(err)
+	it.Contains(logBuffer.String(), fmt.Sprintf("[db.migration] -- applied -- Check table does not exist: %s\n", pt))
+	logBuffer.Reset()
+
+	// Simulate a crash after the index was created, but before the migration
+	// was recorded
+	exec(createIndex1)
+	exec(fmt.Sprintf(markInProgress, "b7e1c2d3a4f5"))
+
+	// Without a check or cleanup, it isn't safe to continue
+	err = apply(m)
+	expected := `An earlier attempt to apply a non-transactional migration was interrupted; Revision: "b7e1c2d3a4f5"`
+	it.True(strings.HasPrefix(fmt.Sprintf("%v", err), expected))
+	it.Contains(logBuffer.String(), "[db.migration] -- b7e1c2d3a4f5 -- Found in progress marker from an earlier attempt (started ")
+	it.Contains(logBuffer.String(), `on "jam-host"; interrupted)`+"\n")
+	logBuffer.Reset()
+
+	// With a check, the migration is recorded without running it again; the
+	// next migration fails part way through, leaving its marker
+	m = makeManager(golembic.OptCheckDone(index1Exists))
+	exec(fmt.Sprintf("INSERT INTO %s (bar) VALUES ('dup'), ('dup')", golembic.QuoteIdentifier(t1)))
+	err = apply(m)
+	it.NotNil(err)
+	logText := logBuffer.String()
+	it.Contains(logText, "[db.migration] -- b7e1c2d3a4f5 -- Earlier attempt is done; recording without running again\n")
+	it.Contains(logText, "[db.migration] -- b7e1c2d3a4f5 -- Add index\n")
+	it.Contains(logText, "[db.migration.stats] 1 applied 2 skipped 1 failed 4 total\n")
+	logBuffer.Reset()
+
+	// The failure is recorded with the marker
+	var lastError string
+	marked, err := pool.Invoke(db.OptContext(ctx)).Query(
+		fmt.Sprintf("SELECT last_error FROM %s WHERE revision = 'c4d5e6f7a8b9'", golembic.QuoteIdentifier(pt)),
+	).Scan(&lastError)
+	it.Nil(err)
+	it.True(marked)
+	it.Contains(lastError, "could not create unique index")
+
+	// The unique index was left INVALID; the cleanup drops it before retrying
+	exec(fmt.Sprintf("DELETE FROM %s", golembic.QuoteIdentifier(t1)))
+	err = apply(m)
+	it.Nil(err)
+	logText = logBuffer.String()
+	it.Contains(logText, "[db.migration] -- c4d5e6f7a8b9 -- Found in progress marker from an earlier attempt (started ")
+	it.Contains(logText, `on "jam-host"; failed: `)
+	it.Contains(logText, "[db.migration] -- c4d5e6f7a8b9 -- Cleaning up after earlier attempt\n")
+	it.Contains(logText, "[db.migration] -- c4d5e6f7a8b9 -- Add unique index\n")
+
+	history, err := m.History(ctx, pool)
+	it.Nil(err)
+	it.Len(history, 3)
+	found, err := pool.Invoke(db.OptContext(ctx)).Query(fmt.Sprintf("SELECT 1 FROM %s", golembic.QuoteIdentifier(pt))).Any()
+	it.Nil(err)
+	it.False(found)
+
+	// A marker can be cleared by hand, but only if there is one
+	exec(fmt.Sprintf(markInProgress, "b7e1c2d3a4f5"))
+	logBuffer.Reset()
+	err = m.ClearInProgress(ctx, pool, "b7e1c2d3a4f5")
+	it.Nil(err)
+	it.Equal("[db.migration] -- b7e1c2d3a4f5 -- Cleared in progress marker\n", logBuffer.String())
+	err = m.ClearInProgress(ctx, pool, "b7e1c2d3a4f5")
+	it.Equal(`Migration is not marked as in progress; Revision: "b7e1c2d3a4f5"`, fmt.Sprintf("%v", err))
+}
+
+func TestManager_ApplyMigration_Untracked(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt := fmt.Sprintf("lime_%s_migrations", suffix)
+	t1 := fmt.Sprintf("lime1_%s", suffix)
+	t2 := fmt.Sprintf("lime2_%s", suffix)
+	t.Cleanup(func() {
+		for _, table := range []string{mt, t1, t2} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+	})
+	var logBuffer bytes.Buffer
+
+	// Apply a sequence without `UpConn` migrations, so the in progress table
+	// is not created
+	migrations, err := makeSequence(t1, t2, 1, false)
+	it.Nil(err)
+	m, err := golembic.NewManager(
+		golembic.OptManagerSequence(migrations),
+		golembic.OptManagerMetadataTable(mt),
+		golembic.OptManagerLog(logger.Memory(&logBuffer)),
+	)
+	it.Nil(err)
+	suite, err := golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+
+	// An `UpConn` migration applied directly is not tracked
+	err = m.Sequence.RegisterManyOpt([]golembic.MigrationOption{
+		golembic.OptPrevious("aa60f058f5f5"),
+		golembic.OptRevision("b7e1c2d3a4f5"),
+		golembic.OptDescription("Add second table"),
+		golembic.OptUpConnFromSQL(fmt.Sprintf("CREATE TABLE %s ( baz TEXT )", golembic.QuoteIdentifier(t2))),
+	})
+	it.Nil(err)
+	mi := m.Sequence.Get("b7e1c2d3a4f5")
+	it.NotNil(mi)
+	tx, err := pool.BeginContext(ctx)
+	it.Nil(err)
+	err = m.ApplyMigration(ctx, pool, tx, *mi)
+	it.Nil(err)
+	it.Nil(tx.Commit())
+
+	history, err := m.History(ctx, pool)
+	it.Nil(err)
+	it.Len(history, 2)
+	exists, err := migration.PredicateTableExists(ctx, pool, nil, mt+"_in_progress")
+	it.Nil(err)
+	it.False(exists)
+}
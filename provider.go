@@ -10,10 +10,18 @@ import (
 // have a need for that here.
 func providerNewCreateTableParameters() CreateTableParameters {
 	return CreateTableParameters{
-		SerialID:  "INTEGER NOT NULL",
-		Revision:  "VARCHAR(32) NOT NULL",
-		Previous:  "VARCHAR(32)",
-		CreatedAt: "TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP",
+		SerialID:    "INTEGER NOT NULL",
+		Revision:    "VARCHAR(32) NOT NULL",
+		Previous:    "VARCHAR(32)",
+		CreatedAt:   "TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP",
+		Checksum:    "VARCHAR(64)",
+		Description: "TEXT",
+		Duration:    "BIGINT",
+		AppliedBy:   "VARCHAR(255)",
+		Hostname:    "VARCHAR(255)",
+		AppVersion:  "VARCHAR(255)",
+		LastError:   "TEXT",
+		Name:        "VARCHAR(255) NOT NULL",
 	}
 }
 
@@ -25,6 +33,12 @@ func providerQuoteIdentifier(name string) string {
 	return QuoteIdentifier(name)
 }
 
+// providerQuoteQualifiedIdentifier is a concrete implementation for
+// PostgreSQL schema-qualified identifier quoting.
+func providerQuoteQualifiedIdentifier(schema, name string) string {
+	return QuoteQualifiedIdentifier(schema, name)
+}
+
 // providerQueryParameter is a concrete implementation for PostgreSQL
 // integer parameters. In `github.com/dhermes/golembic`, this is abstracted
 // away into the `EngineProvider` interface but we don't have a need for that
@@ -21,3 +21,31 @@ func QuoteIdentifier(name string) string {
 	}
 	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
 }
+
+// QuoteLiteral quotes a string literal for usage in a query. Queries should
+// prefer parameters, but this is safe to use in executed statements that
+// can't be parameterized, such as `COMMENT ON ... IS '...'`. Single quotes
+// are doubled and, if the literal contains a backslash, the backslashes are
+// doubled in an escape string (`E'...'`) so the literal is read back
+// unchanged whatever the value of `standard_conforming_strings`.
+//
+// See:
+// - https://github.com/lib/pq/blob/v1.8.0/conn.go#L1583-L1613
+func QuoteLiteral(literal string) string {
+	literal = strings.Replace(literal, `'`, `''`, -1)
+	if strings.Contains(literal, `\`) {
+		literal = strings.Replace(literal, `\`, `\\`, -1)
+		return `E'` + literal + `'`
+	}
+	return `'` + literal + `'`
+}
+
+// QuoteQualifiedIdentifier quotes an identifier qualified by a schema, such
+// as `"ops"."golembic_migrations"`, for usage in a query. If `schema` is
+// empty, this is equivalent to `QuoteIdentifier(name)`.
+func QuoteQualifiedIdentifier(schema, name string) string {
+	if schema == "" {
+		return QuoteIdentifier(name)
+	}
+	return QuoteIdentifier(schema) + "." + QuoteIdentifier(name)
+}
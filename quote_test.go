@@ -0,0 +1,44 @@
+package golembic_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/db"
+
+	golembic "github.com/dhermes/golembic-blend"
+)
+
+func TestQuoteLiteral(t *testing.T) {
+	it := assert.New(t)
+
+	it.Equal(`'golembic:schema_version=3'`, golembic.QuoteLiteral("golembic:schema_version=3"))
+	it.Equal(`'it''s'`, golembic.QuoteLiteral("it's"))
+	it.Equal(`E'a\\b'`, golembic.QuoteLiteral(`a\b`))
+	it.Equal(`E'a\\'' OR ''1''=''1'`, golembic.QuoteLiteral(`a\' OR '1'='1`))
+}
+
+func TestQuoteLiteral_Executed(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	literals := []string{"golembic:schema_version=3", "it's", `a\b`, `a\' OR '1'='1`, `\\'\`}
+	for _, literal := range literals {
+		var value string
+		_, err := pool.Invoke(db.OptContext(ctx)).Query("SELECT " + golembic.QuoteLiteral(literal)).Scan(&value)
+		it.Nil(err)
+		it.Equal(literal, value)
+	}
+}
+
+func TestQuoteQualifiedIdentifier(t *testing.T) {
+	it := assert.New(t)
+
+	it.Equal(`"golembic_migrations"`, golembic.QuoteQualifiedIdentifier("", "golembic_migrations"))
+	it.Equal(`"ops"."golembic_migrations"`, golembic.QuoteQualifiedIdentifier("ops", "golembic_migrations"))
+	it.Equal(`"ops.x"."a""b"`, golembic.QuoteQualifiedIdentifier("ops.x", `a"b`))
+}
@@ -0,0 +1,91 @@
+package golembic
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/blend/go-sdk/db"
+)
+
+// repeatableModel is a row in the repeatable migrations metadata table.
+type repeatableModel struct {
+	Name     string `db:"name"`
+	Checksum string `db:"checksum"`
+}
+
+// repeatableTable returns the name of the table that stores metadata for
+// repeatable migrations.
+func (m *Manager) repeatableTable() string {
+	if m.RepeatableTable != "" {
+		return m.RepeatableTable
+	}
+
+	return m.MetadataTable + repeatableTableSuffix
+}
+
+// PlanRepeatable determines the repeatable migrations that need to be applied,
+// i.e. those that have never been applied or whose checksum has changed since
+// they were last applied.
+//
+// NOTE: This assumes, but does not check, that the repeatable migrations
+// metadata table exists.
+func (m *Manager) PlanRepeatable(ctx context.Context, pool *db.Connection, tx *sql.Tx) ([]Migration, error) {
+	query := fmt.Sprintf(
+		"SELECT name, checksum FROM %s",
+		m.quoteTable(m.repeatableTable()),
+	)
+	var rows []repeatableModel
+	err := pool.Invoke(db.OptContext(ctx), db.OptTx(tx)).Query(query).OutMany(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := map[string]string{}
+	for _, row := range rows {
+		applied[row.Name] = row.Checksum
+	}
+
+	pending := []Migration{}
+	for _, migration := range m.Sequence.Repeatables() {
+		if applied[migration.Revision] == migration.Checksum {
+			continue
+		}
+		pending = append(pending, migration)
+	}
+
+	if len(pending) == 0 {
+		PlanEventWrite(ctx, m.Log, "", "No repeatable migrations to run", "")
+	}
+	return pending, nil
+}
+
+// ApplyRepeatable runs the "Up" function for a repeatable migration and
+// records the checksum in the repeatable migrations metadata table.
+func (m *Manager) ApplyRepeatable(ctx context.Context, pool *db.Connection, tx *sql.Tx, migration Migration) error {
+	err := m.invokeUp(ctx, pool, tx, migration)
+	if err != nil {
+		return err
+	}
+
+	statement, args := m.upsertRepeatableStatement(migration)
+	_, err = pool.Invoke(db.OptContext(ctx), db.OptTx(tx)).Exec(statement, args...)
+	return err
+}
+
+// upsertRepeatableStatement produces the statement (and parameters) used by
+// `ApplyRepeatable()` to record the checksum of a repeatable migration.
+func (m *Manager) upsertRepeatableStatement(migration Migration) (string, []interface{}) {
+	statement := fmt.Sprintf(
+		"INSERT INTO %[1]s (name, checksum) VALUES (%[2]s, %[3]s) "+
+			"ON CONFLICT (name) DO UPDATE SET checksum = EXCLUDED.checksum, applied_at = CURRENT_TIMESTAMP",
+		m.quoteTable(m.repeatableTable()), // [1]
+		providerQueryParameter(1),         // [2]
+		providerQueryParameter(2),         // [3]
+	)
+	args := []interface{}{
+		migration.Revision, // Parameter 1
+		migration.Checksum, // Parameter 2
+	}
+	return statement, args
+}
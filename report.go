@@ -0,0 +1,242 @@
+package golembic
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/blend/go-sdk/db/migration"
+)
+
+// runReportKey is the key used to store a `RunReport` in a context.
+type runReportKey struct{}
+
+// withRunReport returns a context containing `report`.
+func withRunReport(ctx context.Context, report *RunReport) context.Context {
+	return context.WithValue(ctx, runReportKey{}, report)
+}
+
+// getRunReport returns the `RunReport` in `ctx` (or `nil` if there is none).
+func getRunReport(ctx context.Context) *RunReport {
+	if ctx == nil {
+		return nil
+	}
+	if report, ok := ctx.Value(runReportKey{}).(*RunReport); ok {
+		return report
+	}
+	return nil
+}
+
+// MigrationReport describes a single migration in a `RunReport`.
+type MigrationReport struct {
+	Revision    string `json:"revision"`
+	Description string `json:"description"`
+	Milestone   bool   `json:"milestone,omitempty"`
+	Repeatable  bool   `json:"repeatable,omitempty"`
+	// Sequence is the name of the sequence the migration belongs to; it is
+	// only set when a coordinator suite is applied.
+	Sequence string `json:"sequence,omitempty"`
+	// DurationMS is the time taken to apply (or fail to apply) the migration.
+	DurationMS float64 `json:"durationMS,omitempty"`
+	// Error is the error that caused the migration to fail.
+	Error string `json:"error,omitempty"`
+}
+
+// BookkeepingReport counts the steps carried out by golembic itself (e.g.
+// creating or upgrading the metadata table) rather than by migrations.
+type BookkeepingReport struct {
+	Applied int `json:"applied"`
+	Skipped int `json:"skipped"`
+	Failed  int `json:"failed"`
+}
+
+// RunReport describes the outcome of applying a migrations suite. Unlike the
+// suite stats, the migrations in the report do not include golembic
+// bookkeeping; that is counted separately in `Bookkeeping`.
+type RunReport struct {
+	// StartRevision is the latest revision applied before the run. It is not
+	// set when a coordinator suite is applied.
+	StartRevision string `json:"startRevision"`
+	// EndRevision is the latest revision applied after the run. It is not set
+	// when a coordinator suite is applied.
+	EndRevision string `json:"endRevision"`
+	// Pending are the migrations that were planned to be applied.
+	Pending []MigrationReport `json:"pending"`
+	// Applied are the migrations that were applied.
+	Applied []MigrationReport `json:"applied"`
+	// Failed are the migrations that failed.
+	Failed []MigrationReport `json:"failed"`
+	// RolledBack are the migrations that were applied in a single
+	// transaction that was then rolled back.
+	RolledBack []MigrationReport `json:"rolledBack,omitempty"`
+	// Skipped are the migrations that were not applied, either because they
+	// were left for a later run (e.g. by a target revision) or because an
+	// earlier migration failed.
+	Skipped     []MigrationReport `json:"skipped"`
+	Bookkeeping BookkeepingReport `json:"bookkeeping"`
+	StartedAt   time.Time         `json:"startedAt"`
+	FinishedAt  time.Time         `json:"finishedAt"`
+	// Error is the error that stopped the run (if any).
+	Error string `json:"error,omitempty"`
+
+	// dryRun is the number of migrations emitted in a dry run; these are
+	// counted as skipped in the suite stats but are not bookkeeping.
+	dryRun int
+}
+
+// newRunReport creates a new `RunReport`; the slices are non-nil so that
+// they serialize to JSON as empty arrays rather than `null`.
+func newRunReport() *RunReport {
+	return &RunReport{
+		Pending:   []MigrationReport{},
+		Applied:   []MigrationReport{},
+		Failed:    []MigrationReport{},
+		Skipped:   []MigrationReport{},
+		StartedAt: time.Now().UTC(),
+	}
+}
+
+// newMigrationReport creates a new `MigrationReport` for `mi`.
+func newMigrationReport(ctx context.Context, mi Migration, repeatable bool) MigrationReport {
+	return MigrationReport{
+		Revision:    mi.Revision,
+		Description: mi.Description,
+		Milestone:   mi.Milestone,
+		Repeatable:  repeatable,
+		Sequence:    strings.Join(migration.GetContextLabels(ctx), "."),
+	}
+}
+
+// coordinated indicates if `ctx` is for a sequence within a coordinator
+// suite, in which case revisions from different sequences can't be compared.
+func coordinated(ctx context.Context) bool {
+	return len(migration.GetContextLabels(ctx)) > 0
+}
+
+// recordStart records the latest revision applied before the run.
+func recordStart(ctx context.Context, latest string) {
+	report := getRunReport(ctx)
+	if report == nil || coordinated(ctx) {
+		return
+	}
+
+	report.StartRevision = latest
+	report.EndRevision = latest
+}
+
+// recordPending records the migrations that were planned to be applied.
+func recordPending(ctx context.Context, migrations []Migration, repeatable bool) {
+	report := getRunReport(ctx)
+	if report == nil {
+		return
+	}
+
+	for _, mi := range migrations {
+		report.Pending = append(report.Pending, newMigrationReport(ctx, mi, repeatable))
+	}
+}
+
+// recordDeferred records the migrations that were left for a later run.
+func recordDeferred(ctx context.Context, migrations []Migration) {
+	report := getRunReport(ctx)
+	if report == nil {
+		return
+	}
+
+	for _, mi := range migrations {
+		report.Skipped = append(report.Skipped, newMigrationReport(ctx, mi, false))
+	}
+}
+
+// recordApply records a migration that was applied (or failed).
+func recordApply(ctx context.Context, mi Migration, repeatable bool, duration time.Duration, err error) {
+	report := getRunReport(ctx)
+	if report == nil {
+		return
+	}
+
+	mr := newMigrationReport(ctx, mi, repeatable)
+	mr.DurationMS = float64(duration) / float64(time.Millisecond)
+	if err != nil {
+		mr.Error = fmt.Sprintf("%v", err)
+		report.Failed = append(report.Failed, mr)
+		return
+	}
+
+	report.Applied = append(report.Applied, mr)
+	if !repeatable && !coordinated(ctx) {
+		report.EndRevision = mi.Revision
+	}
+}
+
+// recordDryRun records a migration that was emitted in a dry run (rather
+// than applied).
+func recordDryRun(ctx context.Context) {
+	report := getRunReport(ctx)
+	if report == nil {
+		return
+	}
+
+	report.dryRun++
+}
+
+// recordRollback records that the last `count` applied migrations were
+// rolled back.
+func recordRollback(ctx context.Context, count int) {
+	report := getRunReport(ctx)
+	if report == nil || count == 0 {
+		return
+	}
+
+	index := len(report.Applied) - count
+	report.RolledBack = append(report.RolledBack, report.Applied[index:]...)
+	report.Applied = report.Applied[:index]
+	if !coordinated(ctx) {
+		report.EndRevision = report.StartRevision
+		for _, mr := range report.Applied {
+			if !mr.Repeatable {
+				report.EndRevision = mr.Revision
+			}
+		}
+	}
+}
+
+// finish completes the report once the suite is done: pending migrations
+// that were never attempted are recorded as skipped and the suite stats not
+// accounted for by migrations are attributed to bookkeeping.
+func (rr *RunReport) finish(s *migration.Suite, err error) {
+	attempted := map[string]bool{}
+	for _, group := range [][]MigrationReport{rr.Applied, rr.Failed, rr.RolledBack} {
+		for _, mr := range group {
+			attempted[mr.Sequence+"/"+mr.Revision] = true
+		}
+	}
+	for _, mr := range rr.Pending {
+		if !attempted[mr.Sequence+"/"+mr.Revision] {
+			rr.Skipped = append(rr.Skipped, mr)
+		}
+	}
+
+	rr.Bookkeeping = BookkeepingReport{
+		Applied: s.Applied - len(rr.Applied),
+		Skipped: s.Skipped - rr.dryRun,
+		Failed:  s.Failed - len(rr.Failed),
+	}
+	rr.FinishedAt = time.Now().UTC()
+	if err != nil {
+		rr.Error = fmt.Sprintf("%v", err)
+	}
+}
+
+// writeReport writes `report` as indented JSON to the file at `path`.
+func writeReport(path string, report *RunReport) error {
+	content, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(content, '\n'), 0644)
+}
@@ -0,0 +1,186 @@
+package golembic_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/db"
+	"github.com/blend/go-sdk/logger"
+
+	golembic "github.com/dhermes/golembic-blend"
+)
+
+func TestRunReport_JSON(t *testing.T) {
+	it := assert.New(t)
+
+	report := golembic.RunReport{
+		StartRevision: "0e8a8ee5b2c1",
+		EndRevision:   "5b1a7bd2f4e0",
+		Pending:       []golembic.MigrationReport{},
+		Applied: []golembic.MigrationReport{
+			{Revision: "5b1a7bd2f4e0", Description: "Add index", Milestone: true, DurationMS: 12.5},
+		},
+		Failed:      []golembic.MigrationReport{},
+		Skipped:     []golembic.MigrationReport{},
+		Bookkeeping: golembic.BookkeepingReport{Skipped: 1},
+	}
+	asJSON, err := json.Marshal(report)
+	it.Nil(err)
+	expected := `{"startRevision":"0e8a8ee5b2c1","endRevision":"5b1a7bd2f4e0","pending":[],` +
+		`"applied":[{"revision":"5b1a7bd2f4e0","description":"Add index","milestone":true,"durationMS":12.5}],` +
+		`"failed":[],"skipped":[],"bookkeeping":{"applied":0,"skipped":1,"failed":0},` +
+		`"startedAt":"0001-01-01T00:00:00Z","finishedAt":"0001-01-01T00:00:00Z"}`
+	it.Equal(expected, string(asJSON))
+}
+
+func TestApplyDynamic_RunReport(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt := fmt.Sprintf("figs_%s_migrations", suffix)
+	t1 := fmt.Sprintf("figs1_%s", suffix)
+	t.Cleanup(func() {
+		for _, table := range []string{mt, t1} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+	})
+	var logBuffer bytes.Buffer
+	log := logger.Memory(&logBuffer)
+
+	migrations, err := golembic.NewSequence(golembic.Migration{
+		Revision:    "3c0d9f3e8a41",
+		Description: "Create first table",
+		Up: func(ctx context.Context, pool *db.Connection, tx *sql.Tx) error {
+			_, err := pool.Invoke(db.OptContext(ctx), db.OptTx(tx)).Exec(
+				fmt.Sprintf("CREATE TABLE %s ( bar TEXT )", golembic.QuoteIdentifier(t1)),
+			)
+			return err
+		},
+	})
+	it.Nil(err)
+	err = migrations.RegisterManyOpt([]golembic.MigrationOption{
+		golembic.OptPrevious("3c0d9f3e8a41"),
+		golembic.OptRevision("b2f6a01d7c95"),
+		golembic.OptDescription("Fail to alter first table"),
+		golembic.OptUp(func(context.Context, *db.Connection, *sql.Tx) error {
+			return errors.New("boom")
+		}),
+	})
+	it.Nil(err)
+	err = migrations.RegisterManyOpt([]golembic.MigrationOption{
+		golembic.OptPrevious("b2f6a01d7c95"),
+		golembic.OptRevision("e47a5c2b9d18"),
+		golembic.OptDescription("Add a column to first table"),
+		golembic.OptUpFromSQL(fmt.Sprintf("ALTER TABLE %s ADD COLUMN baz TEXT", golembic.QuoteIdentifier(t1))),
+	})
+	it.Nil(err)
+	m, err := golembic.NewManager(
+		golembic.OptManagerSequence(migrations),
+		golembic.OptManagerMetadataTable(mt),
+		golembic.OptManagerLog(log),
+	)
+	it.Nil(err)
+
+	// The migrations after the target revision are skipped
+	suite, err := golembic.GenerateSuite(m, golembic.OptApplyTarget("3c0d9f3e8a41"))
+	it.Nil(err)
+	report, err := golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	it.Equal("", report.StartRevision)
+	it.Equal("3c0d9f3e8a41", report.EndRevision)
+	it.Equal([]golembic.MigrationReport{{Revision: "3c0d9f3e8a41", Description: "Create first table"}}, report.Pending)
+	it.Len(report.Applied, 1)
+	it.Equal("3c0d9f3e8a41", report.Applied[0].Revision)
+	it.True(report.Applied[0].DurationMS > 0)
+	it.Empty(report.Failed)
+	expected := []golembic.MigrationReport{
+		{Revision: "b2f6a01d7c95", Description: "Fail to alter first table"},
+		{Revision: "e47a5c2b9d18", Description: "Add a column to first table"},
+	}
+	it.Equal(expected, report.Skipped)
+	it.Equal(golembic.BookkeepingReport{Applied: 1}, report.Bookkeeping)
+	it.Equal("", report.Error)
+
+	// A migration after a failure is skipped
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	report, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Equal("boom", fmt.Sprintf("%v", err))
+	it.Equal("3c0d9f3e8a41", report.StartRevision)
+	it.Equal("3c0d9f3e8a41", report.EndRevision)
+	it.Len(report.Pending, 2)
+	it.Empty(report.Applied)
+	it.Len(report.Failed, 1)
+	it.Equal("b2f6a01d7c95", report.Failed[0].Revision)
+	it.Equal("boom", report.Failed[0].Error)
+	expected = []golembic.MigrationReport{
+		{Revision: "e47a5c2b9d18", Description: "Add a column to first table"},
+	}
+	it.Equal(expected, report.Skipped)
+	it.Equal(golembic.BookkeepingReport{Skipped: 1}, report.Bookkeeping)
+	it.Equal("boom", report.Error)
+}
+
+func TestApplyDynamic_RunReportDryRun(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt := fmt.Sprintf("kale_%s_migrations", suffix)
+	t1 := fmt.Sprintf("kale1_%s", suffix)
+	t2 := fmt.Sprintf("kale2_%s", suffix)
+	t.Cleanup(func() {
+		for _, table := range []string{mt, t1, t2} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+	})
+	var logBuffer bytes.Buffer
+	log := logger.Memory(&logBuffer)
+
+	migrations, err := makeSequence(t1, t2, 2, false)
+	it.Nil(err)
+	m, err := golembic.NewManager(
+		golembic.OptManagerSequence(migrations),
+		golembic.OptManagerMetadataTable(mt),
+		golembic.OptManagerLog(log),
+	)
+	it.Nil(err)
+
+	// Apply the root migration, then dry run the rest
+	suite, err := golembic.GenerateSuite(m, golembic.OptApplyTarget("aa60f058f5f5"))
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+
+	m.DryRun = true
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	report, err := golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	it.Equal("aa60f058f5f5", report.StartRevision)
+	it.Equal("aa60f058f5f5", report.EndRevision)
+	expected := []golembic.MigrationReport{
+		{Revision: "ab1208989a3f", Description: "Alter first table"},
+	}
+	it.Equal(expected, report.Pending)
+	it.Empty(report.Applied)
+	it.Empty(report.Failed)
+	it.Equal(expected, report.Skipped)
+	// NOTE: The migration emitted in the dry run is counted as skipped in the
+	//       suite stats, but it is not bookkeeping.
+	it.Equal(golembic.BookkeepingReport{}, report.Bookkeeping)
+	it.Equal("", report.Error)
+}
@@ -0,0 +1,200 @@
+package golembic
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/blend/go-sdk/db"
+	"github.com/blend/go-sdk/ex"
+)
+
+const (
+	// SQLStateSerializationFailure is the PostgreSQL error code for a
+	// serialization failure, e.g. in a `SERIALIZABLE` transaction. This is
+	// **not** retryable by `IsRetryable()` since recovering requires a new
+	// transaction, rather than rolling back to a savepoint.
+	SQLStateSerializationFailure = "40001"
+	// SQLStateDeadlockDetected is the PostgreSQL error code for a deadlock.
+	SQLStateDeadlockDetected = "40P01"
+	// SQLStateLockNotAvailable is the PostgreSQL error code when a lock
+	// can't be acquired, e.g. because `lock_timeout` was exceeded.
+	SQLStateLockNotAvailable = "55P03"
+
+	// retrySavepoint is the name of the savepoint that each attempt to apply
+	// a migration is run in when retries are enabled.
+	retrySavepoint = "golembic_retry"
+)
+
+// RetryPolicy determines if (and how) a migration that fails with a transient
+// error (e.g. a deadlock) is retried. Only transactional migrations (i.e.
+// `Up` rather than `UpConn`) are retried; each attempt runs in a savepoint
+// that is rolled back before the next attempt. Since the attempts share a
+// transaction, only errors that leave the transaction usable once rolled
+// back to the savepoint (e.g. a deadlock or a lock timeout) can be retried.
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts to apply a migration,
+	// including the first. If less than 2, migrations are not retried.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry; the delay doubles
+	// with each retry after that.
+	InitialBackoff time.Duration
+	// MaxBackoff is the maximum delay between attempts. If not set, the delay
+	// stops doubling once doubling again would overflow.
+	MaxBackoff time.Duration
+	// Retryable determines if an error is transient. If not set,
+	// `IsRetryable()` is used.
+	Retryable func(error) bool
+}
+
+// Enabled indicates if the retry policy allows more than one attempt.
+func (rp RetryPolicy) Enabled() bool {
+	return rp.MaxAttempts > 1
+}
+
+// Backoff returns the delay after the failed `attempt` (starting from 1)
+// before the next attempt.
+func (rp RetryPolicy) Backoff(attempt int) time.Duration {
+	delay := rp.InitialBackoff
+	for i := 1; i < attempt; i++ {
+		if rp.MaxBackoff > 0 && delay >= rp.MaxBackoff {
+			break
+		}
+		// NOTE: Stop doubling before the delay overflows (and goes negative).
+		if delay > math.MaxInt64/2 {
+			break
+		}
+		delay *= 2
+	}
+
+	if rp.MaxBackoff > 0 && delay > rp.MaxBackoff {
+		return rp.MaxBackoff
+	}
+	return delay
+}
+
+// retryable determines if `err` is transient.
+func (rp RetryPolicy) retryable(err error) bool {
+	if rp.Retryable != nil {
+		return rp.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// validate ensures none of the values in the retry policy are negative and
+// that the maximum delay is not less than the initial delay.
+func (rp RetryPolicy) validate() error {
+	if rp.MaxAttempts < 0 || rp.InitialBackoff < 0 || rp.MaxBackoff < 0 {
+		err := ex.New(
+			ErrInvalidRetryPolicy,
+			ex.OptMessagef("MaxAttempts: %d, InitialBackoff: %s, MaxBackoff: %s", rp.MaxAttempts, rp.InitialBackoff, rp.MaxBackoff),
+		)
+		return err
+	}
+	if rp.MaxBackoff > 0 && rp.MaxBackoff < rp.InitialBackoff {
+		err := ex.New(
+			ErrInvalidRetryPolicy,
+			ex.OptMessagef("MaxBackoff %s is less than InitialBackoff %s", rp.MaxBackoff, rp.InitialBackoff),
+		)
+		return err
+	}
+	return nil
+}
+
+// SQLState returns the PostgreSQL error code (SQLSTATE) for `err`, or an
+// empty string if `err` did not come from PostgreSQL. This relies on the
+// error (or an error it wraps) having a `SQLState()` method, as the errors
+// from `github.com/jackc/pgconn` do.
+func SQLState(err error) string {
+	var coded interface{ SQLState() string }
+	if errors.As(err, &coded) {
+		return coded.SQLState()
+	}
+	return ""
+}
+
+// IsRetryable determines if `err` is a transient PostgreSQL error that is
+// likely to succeed if retried within the same transaction: a deadlock or a
+// lock that isn't available (e.g. due to `lock_timeout`). A serialization
+// failure is not retryable since the snapshot for the transaction can't be
+// used again.
+func IsRetryable(err error) bool {
+	switch SQLState(err) {
+	case SQLStateDeadlockDetected, SQLStateLockNotAvailable:
+		return true
+	default:
+		return false
+	}
+}
+
+// applyWithRetry invokes `apply` for a migration, retrying according to the
+// retry policy of the manager. Each attempt, and each failed attempt that
+// will be retried, is reported as a plan event.
+func (m *Manager) applyWithRetry(ctx context.Context, pool *db.Connection, tx *sql.Tx, mi Migration, apply func() error) error {
+	policy := m.RetryPolicy
+	if !policy.Enabled() || tx == nil || mi.UpConn != nil {
+		return apply()
+	}
+
+	exec := func(statement string) error {
+		_, err := pool.Invoke(db.OptContext(ctx), db.OptTx(tx)).Exec(statement)
+		return err
+	}
+	for attempt := 1; ; attempt++ {
+		status := PlanStatusUnset
+		if attempt > 1 {
+			status = PlanStatusRetrying
+		}
+		PlanEventWrite(ctx, m.Log, mi.Revision, fmt.Sprintf("Attempt %d of %d", attempt, policy.MaxAttempts), status)
+
+		err := exec("SAVEPOINT " + retrySavepoint)
+		if err != nil {
+			return err
+		}
+
+		err = apply()
+		if err == nil {
+			return exec("RELEASE SAVEPOINT " + retrySavepoint)
+		}
+		if !policy.retryable(err) {
+			return err
+		}
+		if attempt >= policy.MaxAttempts {
+			body := fmt.Sprintf("Attempt %d of %d failed (SQLSTATE %s); giving up", attempt, policy.MaxAttempts, SQLState(err))
+			PlanEventWrite(ctx, m.Log, mi.Revision, body, PlanStatusRetrying)
+			return err
+		}
+
+		rollbackErr := exec("ROLLBACK TO SAVEPOINT " + retrySavepoint)
+		if rollbackErr != nil {
+			return ex.Nest(err, rollbackErr)
+		}
+
+		delay := policy.Backoff(attempt)
+		body := fmt.Sprintf("Attempt %d of %d failed (SQLSTATE %s); retrying in %s", attempt, policy.MaxAttempts, SQLState(err), delay)
+		PlanEventWrite(ctx, m.Log, mi.Revision, body, PlanStatusRetrying)
+		err = sleepContext(ctx, delay)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// sleepContext waits for `d` or until `ctx` is done, whichever comes first.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
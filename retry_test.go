@@ -0,0 +1,227 @@
+package golembic_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/db"
+	"github.com/blend/go-sdk/ex"
+	"github.com/blend/go-sdk/logger"
+
+	golembic "github.com/dhermes/golembic-blend"
+)
+
+// sqlStateError is a stand-in for a driver error with an error code.
+type sqlStateError struct {
+	code string
+}
+
+func (sse sqlStateError) Error() string {
+	return fmt.Sprintf("SQLSTATE %s", sse.code)
+}
+
+func (sse sqlStateError) SQLState() string {
+	return sse.code
+}
+
+func TestIsRetryable(t *testing.T) {
+	it := assert.New(t)
+
+	it.True(golembic.IsRetryable(sqlStateError{code: "40P01"}))
+	it.False(golembic.IsRetryable(sqlStateError{code: "40001"}))
+	it.True(golembic.IsRetryable(sqlStateError{code: "55P03"}))
+	it.False(golembic.IsRetryable(sqlStateError{code: "42P07"}))
+	it.False(golembic.IsRetryable(errors.New("not from the database")))
+	it.False(golembic.IsRetryable(nil))
+
+	// Wrapped errors
+	wrapped := fmt.Errorf("applying: %w", sqlStateError{code: "40P01"})
+	it.Equal("40P01", golembic.SQLState(wrapped))
+	it.True(golembic.IsRetryable(wrapped))
+	it.Equal("55P03", golembic.SQLState(ex.New(sqlStateError{code: "55P03"})))
+	it.Equal("", golembic.SQLState(errors.New("not from the database")))
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	it := assert.New(t)
+
+	rp := golembic.RetryPolicy{MaxAttempts: 5, InitialBackoff: 100 * time.Millisecond}
+	it.True(rp.Enabled())
+	it.Equal(100*time.Millisecond, rp.Backoff(1))
+	it.Equal(200*time.Millisecond, rp.Backoff(2))
+	it.Equal(400*time.Millisecond, rp.Backoff(3))
+
+	rp.MaxBackoff = 300 * time.Millisecond
+	it.Equal(300*time.Millisecond, rp.Backoff(3))
+	it.Equal(300*time.Millisecond, rp.Backoff(30))
+
+	// Without a maximum, the delay stops doubling before it overflows
+	rp.MaxBackoff = 0
+	it.Equal((100*time.Millisecond)<<36, rp.Backoff(37))
+	it.Equal((100*time.Millisecond)<<36, rp.Backoff(100))
+
+	it.False(golembic.RetryPolicy{MaxAttempts: 1}.Enabled())
+	it.False(golembic.RetryPolicy{}.Enabled())
+}
+
+func TestOptManagerRetryPolicy(t *testing.T) {
+	it := assert.New(t)
+
+	rp := golembic.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	m, err := golembic.NewManager(golembic.OptManagerRetryPolicy(rp))
+	it.Nil(err)
+	it.Equal(3, m.RetryPolicy.MaxAttempts)
+
+	m, err = golembic.NewManager(golembic.OptManagerRetryPolicy(golembic.RetryPolicy{MaxAttempts: -1}))
+	it.Nil(m)
+	it.Equal("Invalid retry policy; MaxAttempts: -1, InitialBackoff: 0s, MaxBackoff: 0s", fmt.Sprintf("%v", err))
+
+	m, err = golembic.NewManager(golembic.OptManagerRetryPolicy(golembic.RetryPolicy{InitialBackoff: time.Second, MaxBackoff: time.Millisecond}))
+	it.Nil(m)
+	it.Equal("Invalid retry policy; MaxBackoff 1ms is less than InitialBackoff 1s", fmt.Sprintf("%v", err))
+}
+
+func TestGenerateSuite_Retry(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt := fmt.Sprintf("nog_%s_migrations", suffix)
+	t1 := fmt.Sprintf("nog1_%s", suffix)
+	t.Cleanup(func() {
+		for _, table := range []string{mt, t1} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+	})
+	var logBuffer bytes.Buffer
+	log := logger.Memory(&logBuffer)
+
+	// NOTE: The migration creates the table **before** failing, so a retry
+	//       only succeeds if the failed attempt was rolled back.
+	failures := []string{"40P01", "55P03"}
+	up := func(ctx context.Context, pool *db.Connection, tx *sql.Tx) error {
+		_, err := pool.Invoke(db.OptContext(ctx), db.OptTx(tx)).Exec(
+			fmt.Sprintf("CREATE TABLE %s ( bar TEXT )", golembic.QuoteIdentifier(t1)),
+		)
+		if err != nil {
+			return err
+		}
+		if len(failures) == 0 {
+			return nil
+		}
+
+		code := failures[0]
+		failures = failures[1:]
+		return sqlStateError{code: code}
+	}
+	migrations, err := golembic.NewSequence(golembic.Migration{
+		Revision:    "aa60f058f5f5",
+		Description: "Create first table",
+		Up:          up,
+	})
+	it.Nil(err)
+	m, err := golembic.NewManager(
+		golembic.OptManagerSequence(migrations),
+		golembic.OptManagerMetadataTable(mt),
+		golembic.OptManagerLog(log),
+		golembic.OptManagerRetryPolicy(golembic.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}),
+	)
+	it.Nil(err)
+
+	suite, err := golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logLines := []string{
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 1: Create migrations metadata table", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 2: Add checksum column", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 3: Add description, duration_ms, applied_by, hostname and app_version columns", mt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- aa60f058f5f5 -- Attempt 1 of 3",
+		"[db.migration] -- aa60f058f5f5 -- Attempt 1 of 3 failed (SQLSTATE 40P01); retrying in 1ms",
+		"[db.migration] -- aa60f058f5f5 -- Attempt 2 of 3",
+		"[db.migration] -- aa60f058f5f5 -- Attempt 2 of 3 failed (SQLSTATE 55P03); retrying in 2ms",
+		"[db.migration] -- aa60f058f5f5 -- Attempt 3 of 3",
+		"[db.migration] -- aa60f058f5f5 -- Create first table",
+		"[db.migration.stats] 2 applied 0 skipped 0 failed 2 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// A migration that keeps failing gives up after the last attempt
+	failures = []string{"55P03", "55P03", "55P03"}
+	err = migrations.RegisterManyOpt([]golembic.MigrationOption{
+		golembic.OptPrevious("aa60f058f5f5"),
+		golembic.OptRevision("ab1208989a3f"),
+		golembic.OptDescription("Recreate first table"),
+		golembic.OptUp(func(ctx context.Context, pool *db.Connection, tx *sql.Tx) error {
+			_, err := pool.Invoke(db.OptContext(ctx), db.OptTx(tx)).Exec(
+				fmt.Sprintf("DROP TABLE %s", golembic.QuoteIdentifier(t1)),
+			)
+			if err != nil {
+				return err
+			}
+			return up(ctx, pool, tx)
+		}),
+	})
+	it.Nil(err)
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Equal("SQLSTATE 55P03", fmt.Sprintf("%v", err))
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- ab1208989a3f -- Attempt 1 of 3",
+		"[db.migration] -- ab1208989a3f -- Attempt 1 of 3 failed (SQLSTATE 55P03); retrying in 1ms",
+		"[db.migration] -- ab1208989a3f -- Attempt 2 of 3",
+		"[db.migration] -- ab1208989a3f -- Attempt 2 of 3 failed (SQLSTATE 55P03); retrying in 2ms",
+		"[db.migration] -- ab1208989a3f -- Attempt 3 of 3",
+		"[db.migration] -- ab1208989a3f -- Attempt 3 of 3 failed (SQLSTATE 55P03); giving up",
+		"[db.migration] -- ab1208989a3f -- Recreate first table",
+		"[db.migration.stats] 0 applied 1 skipped 1 failed 2 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// A serialization failure can't be recovered from within the transaction,
+	// so it is not retried
+	err = migrations.RegisterManyOpt([]golembic.MigrationOption{
+		golembic.OptPrevious("ab1208989a3f"),
+		golembic.OptRevision("60a33b9d4c77"),
+		golembic.OptDescription("Fail to serialize"),
+		golembic.OptUpFromSQL("DO $$ BEGIN RAISE EXCEPTION 'could not serialize access' USING ERRCODE = '40001'; END $$"),
+	})
+	it.Nil(err)
+	failures = []string{}
+	suite, err = golembic.GenerateSuite(m, golembic.OptApplyTarget("ab1208989a3f"))
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logBuffer.Reset()
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Equal("40001", golembic.SQLState(err))
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- 60a33b9d4c77 -- Attempt 1 of 3",
+		"[db.migration] -- 60a33b9d4c77 -- Fail to serialize",
+		"[db.migration.stats] 0 applied 1 skipped 1 failed 2 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+}
@@ -0,0 +1,234 @@
+package golembic
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/blend/go-sdk/ex"
+)
+
+const (
+	// revisionBytes is the number of random bytes used to generate a new
+	// revision. When hex encoded, this produces a 12 character revision which
+	// fits comfortably in the `VARCHAR(32)` revision column of the metadata
+	// table.
+	revisionBytes = 6
+	// newRevisionAttempts is the number of attempts made to generate a new
+	// revision that doesn't collide with an existing revision.
+	newRevisionAttempts = 8
+	// maxRevisionLength is the length of the `VARCHAR(32)` revision column of
+	// the metadata table.
+	maxRevisionLength = 32
+)
+
+// NewRevision generates a new random revision identifier, e.g.
+// `3f34bd961f15`.
+func NewRevision() (string, error) {
+	b := make([]byte, revisionBytes)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// Scaffold describes a new migration file to be added to the end of an
+// existing sequence.
+type Scaffold struct {
+	// Revision is the (randomly generated, by default) revision of the new
+	// migration.
+	Revision string
+	// Previous is the revision of the current head of the sequence, or empty
+	// if the new migration will be the root.
+	Previous string
+	// Description is the description of the new migration.
+	Description string
+	// Milestone indicates if the new migration is a milestone.
+	Milestone bool
+	// Transactional indicates if the new migration should run in a
+	// transaction, i.e. via `Up` rather than `UpConn`. Defaults to `true`.
+	Transactional bool
+	// Index is the 1-based position of the new migration in the sequence. It
+	// is only used to determine the filename.
+	Index int
+}
+
+// NewScaffold creates a scaffold for the next migration in `migrations`. If
+// `migrations` is `nil`, the scaffold will be for a root migration.
+func NewScaffold(migrations *Migrations, opts ...ScaffoldOption) (*Scaffold, error) {
+	s := &Scaffold{Transactional: true, Index: 1}
+	if migrations != nil {
+		all := migrations.All()
+		s.Previous = all[len(all)-1].Revision
+		s.Index = len(all) + 1
+	}
+
+	for _, opt := range opts {
+		err := opt(s)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// NOTE: The description is written on a single header line, so a newline
+	//       would produce a header that `LoadSequence()` misparses.
+	if strings.ContainsAny(s.Description, "\r\n") {
+		return nil, ex.New(ErrInvalidDescription, ex.OptMessagef("Description: %q", s.Description))
+	}
+
+	if s.Revision != "" {
+		err := validateRevision(migrations, s.Revision)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	for i := 0; i < newRevisionAttempts; i++ {
+		revision, err := NewRevision()
+		if err != nil {
+			return nil, err
+		}
+		if migrations == nil || migrations.Get(revision) == nil {
+			s.Revision = revision
+			return s, nil
+		}
+	}
+
+	return nil, ex.New(ErrAlreadyRegistered, ex.OptMessage("Could not generate an unused revision"))
+}
+
+// validateRevision ensures a caller-supplied revision fits in the metadata
+// table and is not already registered in `migrations`.
+func validateRevision(migrations *Migrations, revision string) error {
+	if utf8.RuneCountInString(revision) > maxRevisionLength {
+		err := ex.New(
+			ErrRevisionTooLong,
+			ex.OptMessagef("Revision: %q, Maximum Length: %d", revision, maxRevisionLength),
+		)
+		return err
+	}
+	if migrations != nil && migrations.Get(revision) != nil {
+		return ex.New(ErrAlreadyRegistered, ex.OptMessagef("Revision: %q", revision))
+	}
+	return nil
+}
+
+// Filename returns the base name of the file for the new migration; this
+// is determined by the index and the description, e.g.
+// `0004_rename_the_root_user.sql`.
+func (s Scaffold) Filename() string {
+	slug := slugify(s.Description)
+	if slug == "" {
+		slug = s.Revision
+	}
+	return fmt.Sprintf("%04d_%s%s", s.Index, slug, sqlFileExtension)
+}
+
+// Contents returns the contents of the new migration file, in the format
+// expected by `LoadSequence()`.
+func (s Scaffold) Contents() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %s: %s\n", headerPrefix, headerRevision, s.Revision)
+	if s.Previous != "" {
+		fmt.Fprintf(&b, "%s %s: %s\n", headerPrefix, headerPrevious, s.Previous)
+	}
+	if s.Description != "" {
+		fmt.Fprintf(&b, "%s %s: %s\n", headerPrefix, headerDescription, s.Description)
+	}
+	if s.Milestone {
+		fmt.Fprintf(&b, "%s %s: true\n", headerPrefix, headerMilestone)
+	}
+	if !s.Transactional {
+		fmt.Fprintf(&b, "%s %s: false\n", headerPrefix, headerTransaction)
+	}
+	b.WriteString("\n")
+	return b.Bytes()
+}
+
+// WriteScaffold creates a scaffold for the next migration in `migrations`
+// and writes it to a new file in `dir`. This will fail rather than
+// overwrite an existing file. If writing fails, the partially written file
+// is removed so that a later attempt isn't blocked by it.
+func WriteScaffold(dir string, migrations *Migrations, opts ...ScaffoldOption) (string, *Scaffold, error) {
+	s, err := NewScaffold(migrations, opts...)
+	if err != nil {
+		return "", nil, err
+	}
+
+	filename := filepath.Join(dir, s.Filename())
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", nil, err
+	}
+
+	_, err = f.Write(s.Contents())
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		removeErr := os.Remove(filename)
+		if removeErr != nil {
+			return "", nil, ex.Nest(err, removeErr)
+		}
+		return "", nil, err
+	}
+
+	return filename, s, nil
+}
+
+// OptScaffoldRevision sets the revision on a scaffold, rather than using a
+// randomly generated one.
+func OptScaffoldRevision(revision string) ScaffoldOption {
+	return func(s *Scaffold) error {
+		if revision == "" {
+			return ex.New(ErrMissingRevision)
+		}
+
+		s.Revision = revision
+		return nil
+	}
+}
+
+// OptScaffoldDescription sets the description on a scaffold.
+func OptScaffoldDescription(description string) ScaffoldOption {
+	return func(s *Scaffold) error {
+		s.Description = description
+		return nil
+	}
+}
+
+// OptScaffoldMilestone sets the milestone flag on a scaffold.
+func OptScaffoldMilestone(milestone bool) ScaffoldOption {
+	return func(s *Scaffold) error {
+		s.Milestone = milestone
+		return nil
+	}
+}
+
+// OptScaffoldTransactional sets the transactional flag on a scaffold.
+func OptScaffoldTransactional(transactional bool) ScaffoldOption {
+	return func(s *Scaffold) error {
+		s.Transactional = transactional
+		return nil
+	}
+}
+
+// slugify converts a description into a lowercase string that is safe to use
+// in a filename, e.g. "Add index (concurrently)" becomes
+// "add_index_concurrently".
+func slugify(description string) string {
+	parts := strings.FieldsFunc(strings.ToLower(description), func(r rune) bool {
+		return r > unicode.MaxASCII || !(unicode.IsLetter(r) || unicode.IsDigit(r))
+	})
+	return strings.Join(parts, "_")
+}
@@ -0,0 +1,106 @@
+package golembic_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/ex"
+
+	golembic "github.com/dhermes/golembic-blend"
+	"github.com/dhermes/golembic-blend/examples"
+)
+
+func TestNewRevision(t *testing.T) {
+	it := assert.New(t)
+
+	revision, err := golembic.NewRevision()
+	it.Nil(err)
+	it.True(regexp.MustCompile("^[0-9a-f]{12}$").MatchString(revision))
+}
+
+func TestNewScaffold(t *testing.T) {
+	it := assert.New(t)
+
+	// Root migration
+	s, err := golembic.NewScaffold(nil, golembic.OptScaffoldDescription("Create users table"))
+	it.Nil(err)
+	it.Len(s.Revision, 12)
+	it.Equal("", s.Previous)
+	it.Equal("0001_create_users_table.sql", s.Filename())
+	expected := fmt.Sprintf("-- revision: %s\n-- description: Create users table\n\n", s.Revision)
+	it.Equal(expected, string(s.Contents()))
+
+	// Appended to an existing sequence
+	migrations, err := examples.AllMigrations(-1)
+	it.Nil(err)
+	s, err = golembic.NewScaffold(
+		migrations,
+		golembic.OptScaffoldRevision("b0ae69525735"),
+		golembic.OptScaffoldDescription("Add index on movie titles (concurrently)"),
+		golembic.OptScaffoldMilestone(true),
+		golembic.OptScaffoldTransactional(false),
+	)
+	it.Nil(err)
+	it.Equal("3196713ca7e6", s.Previous)
+	it.Equal("0008_add_index_on_movie_titles_concurrently.sql", s.Filename())
+	expected = "-- revision: b0ae69525735\n-- previous: 3196713ca7e6\n-- description: Add index on movie titles (concurrently)\n-- milestone: true\n-- transactional: false\n\n"
+	it.Equal(expected, string(s.Contents()))
+
+	// No description
+	s, err = golembic.NewScaffold(migrations, golembic.OptScaffoldRevision("b0ae69525735"))
+	it.Nil(err)
+	it.Equal("0008_b0ae69525735.sql", s.Filename())
+
+	// Supplied revision that is already registered
+	s, err = golembic.NewScaffold(migrations, golembic.OptScaffoldRevision("3196713ca7e6"))
+	it.Nil(s)
+	it.Equal(`Migration has already been registered; Revision: "3196713ca7e6"`, fmt.Sprintf("%v", err))
+
+	// Supplied revision that is too long
+	s, err = golembic.NewScaffold(migrations, golembic.OptScaffoldRevision("0123456789abcdef0123456789abcdef0"))
+	it.Nil(s)
+	expectedErr := `Revision is too long for the migrations metadata table; Revision: "0123456789abcdef0123456789abcdef0", Maximum Length: 32`
+	it.Equal(expectedErr, fmt.Sprintf("%v", err))
+
+	// Description with a newline
+	s, err = golembic.NewScaffold(migrations, golembic.OptScaffoldDescription("Add index\n-- milestone: true"))
+	it.Nil(s)
+	it.Equal(`Migration description cannot contain a newline; Description: "Add index\n-- milestone: true"`, fmt.Sprintf("%v", err))
+
+	// Failed option
+	known := ex.New("WRENCH")
+	opt := func(_ *golembic.Scaffold) error {
+		return known
+	}
+	s, err = golembic.NewScaffold(migrations, opt)
+	it.Nil(s)
+	it.Equal(known, err)
+}
+
+func TestWriteScaffold(t *testing.T) {
+	it := assert.New(t)
+
+	dir := t.TempDir()
+	filename, s, err := golembic.WriteScaffold(dir, nil, golembic.OptScaffoldDescription("The root"))
+	it.Nil(err)
+	it.Equal(filepath.Join(dir, "0001_the_root.sql"), filename)
+
+	migrations, err := golembic.LoadSequence(os.DirFS(dir), ".")
+	it.Nil(err)
+	it.Equal([]string{s.Revision}, migrations.Revisions())
+
+	_, s2, err := golembic.WriteScaffold(dir, migrations, golembic.OptScaffoldTransactional(false))
+	it.Nil(err)
+	migrations, err = golembic.LoadSequence(os.DirFS(dir), ".")
+	it.Nil(err)
+	it.Equal([]string{s.Revision, s2.Revision}, migrations.Revisions())
+	it.NotNil(migrations.Get(s2.Revision).UpConn)
+
+	// Refuse to overwrite an existing file
+	_, _, err = golembic.WriteScaffold(dir, nil, golembic.OptScaffoldDescription("The root"))
+	it.True(os.IsExist(err))
+}
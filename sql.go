@@ -9,11 +9,12 @@ import (
 )
 
 // readAllMigration performs a SQL query and reads all rows into a
-// `Migration` slice, under the assumption that three columns -- revision,
-// previous and created_at -- are being returned for the query (in that order).
-// For example, the query
+// `Migration` slice, under the assumption that four columns -- revision,
+// previous, created_at and checksum -- are being returned for the query (in
+// that order). The `serial_id` column may also be included. For example, the
+// query
 //
-//   SELECT revision, previous, created_at FROM golembic_migrations
+//   SELECT revision, previous, created_at, checksum FROM golembic_migrations
 //
 // would satisfy this. A more "focused" query would return the latest migration
 // applied
@@ -21,7 +22,8 @@ import (
 //   SELECT
 //     revision,
 //     previous,
-//     created_at
+//     created_at,
+//     checksum
 //   FROM
 //     golembic_migrations
 //   ORDER BY
@@ -51,13 +53,27 @@ type migrationModel struct {
 	Revision  string    `db:"revision"`
 	CreatedAt time.Time `db:"created_at"`
 	SerialID  uint32    `db:"serial_id"`
+	Checksum  string    `db:"checksum"`
 }
 
 func (mm migrationModel) ToMigration() Migration {
 	return Migration{
 		Previous:  mm.Previous,
 		Revision:  mm.Revision,
+		Checksum:  mm.Checksum,
 		createdAt: mm.CreatedAt,
 		serialID:  mm.SerialID,
 	}
 }
+
+// nullableMilliseconds converts a duration into a query parameter (in
+// milliseconds), where a zero duration will be stored as `NULL`.
+func nullableMilliseconds(value time.Duration) sql.NullInt64 {
+	return sql.NullInt64{Int64: value.Milliseconds(), Valid: value > 0}
+}
+
+// nullableString converts a string into a query parameter, where the
+// empty string will be stored as `NULL`.
+func nullableString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
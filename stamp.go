@@ -0,0 +1,113 @@
+package golembic
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/blend/go-sdk/db"
+	"github.com/blend/go-sdk/ex"
+)
+
+const (
+	// stampedSuffix is appended to the description of a migration that was
+	// stamped (i.e. recorded as applied without being run).
+	stampedSuffix = " [STAMPED]"
+)
+
+// Stamp records that the migrations through `revision` have been applied,
+// **without** running them. This is intended for adopting golembic on an
+// existing database or recovering after a change was applied manually. Only
+// the migrations after the latest applied migration are recorded, via
+// `InsertMigration()`, so `serial_id` and `previous` remain consistent with
+// the sequence. The migrations metadata table will be created (or upgraded)
+// if needed.
+//
+// It is an error to stamp a revision that comes before the latest applied
+// migration.
+func (m *Manager) Stamp(ctx context.Context, pool *db.Connection, revision string) (err error) {
+	if m.LockMode != LockModeNone {
+		// NOTE: Stamping only needs a single transaction alongside the lock.
+		la := &lockAction{m: m, Connections: 2}
+		err = la.Action(ctx, pool, nil)
+		if err != nil {
+			return
+		}
+		defer la.release(ctx)
+	}
+
+	tx, err := pool.BeginContext(ctx)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			if txErr := tx.Rollback(); txErr != nil {
+				err = ex.Nest(err, txErr)
+			}
+			return
+		}
+		err = tx.Commit()
+	}()
+
+	_, err = m.upgradeMetadataTable(ctx, pool, tx)
+	if err != nil {
+		return
+	}
+
+	through, err := m.Sequence.Through(revision)
+	if err != nil {
+		return
+	}
+
+	latest, _, err := m.latestMaybeVerify(ctx, pool, tx, m.VerifyHistory)
+	if err != nil {
+		return
+	}
+
+	pastMigrationCount := 0
+	if latest != "" {
+		pastMigrationCount, _, err = m.Sequence.Since(latest)
+		if err != nil {
+			return
+		}
+	}
+
+	if len(through) < pastMigrationCount {
+		body := fmt.Sprintf("Target revision %s is behind latest revision %s", revision, latest)
+		suiteWrite(ctx, m.Log, "failed", body)
+		err = ex.New(ErrTargetBehind, ex.OptMessagef("Target: %q, Latest: %q", revision, latest))
+		return
+	}
+
+	if len(through) == pastMigrationCount {
+		body := fmt.Sprintf("No migrations to stamp; latest revision: %s", latest)
+		PlanEventWrite(ctx, m.Log, "", body, "")
+		return
+	}
+
+	// NOTE: Stamping a migration also clears any in progress marker left by
+	//       an interrupted attempt (e.g. after finishing it manually).
+	clearMarkers := false
+	if m.hasNonTransactional() {
+		clearMarkers, err = m.inProgressTableExists(ctx, pool, tx)
+		if err != nil {
+			return
+		}
+	}
+
+	for _, mi := range through[pastMigrationCount:] {
+		err = m.InsertMigration(ctx, pool, tx, mi)
+		if err != nil {
+			return
+		}
+		if clearMarkers && mi.UpConn != nil {
+			err = m.clearInProgress(ctx, pool, tx, mi.Revision)
+			if err != nil {
+				return
+			}
+		}
+		PlanEventWrite(ctx, m.Log, mi.Revision, mi.ExtendedDescription()+stampedSuffix, PlanStatusStamped)
+	}
+
+	return
+}
@@ -0,0 +1,94 @@
+package golembic_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/logger"
+
+	golembic "github.com/dhermes/golembic-blend"
+)
+
+func TestManager_Stamp(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt := fmt.Sprintf("wibble_%s_migrations", suffix)
+	t1 := fmt.Sprintf("wibble1_%s", suffix)
+	t2 := fmt.Sprintf("wibble2_%s", suffix)
+	t.Cleanup(func() {
+		for _, table := range []string{mt, t1, t2} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+	})
+	var logBuffer bytes.Buffer
+	log := logger.Memory(&logBuffer)
+
+	migrations, err := makeSequence(t1, t2, 3, false)
+	it.Nil(err)
+	m, err := golembic.NewManager(
+		golembic.OptManagerSequence(migrations),
+		golembic.OptManagerMetadataTable(mt),
+		golembic.OptManagerLog(log),
+		golembic.OptManagerVerifyHistory(true),
+	)
+	it.Nil(err)
+
+	// Stamp the first two migrations (without creating the first table)
+	err = m.Stamp(ctx, pool, "ab1208989a3f")
+	it.Nil(err)
+	logLines := []string{
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 1: Create migrations metadata table", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 2: Add checksum column", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 3: Add description, duration_ms, applied_by, hostname and app_version columns", mt),
+		"[db.migration] -- aa60f058f5f5 -- Create first table [STAMPED]",
+		"[db.migration] -- ab1208989a3f -- Alter first table [STAMPED]",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// Stamping again is a no-op
+	err = m.Stamp(ctx, pool, "ab1208989a3f")
+	it.Nil(err)
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
+		"[db.migration] -- plan -- No migrations to stamp; latest revision: ab1208989a3f",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// Stamping a revision that is behind
+	err = m.Stamp(ctx, pool, "aa60f058f5f5")
+	expected := `Target revision is behind the latest applied migration; Target: "aa60f058f5f5", Latest: "ab1208989a3f"`
+	it.Equal(expected, fmt.Sprintf("%v", err))
+	logBuffer.Reset()
+
+	// Only the remaining migration is applied
+	suite, err := golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- 60a33b9d4c77 -- Add second table",
+		"[db.migration.stats] 1 applied 1 skipped 0 failed 2 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// Unknown revision
+	err = m.Stamp(ctx, pool, "not-registered")
+	it.Equal(`No migration registered for revision; Revision: "not-registered"`, fmt.Sprintf("%v", err))
+}
@@ -2,9 +2,40 @@ package golembic
 
 import (
 	"fmt"
+	"hash/fnv"
+	"unicode/utf8"
+
+	"github.com/blend/go-sdk/db"
 )
 
 const (
+	pkMigrationsConstraint         = "pk_%s_revision"
+	fkPreviousMigrationsConstraint = "fk_%s_previous"
+	uqSerialIDConstraint           = "uq_%s_serial_id"
+	chkSerialIDConstraint          = "chk_%s_serial_id"
+	uqPreviousMigrationsConstraint = "uq_%s_previous"
+	noCyclesMigrationsConstraint   = "chk_%s_previous_neq_revision"
+	singleRootMigrationsConstraint = "chk_%s_null_previous"
+	pkRepeatableConstraint         = "pk_%s_name"
+)
+
+// migrationsConstraintFormats are the formats for the names of the
+// constraints added to the migrations metadata table by
+// `createMigrationsStatements()`.
+var migrationsConstraintFormats = []string{
+	pkMigrationsConstraint,
+	fkPreviousMigrationsConstraint,
+	uqSerialIDConstraint,
+	chkSerialIDConstraint,
+	uqPreviousMigrationsConstraint,
+	noCyclesMigrationsConstraint,
+	singleRootMigrationsConstraint,
+}
+
+const (
+	createSchemaSQL = `
+CREATE SCHEMA IF NOT EXISTS %[1]s
+`
 	createMigrationsTableSQL = `
 CREATE TABLE %[1]s (
   serial_id  %[2]s,
@@ -12,6 +43,44 @@ CREATE TABLE %[1]s (
   previous   %[4]s,
   created_at %[5]s
 )
+`
+	createRepeatableTableSQL = `
+CREATE TABLE %[1]s (
+  name       %[2]s,
+  checksum   %[3]s,
+  applied_at %[4]s
+)
+`
+	createInProgressTableSQL = `
+CREATE TABLE %[1]s (
+  revision   %[2]s,
+  started_at %[3]s,
+  hostname   %[4]s,
+  last_error %[5]s
+)
+`
+	pkInProgressTableSQL = `
+ALTER TABLE %[1]s
+  ADD CONSTRAINT %[2]s PRIMARY KEY (revision)
+`
+	pkRepeatableTableSQL = `
+ALTER TABLE %[1]s
+  ADD CONSTRAINT %[2]s PRIMARY KEY (name)
+`
+	addChecksumMigrationsTableSQL = `
+ALTER TABLE %[1]s
+  ADD COLUMN IF NOT EXISTS checksum %[2]s
+`
+	commentMigrationsTableSQL = `
+COMMENT ON TABLE %[1]s IS %[2]s
+`
+	addAuditMigrationsTableSQL = `
+ALTER TABLE %[1]s
+  ADD COLUMN IF NOT EXISTS description %[2]s,
+  ADD COLUMN IF NOT EXISTS duration_ms %[3]s,
+  ADD COLUMN IF NOT EXISTS applied_by  %[4]s,
+  ADD COLUMN IF NOT EXISTS hostname    %[5]s,
+  ADD COLUMN IF NOT EXISTS app_version %[6]s
 `
 	pkMigrationsTableSQL = `
 ALTER TABLE %[1]s
@@ -52,10 +121,18 @@ ALTER TABLE %[1]s
 // CreateTableParameters specifies a set of parameters that are intended
 // to be used in a `CREATE TABLE` statement.
 type CreateTableParameters struct {
-	SerialID  string
-	Revision  string
-	Previous  string
-	CreatedAt string
+	SerialID    string
+	Revision    string
+	Previous    string
+	CreatedAt   string
+	Checksum    string
+	Description string
+	Duration    string
+	AppliedBy   string
+	Hostname    string
+	AppVersion  string
+	LastError   string
+	Name        string
 }
 
 func createMigrationsSQL(m *Manager) (CreateTableParameters, string) {
@@ -64,25 +141,72 @@ func createMigrationsSQL(m *Manager) (CreateTableParameters, string) {
 
 	statement := fmt.Sprintf(
 		createMigrationsTableSQL,
-		providerQuoteIdentifier(table), // [1]
-		ctp.SerialID,                   // [2]
-		ctp.Revision,                   // [3]
-		ctp.Previous,                   // [4]
-		ctp.CreatedAt,                  // [5]
+		m.quoteTable(table), // [1]
+		ctp.SerialID,        // [2]
+		ctp.Revision,        // [3]
+		ctp.Previous,        // [4]
+		ctp.CreatedAt,       // [5]
 	)
 	return ctp, statement
 }
 
+// addChecksumMigrationsSQL adds the `checksum` column to a migrations table
+// that was created before checksums were stored.
+func addChecksumMigrationsSQL(m *Manager) string {
+	ctp := providerNewCreateTableParameters()
+	return fmt.Sprintf(
+		addChecksumMigrationsTableSQL,
+		m.quoteTable(m.MetadataTable), // [1]
+		ctp.Checksum,                  // [2]
+	)
+}
+
+// commentMigrationsSQL records the schema version of the migrations metadata
+// table as a comment on the table.
+func commentMigrationsSQL(m *Manager, version int) string {
+	return fmt.Sprintf(
+		commentMigrationsTableSQL,
+		m.quoteTable(m.MetadataTable),                                     // [1]
+		QuoteLiteral(fmt.Sprintf("%s%d", metadataVersionPrefix, version)), // [2]
+	)
+}
+
+// migrationsConstraints returns the names of the constraints added to the
+// migrations metadata table by `createMigrationsStatements()`.
+func migrationsConstraints(m *Manager) []string {
+	names := make([]string, len(migrationsConstraintFormats))
+	for i, format := range migrationsConstraintFormats {
+		names[i] = constraintName(format, m.MetadataTable)
+	}
+	return names
+}
+
+// addAuditMigrationsSQL adds the columns that record who applied a migration,
+// from where and how long it took to a migrations table that was created
+// before these were stored.
+func addAuditMigrationsSQL(m *Manager) string {
+	ctp := providerNewCreateTableParameters()
+	return fmt.Sprintf(
+		addAuditMigrationsTableSQL,
+		m.quoteTable(m.MetadataTable), // [1]
+		ctp.Description,               // [2]
+		ctp.Duration,                  // [3]
+		ctp.AppliedBy,                 // [4]
+		ctp.Hostname,                  // [5]
+		ctp.AppVersion,                // [6]
+	)
+}
+
 // pkMigrationsSQL ensures the `revision` is used as the primary key in
 // the table.
 func pkMigrationsSQL(m *Manager) string {
 	table := m.MetadataTable
-	pkConstraint := fmt.Sprintf("pk_%s_revision", table)
+	pkConstraint := constraintName(pkMigrationsConstraint, table)
 
 	return fmt.Sprintf(
 		pkMigrationsTableSQL,
-		providerQuoteIdentifier(table), // [1]
-		pkConstraint,                   // [2]
+		m.quoteTable(table),                   // [1]
+		providerQuoteIdentifier(pkConstraint), // [2]
 	)
 }
 
@@ -90,48 +214,48 @@ func pkMigrationsSQL(m *Manager) string {
 // key to an existing `revision` (or `NULL`).
 func fkPreviousMigrationsSQL(m *Manager) string {
 	table := m.MetadataTable
-	fkConstraint := fmt.Sprintf("fk_%s_previous", table)
+	fkConstraint := constraintName(fkPreviousMigrationsConstraint, table)
 
 	return fmt.Sprintf(
 		fkPreviousMigrationsTableSQL,
-		providerQuoteIdentifier(table), // [1]
-		fkConstraint,                   // [2]
+		m.quoteTable(table),                   // [1]
+		providerQuoteIdentifier(fkConstraint), // [2]
 	)
 }
 
 // uqSerialID ensures the `serial_id` column is UNIQUE.
 func uqSerialID(m *Manager) string {
 	table := m.MetadataTable
-	uqConstraint := fmt.Sprintf("uq_%s_serial_id", table)
+	uqConstraint := constraintName(uqSerialIDConstraint, table)
 
 	return fmt.Sprintf(
 		uqSerialIDSQL,
-		providerQuoteIdentifier(table), // [1]
-		uqConstraint,                   // [2]
+		m.quoteTable(table),                   // [1]
+		providerQuoteIdentifier(uqConstraint), // [2]
 	)
 }
 
 // nonNegativeSerialID ensures the `serial_id` is not a negative number.
 func nonNegativeSerialID(m *Manager) string {
 	table := m.MetadataTable
-	chkConstraint := fmt.Sprintf("chk_%s_serial_id", table)
+	chkConstraint := constraintName(chkSerialIDConstraint, table)
 
 	return fmt.Sprintf(
 		nonNegativeSerialIDSQL,
-		providerQuoteIdentifier(table), // [1]
-		chkConstraint,                  // [2]
+		m.quoteTable(table),                    // [1]
+		providerQuoteIdentifier(chkConstraint), // [2]
 	)
 }
 
 // uqPreviousMigrationsSQL ensures the `previous` column is UNIQUE.
 func uqPreviousMigrationsSQL(m *Manager) string {
 	table := m.MetadataTable
-	uqConstraint := fmt.Sprintf("uq_%s_previous", table)
+	uqConstraint := constraintName(uqPreviousMigrationsConstraint, table)
 
 	return fmt.Sprintf(
 		uqPreviousMigrationsTableSQL,
-		providerQuoteIdentifier(table), // [1]
-		uqConstraint,                   // [2]
+		m.quoteTable(table),                   // [1]
+		providerQuoteIdentifier(uqConstraint), // [2]
 	)
 }
 
@@ -139,12 +263,12 @@ func uqPreviousMigrationsSQL(m *Manager) string {
 // `previous` equal to `revision` in a row.
 func noCyclesMigrationsSQL(m *Manager) string {
 	table := m.MetadataTable
-	chkConstraint := fmt.Sprintf("chk_%s_previous_neq_revision", table)
+	chkConstraint := constraintName(noCyclesMigrationsConstraint, table)
 
 	return fmt.Sprintf(
 		noCyclesMigrationsTableSQL,
-		providerQuoteIdentifier(table), // [1]
-		chkConstraint,                  // [2]
+		m.quoteTable(table),                    // [1]
+		providerQuoteIdentifier(chkConstraint), // [2]
 	)
 }
 
@@ -153,18 +277,24 @@ func noCyclesMigrationsSQL(m *Manager) string {
 // that `serial_id = 0` must be the root as well.
 func singleRootMigrationsSQL(m *Manager) string {
 	table := m.MetadataTable
-	nullPreviousIndex := fmt.Sprintf("chk_%s_null_previous", table)
+	nullPreviousIndex := constraintName(singleRootMigrationsConstraint, table)
 
 	return fmt.Sprintf(
 		singleRootMigrationsTableSQL,
-		providerQuoteIdentifier(table),             // [1]
+		m.quoteTable(table),                        // [1]
 		providerQuoteIdentifier(nullPreviousIndex), // [2]
 	)
 }
 
 func createMigrationsStatements(m *Manager) []string {
+	statements := []string{}
+	if m.CreateSchema && m.MetadataSchema != "" {
+		statements = append(statements, fmt.Sprintf(createSchemaSQL, providerQuoteIdentifier(m.MetadataSchema)))
+	}
+
 	_, createTable := createMigrationsSQL(m)
-	return []string{
+	return append(
+		statements,
 		createTable,
 		pkMigrationsSQL(m),
 		fkPreviousMigrationsSQL(m),
@@ -173,5 +303,114 @@ func createMigrationsStatements(m *Manager) []string {
 		uqPreviousMigrationsSQL(m),
 		noCyclesMigrationsSQL(m),
 		singleRootMigrationsSQL(m),
+	)
+}
+
+func createRepeatableStatements(m *Manager) []string {
+	table := m.repeatableTable()
+	ctp := providerNewCreateTableParameters()
+	pkConstraint := constraintName(pkRepeatableConstraint, table)
+
+	createTable := fmt.Sprintf(
+		createRepeatableTableSQL,
+		m.quoteTable(table), // [1]
+		ctp.Name,            // [2]
+		ctp.Checksum,        // [3]
+		ctp.CreatedAt,       // [4]
+	)
+	pk := fmt.Sprintf(
+		pkRepeatableTableSQL,
+		m.quoteTable(table),                   // [1]
+		providerQuoteIdentifier(pkConstraint), // [2]
+	)
+	return []string{createTable, pk}
+}
+
+func createInProgressStatements(m *Manager) []string {
+	table := m.inProgressTable()
+	ctp := providerNewCreateTableParameters()
+	pkConstraint := constraintName(pkMigrationsConstraint, table)
+
+	createTable := fmt.Sprintf(
+		createInProgressTableSQL,
+		m.quoteTable(table), // [1]
+		ctp.Revision,        // [2]
+		ctp.CreatedAt,       // [3]
+		ctp.Hostname,        // [4]
+		ctp.LastError,       // [5]
+	)
+	pk := fmt.Sprintf(
+		pkInProgressTableSQL,
+		m.quoteTable(table),                   // [1]
+		providerQuoteIdentifier(pkConstraint), // [2]
+	)
+	return []string{createTable, pk}
+}
+
+// metadataSchema returns the schema containing the metadata tables; if
+// `MetadataSchema` is not set, this is the schema of `pool`.
+func (m *Manager) metadataSchema(pool *db.Connection) string {
+	if m.MetadataSchema != "" {
+		return m.MetadataSchema
+	}
+	return pool.Config.SchemaOrDefault()
+}
+
+// qualifiedName returns the name of a metadata table, qualified by
+// `MetadataSchema` if set. This is used for display (e.g. in log lines).
+func (m *Manager) qualifiedName(table string) string {
+	if m.MetadataSchema == "" {
+		return table
+	}
+	return m.MetadataSchema + "." + table
+}
+
+// metadataTableKey identifies the metadata table of a manager when comparing
+// it with the metadata tables of other managers; it is the quoted, qualified
+// name of the table. Since no connection is available, a missing
+// `MetadataSchema` is assumed to be the default schema.
+func (m *Manager) metadataTableKey() string {
+	schema := m.MetadataSchema
+	if schema == "" {
+		schema = db.DefaultSchema
+	}
+	return providerQuoteQualifiedIdentifier(schema, m.MetadataTable)
+}
+
+// quoteTable quotes the name of a metadata table, qualified by
+// `MetadataSchema` if set, for usage in a query.
+func (m *Manager) quoteTable(table string) string {
+	return providerQuoteQualifiedIdentifier(m.MetadataSchema, table)
+}
+
+// constraintName produces the name of a constraint on `table` from `format`.
+// Since PostgreSQL truncates identifiers longer than `maxIdentifierLength`
+// bytes (which could cause two constraints to collide), a long name is
+// truncated with a hash of the full name appended so it stays unique.
+func constraintName(format, table string) string {
+	name := fmt.Sprintf(format, table)
+	if len(name) <= maxIdentifierLength {
+		return name
+	}
+
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(name))
+	suffix := fmt.Sprintf("_%08x", h.Sum32())
+	end := maxIdentifierLength - len(suffix)
+	for end > 0 && !utf8.RuneStart(name[end]) {
+		end--
+	}
+	return name[:end] + suffix
+}
+
+// legacyConstraintNames returns the names a constraint on `table` may have
+// been stored with by earlier versions of this package, which did not quote
+// (most) constraint names and did not account for truncation.
+func legacyConstraintNames(format, table string) []string {
+	name := fmt.Sprintf(format, table)
+	truncated := name
+	if len(truncated) > maxIdentifierLength {
+		truncated = truncated[:maxIdentifierLength]
 	}
+	return []string{truncated, normalizeIdentifier(name)}
 }
@@ -0,0 +1,220 @@
+package golembic
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/blend/go-sdk/db"
+	"github.com/blend/go-sdk/ex"
+)
+
+const (
+	lockTimeoutSetting                     = "lock_timeout"
+	statementTimeoutSetting                = "statement_timeout"
+	idleInTransactionSessionTimeoutSetting = "idle_in_transaction_session_timeout"
+)
+
+// Timeouts are the PostgreSQL timeouts used while applying a migration. A
+// zero value for any of the timeouts indicates that it is not set, i.e. the
+// value from the connection (or database) is used.
+//
+// For an `UpConn` migration, the timeouts are set on a dedicated session that
+// is opened from the `Config` of the connection pool, so applying an `UpConn`
+// migration with timeouts fails if the pool was not created with a `Config`.
+type Timeouts struct {
+	// LockTimeout limits the time spent waiting to acquire a lock, e.g. on a
+	// table being altered. This is the most important timeout for avoiding
+	// disruptions since a migration waiting on a lock blocks all queries
+	// queued behind it.
+	LockTimeout time.Duration
+	// StatementTimeout limits the time spent running any single statement.
+	StatementTimeout time.Duration
+	// IdleInTransactionSessionTimeout limits the time a session may be idle
+	// with an open transaction.
+	IdleInTransactionSessionTimeout time.Duration
+}
+
+// IsZero indicates that none of the timeouts are set.
+func (t Timeouts) IsZero() bool {
+	return t == Timeouts{}
+}
+
+// Merge produces timeouts with each value set in `t` taking precedence over
+// the corresponding value in `defaults`.
+func (t Timeouts) Merge(defaults Timeouts) Timeouts {
+	merged := defaults
+	if t.LockTimeout != 0 {
+		merged.LockTimeout = t.LockTimeout
+	}
+	if t.StatementTimeout != 0 {
+		merged.StatementTimeout = t.StatementTimeout
+	}
+	if t.IdleInTransactionSessionTimeout != 0 {
+		merged.IdleInTransactionSessionTimeout = t.IdleInTransactionSessionTimeout
+	}
+	return merged
+}
+
+// Statements produces the `SET` statements for each of the timeouts that are
+// set. If `local` is true, `SET LOCAL` will be used so the timeouts only
+// apply for the current transaction.
+func (t Timeouts) Statements(local bool) []string {
+	command := "SET"
+	if local {
+		command = "SET LOCAL"
+	}
+
+	statements := []string{}
+	for _, setting := range t.settings() {
+		statements = append(statements, fmt.Sprintf("%s %s = %d", command, setting.Name, timeoutMilliseconds(setting.Value)))
+	}
+	return statements
+}
+
+// resetStatements produces the statements that reset each of the timeouts
+// that are set to the value for the session, i.e. undo `Statements(true)`.
+func (t Timeouts) resetStatements() []string {
+	statements := []string{}
+	for _, setting := range t.settings() {
+		statements = append(statements, fmt.Sprintf("SET LOCAL %s TO DEFAULT", setting.Name))
+	}
+	return statements
+}
+
+// String describes each of the timeouts that are set, e.g.
+// `lock_timeout=5s statement_timeout=1m0s`.
+func (t Timeouts) String() string {
+	parts := []string{}
+	for _, setting := range t.settings() {
+		parts = append(parts, fmt.Sprintf("%s=%s", setting.Name, setting.Value))
+	}
+	return strings.Join(parts, " ")
+}
+
+// validate ensures none of the timeouts are negative.
+func (t Timeouts) validate() error {
+	for _, setting := range t.settings() {
+		if setting.Value < 0 {
+			return ex.New(ErrInvalidTimeout, ex.OptMessagef("%s: %s", setting.Name, setting.Value))
+		}
+	}
+	return nil
+}
+
+// suffix is appended to the description of a migration when the migration
+// is applied with timeouts.
+func (t Timeouts) suffix() string {
+	if t.IsZero() {
+		return ""
+	}
+	return fmt.Sprintf(" [%s]", t)
+}
+
+type timeoutSetting struct {
+	Name  string
+	Value time.Duration
+}
+
+// settings returns the timeouts that are set, in a stable order.
+func (t Timeouts) settings() []timeoutSetting {
+	all := []timeoutSetting{
+		{Name: lockTimeoutSetting, Value: t.LockTimeout},
+		{Name: statementTimeoutSetting, Value: t.StatementTimeout},
+		{Name: idleInTransactionSessionTimeoutSetting, Value: t.IdleInTransactionSessionTimeout},
+	}
+	result := []timeoutSetting{}
+	for _, setting := range all {
+		if setting.Value != 0 {
+			result = append(result, setting)
+		}
+	}
+	return result
+}
+
+// timeoutMilliseconds converts a timeout to the integer number of
+// milliseconds PostgreSQL expects. Since `0` disables a timeout in
+// PostgreSQL, a (positive) timeout less than one millisecond is rounded up.
+func timeoutMilliseconds(d time.Duration) int64 {
+	ms := d.Milliseconds()
+	if ms == 0 && d > 0 {
+		return 1
+	}
+	return ms
+}
+
+// effectiveTimeouts determines the timeouts used to apply a migration; the
+// timeouts on the migration take precedence over the manager defaults.
+func (m *Manager) effectiveTimeouts(migration Migration) Timeouts {
+	return migration.Timeouts.Merge(m.Timeouts)
+}
+
+// invokeUp invokes the "Up" function for a migration with the effective
+// timeouts. For `Up`, the timeouts are set via `SET LOCAL` in the
+// transaction. For `UpConn`, a dedicated session is opened (see
+// `dedicatedSession()`) so the timeouts don't leak into the pool.
+func (m *Manager) invokeUp(ctx context.Context, pool *db.Connection, tx *sql.Tx, migration Migration) error {
+	timeouts := m.effectiveTimeouts(migration)
+	if timeouts.IsZero() {
+		return migration.InvokeUp(ctx, pool, tx)
+	}
+
+	if migration.UpConn == nil {
+		for _, statement := range timeouts.Statements(true) {
+			_, err := pool.Invoke(db.OptContext(ctx), db.OptTx(tx)).Exec(statement)
+			if err != nil {
+				return err
+			}
+		}
+		return migration.InvokeUp(ctx, pool, tx)
+	}
+
+	session, err := dedicatedSession(ctx, pool, timeouts)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	return migration.InvokeUp(ctx, session, tx)
+}
+
+// dedicatedSession opens a new connection "pool" with exactly one connection
+// (i.e. one session) using the same configuration as `pool` and sets the
+// timeouts for the session. A `*sql.Conn` from `pool` can't be used instead
+// since `UpConn` is invoked with a `*db.Connection`, which can only wrap a
+// `*sql.DB`; as a result `pool` must have a `Config`.
+func dedicatedSession(ctx context.Context, pool *db.Connection, timeouts Timeouts) (*db.Connection, error) {
+	cfg := pool.Config
+	if cfg.IsZero() {
+		err := ex.New(ErrCannotInvokeUp, ex.OptMessage("Cannot open a dedicated session with timeouts, connection has no config"))
+		return nil, err
+	}
+	cfg.MaxConnections = 1
+	cfg.IdleConnections = 1
+
+	session, err := db.New(
+		db.OptConfig(cfg),
+		db.OptLog(pool.Log),
+		db.OptTracer(pool.Tracer),
+		db.OptStatementInterceptor(pool.StatementInterceptor),
+	)
+	if err != nil {
+		return nil, err
+	}
+	err = session.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, statement := range timeouts.Statements(false) {
+		_, err = session.Invoke(db.OptContext(ctx)).Exec(statement)
+		if err != nil {
+			_ = session.Close()
+			return nil, err
+		}
+	}
+
+	return session, nil
+}
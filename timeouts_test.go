@@ -0,0 +1,147 @@
+package golembic_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/db"
+	"github.com/blend/go-sdk/logger"
+
+	golembic "github.com/dhermes/golembic-blend"
+)
+
+func TestTimeouts(t *testing.T) {
+	it := assert.New(t)
+
+	defaults := golembic.Timeouts{LockTimeout: 5 * time.Second, StatementTimeout: time.Minute}
+	it.True(golembic.Timeouts{}.IsZero())
+	it.False(defaults.IsZero())
+	it.Equal("lock_timeout=5s statement_timeout=1m0s", defaults.String())
+	it.Equal([]string{"SET LOCAL lock_timeout = 5000", "SET LOCAL statement_timeout = 60000"}, defaults.Statements(true))
+
+	t1 := golembic.Timeouts{LockTimeout: 500 * time.Microsecond, IdleInTransactionSessionTimeout: 10 * time.Second}
+	merged := t1.Merge(defaults)
+	expected := golembic.Timeouts{
+		LockTimeout:                     500 * time.Microsecond,
+		StatementTimeout:                time.Minute,
+		IdleInTransactionSessionTimeout: 10 * time.Second,
+	}
+	it.Equal(expected, merged)
+	// NOTE: Sub-millisecond timeouts are rounded up (`0` disables a timeout).
+	expectedStatements := []string{
+		"SET lock_timeout = 1",
+		"SET statement_timeout = 60000",
+		"SET idle_in_transaction_session_timeout = 10000",
+	}
+	it.Equal(expectedStatements, merged.Statements(false))
+	it.Equal([]string{}, golembic.Timeouts{}.Statements(true))
+}
+
+func TestOptLockTimeout(t *testing.T) {
+	it := assert.New(t)
+
+	migration, err := golembic.NewMigration(
+		golembic.OptRevision("b5b5d8e0a9c1"),
+		golembic.OptLockTimeout(3*time.Second),
+		golembic.OptStatementTimeout(time.Minute),
+		golembic.OptIdleInTransactionSessionTimeout(30*time.Second),
+	)
+	it.Nil(err)
+	expected := golembic.Timeouts{
+		LockTimeout:                     3 * time.Second,
+		StatementTimeout:                time.Minute,
+		IdleInTransactionSessionTimeout: 30 * time.Second,
+	}
+	it.Equal(expected, migration.Timeouts)
+
+	_, err = golembic.NewMigration(golembic.OptRevision("b5b5d8e0a9c1"), golembic.OptStatementTimeout(-time.Second))
+	it.Equal("Migration timeout must not be negative; statement_timeout: -1s", fmt.Sprintf("%v", err))
+	_, err = golembic.NewManager(golembic.OptManagerTimeouts(golembic.Timeouts{LockTimeout: -time.Second}))
+	it.Equal("Migration timeout must not be negative; lock_timeout: -1s", fmt.Sprintf("%v", err))
+}
+
+func TestGenerateSuite_Timeouts(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt := fmt.Sprintf("garply_%s_migrations", suffix)
+	t.Cleanup(func() {
+		it.Nil(dropTable(ctx, pool, mt))
+	})
+	var logBuffer bytes.Buffer
+	log := logger.Memory(&logBuffer)
+
+	showTimeouts := func(i *db.Invocation) ([]string, error) {
+		settings := []string{"lock_timeout", "statement_timeout", "idle_in_transaction_session_timeout"}
+		values := make([]string, len(settings))
+		for j, setting := range settings {
+			_, err := i.Query("SELECT current_setting($1)", setting).Scan(&values[j])
+			if err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	}
+	var seen1, seen2 []string
+	migrations, err := golembic.NewSequence(golembic.Migration{
+		Revision:    "c2d9a1f7e3b4",
+		Description: "Check transaction timeouts",
+		Up: func(ctx context.Context, pool *db.Connection, tx *sql.Tx) (err error) {
+			seen1, err = showTimeouts(pool.Invoke(db.OptContext(ctx), db.OptTx(tx)))
+			return
+		},
+		Timeouts: golembic.Timeouts{LockTimeout: 2 * time.Second},
+	})
+	it.Nil(err)
+	err = migrations.Register(golembic.Migration{
+		Previous:    "c2d9a1f7e3b4",
+		Revision:    "e8f1b0c6d4a2",
+		Description: "Check session timeouts",
+		UpConn: func(ctx context.Context, pool *db.Connection) (err error) {
+			seen2, err = showTimeouts(pool.Invoke(db.OptContext(ctx)))
+			return
+		},
+	})
+	it.Nil(err)
+
+	m, err := golembic.NewManager(
+		golembic.OptManagerSequence(migrations),
+		golembic.OptManagerMetadataTable(mt),
+		golembic.OptManagerLog(log),
+		golembic.OptManagerTimeouts(golembic.Timeouts{LockTimeout: time.Second, StatementTimeout: time.Minute}),
+	)
+	it.Nil(err)
+	suite, err := golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+
+	it.Equal([]string{"2s", "1min", "0"}, seen1)
+	it.Equal([]string{"1s", "1min", "0"}, seen2)
+	logLines := []string{
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 1: Create migrations metadata table", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 2: Add checksum column", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 3: Add description, duration_ms, applied_by, hostname and app_version columns", mt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- c2d9a1f7e3b4 -- Check transaction timeouts [lock_timeout=2s statement_timeout=1m0s]",
+		"[db.migration] -- e8f1b0c6d4a2 -- Check session timeouts [lock_timeout=1s statement_timeout=1m0s]",
+		"[db.migration.stats] 3 applied 0 skipped 0 failed 3 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+
+	// `SET LOCAL` and the dedicated session don't leak into the pool
+	values, err := showTimeouts(pool.Invoke(db.OptContext(ctx)))
+	it.Nil(err)
+	it.Equal([]string{"0", "0", "0"}, values)
+}
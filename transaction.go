@@ -0,0 +1,215 @@
+package golembic
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/blend/go-sdk/db"
+	"github.com/blend/go-sdk/db/migration"
+	"github.com/blend/go-sdk/ex"
+)
+
+// NOTE: Ensure that
+//       * `singleTransactionAction` satisfies `migration.Action`.
+//       * `singleTransactionAction` satisfies `rollbacker`.
+var (
+	_ migration.Action = (*singleTransactionAction)(nil)
+	_ rollbacker       = (*singleTransactionAction)(nil)
+)
+
+// singleTransactionGroup produces the group used when a manager is in single
+// transaction mode. Setting up the metadata tables, planning and applying
+// every migration are all carried out by one action in one group, and hence
+// in one transaction.
+func singleTransactionGroup(m *Manager, opts []ApplyOption) *migration.Group {
+	setup := []migration.Action{}
+	for _, group := range setupGroups(m) {
+		setup = append(setup, group.Actions...)
+	}
+
+	sta := singleTransactionAction{m: m, opts: opts, Setup: setup}
+	return migration.NewGroup(migration.OptGroupActions(&sta))
+}
+
+// singleTransactionAction sets up the metadata tables, plans and applies all
+// migrations (including repeatable migrations) using a single transaction.
+type singleTransactionAction struct {
+	m     *Manager
+	opts  []ApplyOption
+	Setup []migration.Action
+
+	// started indicates the action was invoked, before is the number of
+	// actions applied in the suite before this action and applied are the
+	// migrations applied by this action.
+	started bool
+	before  int
+	applied []appliedMigration
+}
+
+// appliedMigration is a migration applied within the single transaction.
+type appliedMigration struct {
+	Migration  Migration
+	Repeatable bool
+}
+
+// Action carries out the setup, planning and every migration. If any of
+// these fail, the transaction will be rolled back (see `rollback()`).
+func (sta *singleTransactionAction) Action(ctx context.Context, pool *db.Connection, tx *sql.Tx) (err error) {
+	sta.started = true
+	sta.before = 0
+	if suite := migration.GetContextSuite(ctx); suite != nil {
+		sta.before = suite.Applied
+	}
+
+	sta.applied, err = sta.apply(ctx, pool, tx)
+	return
+}
+
+// rollback is invoked when the group for the action fails, i.e. when the
+// action fails or when committing the transaction fails. The migrations that
+// were applied are removed from the suite stats and a failed event makes it
+// clear that nothing was committed.
+func (sta *singleTransactionAction) rollback(ctx context.Context) {
+	// NOTE: If the transaction could not be started, the action was never
+	//       invoked so there is nothing to roll back.
+	if !sta.started {
+		return
+	}
+
+	body := fmt.Sprintf("Rolled back single transaction; %d applied migration(s) were not committed", len(sta.applied))
+	suiteWrite(ctx, sta.m.Log, migration.StatFailed, body)
+	recordRollback(ctx, len(sta.applied))
+	for _, am := range sta.applied {
+		sta.m.recordRollback(ctx, am.Migration, am.Repeatable)
+	}
+	if suite := migration.GetContextSuite(ctx); suite != nil {
+		rolledBack := suite.Applied - sta.before
+		suite.Applied -= rolledBack
+		suite.Total -= rolledBack
+	}
+	sta.started = false
+	sta.applied = nil
+}
+
+// apply carries out the setup, planning and every migration and returns the
+// migrations that were applied.
+func (sta *singleTransactionAction) apply(ctx context.Context, pool *db.Connection, tx *sql.Tx) ([]appliedMigration, error) {
+	m := sta.m
+	for _, action := range sta.Setup {
+		err := action.Action(ctx, pool, tx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	planCtx, span := m.startSpan(ctx, SpanPlan)
+	migrations, err := sta.plan(planCtx, pool, tx)
+	if err == nil {
+		span.SetAttributes(Attribute{Key: AttributePending, Value: len(migrations)})
+	}
+	endSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := []appliedMigration{}
+	for _, mi := range migrations {
+		err = m.applySingleTransaction(ctx, pool, tx, mi, false)
+		if err != nil {
+			return applied, err
+		}
+		applied = append(applied, appliedMigration{Migration: mi})
+	}
+
+	if len(m.Sequence.Repeatables()) == 0 {
+		return applied, nil
+	}
+	reachesEnd, err := m.planReachesEnd(migrations, sta.opts...)
+	if err != nil {
+		return applied, err
+	}
+	if !reachesEnd {
+		m.deferRepeatables(ctx)
+		return applied, nil
+	}
+
+	PlanEventWrite(ctx, m.Log, "", "Determine repeatable migrations that need to be applied", "")
+	repeatables, err := m.PlanRepeatable(ctx, pool, tx)
+	if err != nil {
+		return applied, err
+	}
+	err = validateSingleTransaction(repeatables)
+	if err != nil {
+		return applied, err
+	}
+	recordPending(ctx, repeatables, true)
+
+	for _, mi := range repeatables {
+		err = m.applySingleTransaction(ctx, pool, tx, mi, true)
+		if err != nil {
+			return applied, err
+		}
+		applied = append(applied, appliedMigration{Migration: mi, Repeatable: true})
+	}
+	return applied, nil
+}
+
+// plan determines the migrations in the sequence that need to be applied,
+// invoking the hooks of the manager before and after.
+func (sta *singleTransactionAction) plan(ctx context.Context, pool *db.Connection, tx *sql.Tx) ([]Migration, error) {
+	m := sta.m
+	err := m.Hooks.beforePlan(ctx, pool, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	PlanEventWrite(ctx, m.Log, "", "Determine migrations that need to be applied", "")
+	opts := append([]ApplyOption{OptApplyVerifyHistory(m.VerifyHistory)}, sta.opts...)
+	migrations, err := m.Plan(ctx, pool, tx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	err = validateSingleTransaction(migrations)
+	if err != nil {
+		return nil, err
+	}
+	err = m.Hooks.afterPlan(ctx, pool, tx, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	recordPending(ctx, migrations, false)
+	return migrations, nil
+}
+
+// applySingleTransaction applies a migration within the single transaction.
+// Since `SET LOCAL` lasts until the end of the transaction, any timeouts set
+// for the migration are reset afterwards so they don't carry over into the
+// next migration.
+func (m *Manager) applySingleTransaction(ctx context.Context, pool *db.Connection, tx *sql.Tx, mi Migration, repeatable bool) error {
+	aa := applyAction{m: m, Migration: mi, Repeatable: repeatable}
+	err := aa.Action(ctx, pool, tx)
+	if err != nil {
+		return err
+	}
+
+	for _, statement := range m.effectiveTimeouts(mi).resetStatements() {
+		_, err = pool.Invoke(db.OptContext(ctx), db.OptTx(tx)).Exec(statement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateSingleTransaction ensures that none of the planned migrations must
+// be run outside of a transaction (i.e. via `UpConn`).
+func validateSingleTransaction(migrations []Migration) error {
+	for _, mi := range migrations {
+		if mi.UpConn != nil {
+			return ex.New(ErrNotTransactional, ex.OptMessagef("Revision: %q", mi.Revision))
+		}
+	}
+	return nil
+}
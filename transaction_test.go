@@ -0,0 +1,200 @@
+package golembic_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/blend/go-sdk/assert"
+	"github.com/blend/go-sdk/db"
+	"github.com/blend/go-sdk/logger"
+
+	golembic "github.com/dhermes/golembic-blend"
+)
+
+func TestGenerateSuite_SingleTransaction(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt := fmt.Sprintf("ham_%s_migrations", suffix)
+	t1 := fmt.Sprintf("ham1_%s", suffix)
+	t2 := fmt.Sprintf("ham2_%s", suffix)
+	t.Cleanup(func() {
+		for _, table := range []string{mt, mt + "_in_progress", t1, t2} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+	})
+	var logBuffer bytes.Buffer
+	log := logger.Memory(&logBuffer)
+
+	// Add a migration that fails after the first three have been applied
+	migrations, err := makeSequence(t1, t2, 3, false)
+	it.Nil(err)
+	err = migrations.RegisterManyOpt([]golembic.MigrationOption{
+		golembic.OptPrevious("60a33b9d4c77"),
+		golembic.OptRevision("d2c3b4a5f6e7"),
+		golembic.OptDescription("Create first table again"),
+		golembic.OptUpFromSQL(fmt.Sprintf("CREATE TABLE %s ( bar TEXT )", golembic.QuoteIdentifier(t1))),
+	})
+	it.Nil(err)
+	m, err := golembic.NewManager(
+		golembic.OptManagerSequence(migrations),
+		golembic.OptManagerMetadataTable(mt),
+		golembic.OptManagerLog(log),
+		golembic.OptManagerSingleTransaction(true),
+	)
+	it.Nil(err)
+
+	suite, err := golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.NotNil(err)
+	logLines := []string{
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 1: Create migrations metadata table", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 2: Add checksum column", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 3: Add description, duration_ms, applied_by, hostname and app_version columns", mt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- aa60f058f5f5 -- Create first table",
+		"[db.migration] -- ab1208989a3f -- Alter first table",
+		"[db.migration] -- 60a33b9d4c77 -- Add second table",
+		"[db.migration] -- d2c3b4a5f6e7 -- Create first table again",
+		"[db.migration] -- failed -- Rolled back single transaction; 3 applied migration(s) were not committed",
+		"[db.migration.stats] 0 applied 0 skipped 1 failed 1 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// Nothing was committed, not even the metadata table
+	history, err := m.History(ctx, pool)
+	it.Nil(err)
+	it.Equal([]golembic.HistoryEntry{}, history)
+
+	// Only the migrations that succeed are applied
+	m.Sequence, err = makeSequence(t1, t2, 3, false)
+	it.Nil(err)
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Nil(err)
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 1: Create migrations metadata table", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 2: Add checksum column", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 3: Add description, duration_ms, applied_by, hostname and app_version columns", mt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- aa60f058f5f5 -- Create first table",
+		"[db.migration] -- ab1208989a3f -- Alter first table",
+		"[db.migration] -- 60a33b9d4c77 -- Add second table",
+		"[db.migration.stats] 4 applied 0 skipped 0 failed 4 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	logBuffer.Reset()
+
+	// A plan with an `UpConn` migration is refused
+	err = m.Sequence.RegisterManyOpt([]golembic.MigrationOption{
+		golembic.OptPrevious("60a33b9d4c77"),
+		golembic.OptRevision("e7f6a5b4c3d2"),
+		golembic.OptDescription("Add index concurrently"),
+		golembic.OptUpConnFromSQL(fmt.Sprintf("CREATE INDEX CONCURRENTLY ON %s (baz)", golembic.QuoteIdentifier(t2))),
+	})
+	it.Nil(err)
+	suite, err = golembic.GenerateSuite(m)
+	it.Nil(err)
+	_, err = golembic.ApplyDynamic(ctx, suite, pool)
+	it.Equal(`Migration cannot be applied in a single transaction; Revision: "e7f6a5b4c3d2"`, fmt.Sprintf("%v", err))
+	logLines = []string{
+		fmt.Sprintf("[db.migration] -- skipped -- Metadata table %s is at schema version 3", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Check table does not exist: %s_in_progress", mt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- failed -- Rolled back single transaction; 0 applied migration(s) were not committed",
+		"[db.migration.stats] 0 applied 1 skipped 0 failed 1 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+}
+
+func TestGenerateSuite_SingleTransactionCommitFails(t *testing.T) {
+	it := assert.New(t)
+
+	ctx := context.TODO()
+	pool := defaultDB()
+	it.NotNil(pool)
+
+	suffix := anyLowercase(6)
+	mt := fmt.Sprintf("plum_%s_migrations", suffix)
+	t1 := fmt.Sprintf("plum1_%s", suffix)
+	t2 := fmt.Sprintf("plum2_%s", suffix)
+	t.Cleanup(func() {
+		for _, table := range []string{mt, t1, t2} {
+			it.Nil(dropTable(ctx, pool, table))
+		}
+	})
+	var logBuffer bytes.Buffer
+	log := logger.Memory(&logBuffer)
+
+	// Add a migration that violates a deferred constraint, so every migration
+	// succeeds but the transaction fails to commit
+	migrations, err := makeSequence(t1, t2, 2, false)
+	it.Nil(err)
+	qt2 := golembic.QuoteIdentifier(t2)
+	statements := []string{
+		fmt.Sprintf("CREATE TABLE %s ( baz TEXT UNIQUE DEFERRABLE INITIALLY DEFERRED )", qt2),
+		fmt.Sprintf("INSERT INTO %s (baz) VALUES ('x')", qt2),
+		fmt.Sprintf("INSERT INTO %s (baz) VALUES ('x')", qt2),
+	}
+	err = migrations.RegisterManyOpt([]golembic.MigrationOption{
+		golembic.OptPrevious("ab1208989a3f"),
+		golembic.OptRevision("d2c3b4a5f6e7"),
+		golembic.OptDescription("Add second table with duplicate rows"),
+		golembic.OptUp(func(ctx context.Context, pool *db.Connection, tx *sql.Tx) error {
+			for _, statement := range statements {
+				_, err := pool.Invoke(db.OptContext(ctx), db.OptTx(tx)).Exec(statement)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		}),
+	})
+	it.Nil(err)
+	m, err := golembic.NewManager(
+		golembic.OptManagerSequence(migrations),
+		golembic.OptManagerMetadataTable(mt),
+		golembic.OptManagerLog(log),
+		golembic.OptManagerSingleTransaction(true),
+	)
+	it.Nil(err)
+
+	suite, err := golembic.GenerateSuite(m)
+	it.Nil(err)
+	report, err := golembic.ApplyDynamic(ctx, suite, pool)
+	it.NotNil(err)
+	logLines := []string{
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 1: Create migrations metadata table", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 2: Add checksum column", mt),
+		fmt.Sprintf("[db.migration] -- applied -- Upgrade metadata table %s to schema version 3: Add description, duration_ms, applied_by, hostname and app_version columns", mt),
+		"[db.migration] -- plan -- Determine migrations that need to be applied",
+		"[db.migration] -- aa60f058f5f5 -- Create first table",
+		"[db.migration] -- ab1208989a3f -- Alter first table",
+		"[db.migration] -- d2c3b4a5f6e7 -- Add second table with duplicate rows",
+		"[db.migration] -- failed -- Rolled back single transaction; 3 applied migration(s) were not committed",
+		"[db.migration.stats] 0 applied 0 skipped 0 failed 0 total",
+		"",
+	}
+	it.Equal(strings.Join(logLines, "\n"), logBuffer.String())
+	it.Empty(report.Applied)
+	it.Len(report.RolledBack, 3)
+
+	// Nothing was committed, not even the metadata table
+	history, err := m.History(ctx, pool)
+	it.Nil(err)
+	it.Equal([]golembic.HistoryEntry{}, history)
+}